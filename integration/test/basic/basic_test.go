@@ -25,7 +25,7 @@ func TestBasic(t *testing.T) {
 	{
 		config.Logger.LogCtx(ctx, "level", "debug", "message", "checking release not found")
 
-		releaseContent, err := config.HelmClient.GetReleaseContent(ctx, metav1.NamespaceDefault, "no-release-exists")
+		releaseContent, err := config.HelmClient.GetReleaseContent(ctx, metav1.NamespaceDefault, "no-release-exists", helmclient.GetOptions{})
 		if err != nil && !helmclient.IsReleaseNotFound(err) {
 			t.Fatalf("expected release not found error got %v", err)
 		}
@@ -79,6 +79,23 @@ func TestBasic(t *testing.T) {
 		"my": "value",
 	}
 
+	{
+		config.Logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("planning adoption of %#q", releaseName))
+
+		report, err := config.HelmClient.PlanAdoption(ctx, chartPath, metav1.NamespaceDefault, values, helmclient.InstallOptions{ReleaseName: releaseName})
+		if err != nil {
+			t.Fatalf("could not plan adoption %v", err)
+		}
+
+		// None of the objects of the chart exist before it is installed.
+		expectedReport := &helmclient.AdoptionReport{}
+		if !cmp.Equal(report, expectedReport) {
+			t.Fatalf("want matching AdoptionReport \n %s", cmp.Diff(report, expectedReport))
+		}
+
+		config.Logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("planned adoption of %#q", releaseName))
+	}
+
 	{
 		config.Logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("installing %#q", releaseName))
 
@@ -108,10 +125,29 @@ func TestBasic(t *testing.T) {
 		config.Logger.LogCtx(ctx, "level", "debug", "message", "listed releases")
 	}
 
+	{
+		config.Logger.LogCtx(ctx, "level", "debug", "message", "listing deployed releases in all namespaces")
+
+		listOptions := helmclient.ListOptions{
+			AllNamespaces: true,
+			NameFilter:    "^" + releaseName + "$",
+			Statuses:      []string{helmclient.StatusDeployed},
+		}
+		releases, err := config.HelmClient.ListReleases(ctx, metav1.NamespaceDefault, listOptions)
+		if err != nil {
+			t.Fatalf("could not list releases %v", err)
+		}
+		if len(releases) != 1 || releases[0].Name != releaseName {
+			t.Fatalf("expected release %#q got %d releases", releaseName, len(releases))
+		}
+
+		config.Logger.LogCtx(ctx, "level", "debug", "message", "listed deployed releases in all namespaces")
+	}
+
 	{
 		config.Logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("getting release content for %#q", releaseName))
 
-		releaseContent, err := config.HelmClient.GetReleaseContent(ctx, metav1.NamespaceDefault, releaseName)
+		releaseContent, err := config.HelmClient.GetReleaseContent(ctx, metav1.NamespaceDefault, releaseName, helmclient.GetOptions{})
 		if err != nil {
 			t.Fatalf("expected nil error got %v", err)
 		}
@@ -210,7 +246,7 @@ func TestBasic(t *testing.T) {
 	{
 		config.Logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("getting release content for %#q", releaseName))
 
-		releaseContent, err := config.HelmClient.GetReleaseContent(ctx, metav1.NamespaceDefault, releaseName)
+		releaseContent, err := config.HelmClient.GetReleaseContent(ctx, metav1.NamespaceDefault, releaseName, helmclient.GetOptions{})
 		if err != nil {
 			t.Fatalf("expected nil error got %v", err)
 		}
@@ -256,7 +292,7 @@ func TestBasic(t *testing.T) {
 	{
 		config.Logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("getting release content for %#q", releaseName))
 
-		releaseContent, err := config.HelmClient.GetReleaseContent(ctx, metav1.NamespaceDefault, releaseName)
+		releaseContent, err := config.HelmClient.GetReleaseContent(ctx, metav1.NamespaceDefault, releaseName, helmclient.GetOptions{})
 		if err != nil {
 			t.Fatalf("expected nil error got %v", err)
 		}
@@ -288,7 +324,7 @@ func TestBasic(t *testing.T) {
 	{
 		config.Logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("deleting release %#q", releaseName))
 
-		err := config.HelmClient.DeleteRelease(ctx, metav1.NamespaceDefault, releaseName, helmclient.DeleteOptions{})
+		_, err := config.HelmClient.DeleteRelease(ctx, metav1.NamespaceDefault, releaseName, helmclient.DeleteOptions{})
 		if err != nil {
 			t.Fatalf("expected nil error got %v", err)
 		}
@@ -31,7 +31,7 @@ func TestBasic(t *testing.T) {
 	{
 		config.Logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("deleting release %#q", passingReleaseName))
 
-		err := config.HelmClient.DeleteRelease(ctx, metav1.NamespaceDefault, passingReleaseName, helmclient.DeleteOptions{})
+		_, err := config.HelmClient.DeleteRelease(ctx, metav1.NamespaceDefault, passingReleaseName, helmclient.DeleteOptions{})
 		if err != nil {
 			t.Fatalf("expected nil error got %#v", err)
 		}
@@ -51,7 +51,7 @@ func TestBasic(t *testing.T) {
 	{
 		config.Logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("deleting release %#q", failingReleaseName))
 
-		err := config.HelmClient.DeleteRelease(ctx, metav1.NamespaceDefault, failingReleaseName, helmclient.DeleteOptions{})
+		_, err := config.HelmClient.DeleteRelease(ctx, metav1.NamespaceDefault, failingReleaseName, helmclient.DeleteOptions{})
 		if err != nil {
 			t.Fatalf("expected nil error got %#v", err)
 		}
@@ -94,7 +94,7 @@ func runReleaseTest(ctx context.Context, releaseName string) error {
 	{
 		config.Logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("running release tests for %#q", releaseName))
 
-		err = config.HelmClient.RunReleaseTest(ctx, metav1.NamespaceDefault, releaseName)
+		_, err = config.HelmClient.RunReleaseTest(ctx, metav1.NamespaceDefault, releaseName, helmclient.ReleaseTestOptions{})
 		if err != nil {
 			config.Logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("release test failed for %#q", releaseName))
 			return microerror.Mask(err)
@@ -0,0 +1,229 @@
+package helmclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/kube"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// Helm tracks the release owning an object using these annotations. This needs
+// to be kept in sync with upstream.
+//
+// See: https://github.com/helm/helm/blob/main/pkg/action/validate.go
+const (
+	helmReleaseNameAnnotation      = "meta.helm.sh/release-name"
+	helmReleaseNamespaceAnnotation = "meta.helm.sh/release-namespace"
+)
+
+// PlanAdoption renders the given chart like InstallReleaseFromTarball and
+// reports which of its objects already exist in the cluster. Nothing is
+// changed. Objects without ownership metadata would be adopted when
+// installing with InstallOptions.Adopt. Objects owned by another release are
+// reported as conflicts and prevent the adoption.
+func (c *Client) PlanAdoption(ctx context.Context, chartPath, namespace string, values map[string]interface{}, options InstallOptions) (*AdoptionReport, error) {
+	eventName := "plan_adoption"
+
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeChartPath, chartPath),
+		attribute.String(attributeReleaseNamespace, namespace),
+	))
+	defer span.End()
+
+	m := c.metrics.observe(eventName, namespace)
+	defer m.stop()
+
+	ctx, debugLog := withDebugLog(ctx)
+
+	report, err := c.planAdoptionFromTarball(ctx, chartPath, namespace, values, options)
+	err = translateHelmError(err, namespace, options.ReleaseName)
+	if err != nil {
+		m.fail()
+		recordSpanError(span, err)
+		return nil, microerror.Mask(debugLog.attach(err))
+	}
+
+	return report, nil
+}
+
+func (c *Client) planAdoptionFromTarball(ctx context.Context, chartPath, namespace string, values map[string]interface{}, options InstallOptions) (*AdoptionReport, error) {
+	cfg, kubeClients, err := c.newActionConfigWithKubeClients(ctx, namespace, kubeClientOptions{})
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	chartRequested, err := c.loadHelmChart(ctx, chartPath)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	kubeClients.startRender()
+	report, err := c.planAdoption(cfg, chartRequested, namespace, values, options)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return report, nil
+}
+
+// planAdoption renders the chart using a dry run install and inspects the
+// ownership metadata of the rendered objects existing in the cluster.
+func (c *Client) planAdoption(cfg *action.Configuration, chartRequested *chart.Chart, namespace string, values map[string]interface{}, options InstallOptions) (*AdoptionReport, error) {
+	install := action.NewInstall(cfg)
+	options.configure(install, namespace)
+
+	// Taking ownership in the dry run skips Helm's own ownership check which
+	// would fail on the first existing object.
+	install.DryRun = true
+	install.TakeOwnership = true
+
+	rel, err := install.Run(chartRequested, values)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	resources, err := cfg.KubeClient.Build(bytes.NewBufferString(rel.Manifest), false)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	report, err := adoptionReport(resources, rel.Name, rel.Namespace)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return report, nil
+}
+
+// adoptionReport inspects the ownership metadata of the given resources
+// existing in the cluster.
+func adoptionReport(resources kube.ResourceList, releaseName, releaseNamespace string) (*AdoptionReport, error) {
+	report := &AdoptionReport{}
+	err := resources.Visit(func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+
+		existing, err := resource.NewHelper(info.Client, info.Mapping).Get(info.Namespace, info.Name)
+		if apierrors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		accessor, err := apimeta.Accessor(existing)
+		if err != nil {
+			return err
+		}
+
+		object := ObjectReference{
+			APIVersion: info.Mapping.GroupVersionKind.GroupVersion().String(),
+			Kind:       info.Mapping.GroupVersionKind.Kind,
+			Name:       info.Name,
+			Namespace:  info.Namespace,
+		}
+
+		classifyAdoption(report, object, accessor.GetAnnotations(), releaseName, releaseNamespace)
+
+		return nil
+	})
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return report, nil
+}
+
+// classifyAdoption adds the existing object to the report based on the
+// ownership annotations it carries. Objects without an owner or owned by the
+// release itself are adopted, all others are conflicts.
+func classifyAdoption(report *AdoptionReport, object ObjectReference, annotations map[string]string, releaseName, releaseNamespace string) {
+	ownerName := annotations[helmReleaseNameAnnotation]
+	ownerNamespace := annotations[helmReleaseNamespaceAnnotation]
+
+	switch {
+	case ownerName == "" && ownerNamespace == "":
+		report.Adopted = append(report.Adopted, object)
+	case ownerName == releaseName && ownerNamespace == releaseNamespace:
+		// The object already belongs to the release, e.g. because it was
+		// kept when the release was uninstalled.
+		report.Adopted = append(report.Adopted, object)
+	default:
+		report.Conflicts = append(report.Conflicts, AdoptionConflict{
+			Object:           object,
+			ReleaseName:      ownerName,
+			ReleaseNamespace: ownerNamespace,
+		})
+	}
+}
+
+// checkAdoption returns an adoptionConflictError if any object of the
+// release is owned by another release. This fails the install before Helm
+// stores the release. Objects claimed by another release after the check are
+// caught by the adoptingKubeClient.
+func (c *Client) checkAdoption(cfg *action.Configuration, chartRequested *chart.Chart, namespace string, values map[string]interface{}, options InstallOptions) error {
+	report, err := c.planAdoption(cfg, chartRequested, namespace, values, options)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = adoptionConflicts(report)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// adoptionConflicts returns an adoptionConflictError describing the
+// conflicts of the given report, if any.
+func adoptionConflicts(report *AdoptionReport) error {
+	if len(report.Conflicts) == 0 {
+		return nil
+	}
+
+	var conflicts []string
+	for _, conflict := range report.Conflicts {
+		conflicts = append(conflicts, fmt.Sprintf("%s %#q in namespace %#q is owned by release %#q in namespace %#q", conflict.Object.Kind, conflict.Object.Name, conflict.Object.Namespace, conflict.ReleaseName, conflict.ReleaseNamespace))
+	}
+
+	return microerror.Maskf(adoptionConflictError, "%s", strings.Join(conflicts, ", "))
+}
+
+// adoptingKubeClient checks the ownership of the existing objects Helm takes
+// ownership of when installing with InstallOptions.Adopt. Helm itself does
+// not check them at all when taking ownership. Checking right before they are
+// updated keeps objects claimed by another release after the install was
+// planned from being taken over.
+type adoptingKubeClient struct {
+	kubeClient
+
+	releaseName      string
+	releaseNamespace string
+}
+
+// UpdateThreeWayMerge is used by Helm to update the existing objects it takes
+// ownership of, which are given as the original resources.
+func (c *adoptingKubeClient) UpdateThreeWayMerge(original, target kube.ResourceList, force bool) (*kube.Result, error) {
+	report, err := adoptionReport(original, c.releaseName, c.releaseNamespace)
+	if err != nil {
+		return &kube.Result{}, microerror.Mask(err)
+	}
+
+	err = adoptionConflicts(report)
+	if err != nil {
+		return &kube.Result{}, microerror.Mask(err)
+	}
+
+	return c.kubeClient.UpdateThreeWayMerge(original, target, force)
+}
@@ -0,0 +1,293 @@
+package helmclient
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/kube"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+func Test_classifyAdoption(t *testing.T) {
+	object := ObjectReference{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Name:       "app-config",
+		Namespace:  "default",
+	}
+
+	testCases := []struct {
+		name           string
+		annotations    map[string]string
+		expectedReport *AdoptionReport
+	}{
+		{
+			name:        "case 0: object without annotations is adopted",
+			annotations: nil,
+			expectedReport: &AdoptionReport{
+				Adopted: []ObjectReference{object},
+			},
+		},
+		{
+			name: "case 1: object without ownership annotations is adopted",
+			annotations: map[string]string{
+				"example.com/foo": "bar",
+			},
+			expectedReport: &AdoptionReport{
+				Adopted: []ObjectReference{object},
+			},
+		},
+		{
+			name: "case 2: object owned by the release is adopted",
+			annotations: map[string]string{
+				helmReleaseNameAnnotation:      "app",
+				helmReleaseNamespaceAnnotation: "giantswarm",
+			},
+			expectedReport: &AdoptionReport{
+				Adopted: []ObjectReference{object},
+			},
+		},
+		{
+			name: "case 3: object owned by another release is a conflict",
+			annotations: map[string]string{
+				helmReleaseNameAnnotation:      "other",
+				helmReleaseNamespaceAnnotation: "giantswarm",
+			},
+			expectedReport: &AdoptionReport{
+				Conflicts: []AdoptionConflict{
+					{
+						Object:           object,
+						ReleaseName:      "other",
+						ReleaseNamespace: "giantswarm",
+					},
+				},
+			},
+		},
+		{
+			name: "case 4: object owned by a release of the same name in another namespace is a conflict",
+			annotations: map[string]string{
+				helmReleaseNameAnnotation:      "app",
+				helmReleaseNamespaceAnnotation: "default",
+			},
+			expectedReport: &AdoptionReport{
+				Conflicts: []AdoptionConflict{
+					{
+						Object:           object,
+						ReleaseName:      "app",
+						ReleaseNamespace: "default",
+					},
+				},
+			},
+		},
+		{
+			name: "case 5: object with partial ownership metadata is a conflict",
+			annotations: map[string]string{
+				helmReleaseNameAnnotation: "app",
+			},
+			expectedReport: &AdoptionReport{
+				Conflicts: []AdoptionConflict{
+					{
+						Object:      object,
+						ReleaseName: "app",
+					},
+				},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			report := &AdoptionReport{}
+			classifyAdoption(report, object, tc.annotations, "app", "giantswarm")
+
+			if diff := cmp.Diff(tc.expectedReport, report); diff != "" {
+				t.Fatalf("want matching report \n %s", diff)
+			}
+		})
+	}
+}
+
+func Test_Client_planAdoption(t *testing.T) {
+	otherRelease := map[string]string{
+		helmReleaseNameAnnotation:      "other",
+		helmReleaseNamespaceAnnotation: "default",
+	}
+
+	testCases := []struct {
+		name                 string
+		existing             map[string]map[string]string
+		expectedReport       *AdoptionReport
+		expectedErrorMatcher func(error) bool
+	}{
+		{
+			name:           "case 0: no existing objects",
+			existing:       map[string]map[string]string{},
+			expectedReport: &AdoptionReport{},
+		},
+		{
+			name: "case 1: existing objects without owner are adopted",
+			existing: map[string]map[string]string{
+				"a": nil,
+			},
+			expectedReport: &AdoptionReport{
+				Adopted: []ObjectReference{
+					{APIVersion: "v1", Kind: "ConfigMap", Name: "a", Namespace: "default"},
+				},
+			},
+		},
+		{
+			name: "case 2: existing objects owned by another release are conflicts",
+			existing: map[string]map[string]string{
+				"a": nil,
+				"b": otherRelease,
+			},
+			expectedReport: &AdoptionReport{
+				Adopted: []ObjectReference{
+					{APIVersion: "v1", Kind: "ConfigMap", Name: "a", Namespace: "default"},
+				},
+				Conflicts: []AdoptionConflict{
+					{
+						Object:           ObjectReference{APIVersion: "v1", Kind: "ConfigMap", Name: "b", Namespace: "default"},
+						ReleaseName:      "other",
+						ReleaseNamespace: "default",
+					},
+				},
+			},
+			expectedErrorMatcher: IsAdoptionConflict,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			api := newConfigMapTestAPI()
+			api.existing = tc.existing
+
+			c := &Client{}
+			cfg := newAdoptTestConfig(api.info("a"), api.info("b"))
+
+			report, err := c.planAdoption(cfg, newAdoptTestChart(), "default", nil, InstallOptions{ReleaseName: "app"})
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+			if diff := cmp.Diff(tc.expectedReport, report); diff != "" {
+				t.Fatalf("want matching report \n %s", diff)
+			}
+
+			// Checking the adoption fails for the same conflicts.
+			err = c.checkAdoption(cfg, newAdoptTestChart(), "default", nil, InstallOptions{ReleaseName: "app"})
+
+			switch {
+			case err == nil && tc.expectedErrorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.expectedErrorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.expectedErrorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.expectedErrorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+		})
+	}
+}
+
+func Test_adoptingKubeClient_UpdateThreeWayMerge(t *testing.T) {
+	updateError := errors.New("updated")
+
+	testCases := []struct {
+		name         string
+		existing     map[string]map[string]string
+		errorMatcher func(error) bool
+	}{
+		{
+			name: "case 0: objects without owner are updated",
+			existing: map[string]map[string]string{
+				"a": nil,
+			},
+			errorMatcher: func(err error) bool { return errors.Is(err, updateError) },
+		},
+		{
+			name: "case 1: objects owned by the release are updated",
+			existing: map[string]map[string]string{
+				"a": {helmReleaseNameAnnotation: "app", helmReleaseNamespaceAnnotation: "default"},
+			},
+			errorMatcher: func(err error) bool { return errors.Is(err, updateError) },
+		},
+		{
+			name: "case 2: objects claimed by another release in the meantime are not updated",
+			existing: map[string]map[string]string{
+				"a": {helmReleaseNameAnnotation: "other", helmReleaseNamespaceAnnotation: "default"},
+			},
+			errorMatcher: IsAdoptionConflict,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			api := newConfigMapTestAPI()
+			api.existing = tc.existing
+
+			// The wrapped client fails with updateError to tell whether it
+			// was called.
+			c := &adoptingKubeClient{
+				kubeClient: &kubefake.FailingKubeClient{
+					PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard},
+					UpdateError:        updateError,
+				},
+
+				releaseName:      "app",
+				releaseNamespace: "default",
+			}
+
+			resources := kube.ResourceList{api.info("a")}
+			_, err := c.UpdateThreeWayMerge(resources, resources, false)
+			if !tc.errorMatcher(err) {
+				t.Fatalf("error == %#v, want matching", err)
+			}
+		})
+	}
+}
+
+// newAdoptTestConfig returns an action configuration whose kube client builds
+// the given resources from any manifest.
+func newAdoptTestConfig(resources ...*resource.Info) *action.Configuration {
+	return &action.Configuration{
+		Capabilities: chartutil.DefaultCapabilities,
+		KubeClient: &kubefake.FailingKubeClient{
+			PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard},
+			DummyResources:     resources,
+		},
+		Log:      func(string, ...interface{}) {},
+		Releases: storage.Init(driver.NewMemory()),
+	}
+}
+
+func newAdoptTestChart() *chart.Chart {
+	return &chart.Chart{
+		Metadata: &chart.Metadata{
+			APIVersion: chart.APIVersionV2,
+			Name:       "app",
+			Version:    "1.0.0",
+		},
+		Templates: []*chart.File{
+			{
+				Name: "templates/configmaps.yaml",
+				Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: b\n"),
+			},
+		},
+	}
+}
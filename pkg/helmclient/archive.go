@@ -0,0 +1,276 @@
+package helmclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/giantswarm/microerror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// releaseArchiveVersion is the format version of archives written by
+	// ExportRelease. It must be incremented whenever the format changes in
+	// a way older clients cannot read.
+	releaseArchiveVersion = "v1"
+	// maxReleaseArchiveSize is the maximum size in bytes of the decompressed
+	// JSON document of an archive. It guards against archives decompressing
+	// into more data than fits into memory.
+	maxReleaseArchiveSize = 256 * 1024 * 1024
+)
+
+// releaseArchive is the gzipped JSON document produced by ExportRelease. The
+// revisions are stored in the same JSON format Helm uses in its storage
+// drivers.
+type releaseArchive struct {
+	Version   string             `json:"version"`
+	Name      string             `json:"name"`
+	Namespace string             `json:"namespace"`
+	Revisions []*release.Release `json:"revisions"`
+}
+
+// ExportRelease returns a portable archive of all revisions of a Helm Release
+// which can be imported into another cluster using ImportRelease.
+func (c *Client) ExportRelease(ctx context.Context, namespace, releaseName string) ([]byte, error) {
+	eventName := "export_release"
+
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeReleaseNamespace, namespace),
+		attribute.String(attributeReleaseName, releaseName),
+	))
+	defer span.End()
+
+	m := c.metrics.observe(eventName, namespace)
+	defer m.stop()
+
+	archive, err := c.exportRelease(ctx, namespace, releaseName)
+	err = translateHelmError(err, namespace, releaseName)
+	if err != nil {
+		m.fail()
+		recordSpanError(span, err)
+		return nil, microerror.Mask(err)
+	}
+
+	return archive, nil
+}
+
+func (c *Client) exportRelease(ctx context.Context, namespace, releaseName string) ([]byte, error) {
+	// Only the release storage is read so no action config is needed.
+	store := storage.Init(driver.NewSecrets(c.k8sClient.CoreV1().Secrets(namespace)))
+
+	history, err := store.History(releaseName)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Version < history[j].Version
+	})
+
+	data, err := json.Marshal(releaseArchive{
+		Version:   releaseArchiveVersion,
+		Name:      releaseName,
+		Namespace: namespace,
+		Revisions: history,
+	})
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+
+	_, err = w.Write(data)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ImportRelease writes all revisions of a Helm Release exported using
+// ExportRelease into the release storage of this client. Only the release
+// storage is written. The objects managed by the release are expected to be
+// migrated separately. Importing fails with a releaseAlreadyExistsError if the
+// release already exists in the target namespace.
+func (c *Client) ImportRelease(ctx context.Context, archive []byte, options ImportOptions) error {
+	eventName := "import_release"
+
+	ctx, span := c.tracer.Start(ctx, eventName)
+	defer span.End()
+
+	m := c.metrics.observe(eventName, options.Namespace)
+	defer m.stop()
+
+	err := c.importRelease(ctx, archive, options)
+	err = translateHelmError(err, options.Namespace, "")
+	if err != nil {
+		m.fail()
+		recordSpanError(span, err)
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (c *Client) importRelease(ctx context.Context, archive []byte, options ImportOptions) error {
+	a, err := decodeReleaseArchive(archive)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	if options.Namespace == "" {
+		options.Namespace = a.Namespace
+	}
+
+	audit := c.newAudit(AuditOperationImport, options.Namespace, a.Name, nil)
+	err = c.importReleaseArchive(ctx, audit, a, options)
+	audit.finish(ctx, err)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// importReleaseArchive writes the revisions of the decoded archive into the
+// release storage of the target namespace.
+func (c *Client) importReleaseArchive(ctx context.Context, audit *auditTrail, a *releaseArchive, options ImportOptions) error {
+	ctx, unlock, err := c.lockRelease(ctx, options.Namespace, a.Name)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	defer unlock()
+
+	audit.start(ctx)
+
+	// Only the release storage is written so no action config is needed.
+	store := storage.Init(driver.NewSecrets(c.k8sClient.CoreV1().Secrets(options.Namespace)))
+
+	existing, err := store.History(a.Name)
+	if err != nil && !IsReleaseNotFound(err) {
+		return microerror.Mask(err)
+	} else if len(existing) > 0 {
+		return microerror.Maskf(releaseAlreadyExistsError, "release %#q already exists in namespace %#q", a.Name, options.Namespace)
+	}
+
+	// Prepare all revisions before writing any of them so that an invalid
+	// manifest does not leave a partial history behind.
+	for _, rel := range a.Revisions {
+		rel.Namespace = options.Namespace
+
+		if len(options.NamespaceMapping) > 0 {
+			rel.Manifest, err = mapManifestNamespaces(rel.Manifest, options.NamespaceMapping)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			for _, hook := range rel.Hooks {
+				hook.Manifest, err = mapManifestNamespaces(hook.Manifest, options.NamespaceMapping)
+				if err != nil {
+					return microerror.Mask(err)
+				}
+			}
+		}
+	}
+
+	err = c.createRevisions(ctx, store, a.Revisions)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// mapManifestNamespaces replaces the explicit namespaces of the objects in the
+// given manifest according to the given mapping.
+func mapManifestNamespaces(manifest string, mapping map[string]string) (string, error) {
+	return rewriteManifest(manifest, func(o *unstructured.Unstructured) error {
+		if namespace, ok := mapping[o.GetNamespace()]; ok && o.GetNamespace() != "" {
+			o.SetNamespace(namespace)
+		}
+		return nil
+	})
+}
+
+// createRevisions writes the given revisions to the release storage. When
+// writing a revision fails the revisions written so far are deleted again so
+// that no partial history is left behind.
+func (c *Client) createRevisions(ctx context.Context, releases *storage.Storage, revisions []*release.Release) error {
+	var created []*release.Release
+	for _, rel := range revisions {
+		err := releases.Create(rel)
+		if err != nil {
+			c.deleteRevisions(ctx, releases, created)
+			return microerror.Mask(err)
+		}
+
+		created = append(created, rel)
+	}
+
+	return nil
+}
+
+// deleteRevisions deletes the given revisions. Failures are only logged as
+// revisions are deleted to clean up after another failure.
+func (c *Client) deleteRevisions(ctx context.Context, releases *storage.Storage, revisions []*release.Release) {
+	for _, rel := range revisions {
+		_, err := releases.Delete(rel.Name, rel.Version)
+		if err != nil {
+			c.logger.LogCtx(ctx, "level", "warning", "message", fmt.Sprintf("failed to delete revision %d of release %#q in namespace %#q", rel.Version, rel.Name, rel.Namespace), "stack", fmt.Sprintf("%#v", err))
+		}
+	}
+}
+
+func decodeReleaseArchive(archive []byte) (*releaseArchive, error) {
+	r, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, microerror.Maskf(invalidReleaseArchiveError, "%s", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	// Read one byte more than allowed to tell archives of exactly the
+	// maximum size from larger ones.
+	data, err := io.ReadAll(io.LimitReader(r, maxReleaseArchiveSize+1))
+	if err != nil {
+		return nil, microerror.Maskf(invalidReleaseArchiveError, "%s", err)
+	}
+	if len(data) > maxReleaseArchiveSize {
+		return nil, microerror.Maskf(invalidReleaseArchiveError, "archive exceeds %d bytes when decompressed", maxReleaseArchiveSize)
+	}
+
+	var a releaseArchive
+	err = json.Unmarshal(data, &a)
+	if err != nil {
+		return nil, microerror.Maskf(invalidReleaseArchiveError, "%s", err)
+	}
+
+	if a.Version != releaseArchiveVersion {
+		return nil, microerror.Maskf(invalidReleaseArchiveError, "unsupported archive version %#q", a.Version)
+	}
+	if a.Name == "" || len(a.Revisions) == 0 {
+		return nil, microerror.Maskf(invalidReleaseArchiveError, "archive must contain a release name and revisions")
+	}
+	for _, rel := range a.Revisions {
+		if rel == nil || rel.Info == nil || rel.Name != a.Name {
+			return nil, microerror.Maskf(invalidReleaseArchiveError, "archive contains invalid revisions of release %#q", a.Name)
+		}
+	}
+
+	return &a, nil
+}
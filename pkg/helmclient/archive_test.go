@@ -0,0 +1,379 @@
+package helmclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/trace/noop"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func Test_Client_exportRelease(t *testing.T) {
+	testCases := []struct {
+		name              string
+		history           []*release.Release
+		expectedRevisions []int
+		errorMatcher      func(error) bool
+	}{
+		{
+			name: "case 0: revisions are exported in order",
+			history: []*release.Release{
+				newArchiveTestRelease(2, release.StatusDeployed, ""),
+				newArchiveTestRelease(1, release.StatusSuperseded, ""),
+			},
+			expectedRevisions: []int{1, 2},
+		},
+		{
+			name:         "case 1: release not found",
+			errorMatcher: IsReleaseNotFound,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			k8sClient := fake.NewSimpleClientset()
+			c := &Client{
+				k8sClient: k8sClient,
+			}
+
+			store := storage.Init(driver.NewSecrets(k8sClient.CoreV1().Secrets("default")))
+			for _, rel := range tc.history {
+				err := store.Create(rel)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			archive, err := c.exportRelease(context.Background(), "default", "foo")
+
+			switch {
+			case err == nil && tc.errorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			a, err := decodeReleaseArchive(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a.Name != "foo" || a.Namespace != "default" {
+				t.Fatalf("expected archive of release %#q in namespace %#q got %#q in %#q", "foo", "default", a.Name, a.Namespace)
+			}
+
+			var revisions []int
+			for _, rel := range a.Revisions {
+				revisions = append(revisions, rel.Version)
+			}
+			if diff := cmp.Diff(tc.expectedRevisions, revisions); diff != "" {
+				t.Fatalf("want matching revisions \n %s", diff)
+			}
+		})
+	}
+}
+
+func Test_Client_importReleaseArchive(t *testing.T) {
+	manifest := `---
+# Source: foo/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: old
+`
+
+	testCases := []struct {
+		name                 string
+		existing             []*release.Release
+		options              ImportOptions
+		expectedManifest     string
+		expectedHookManifest string
+		errorMatcher         func(error) bool
+	}{
+		{
+			name:                 "case 0: revisions are imported unchanged",
+			options:              ImportOptions{Namespace: "target"},
+			expectedManifest:     manifest,
+			expectedHookManifest: manifest,
+		},
+		{
+			name: "case 1: namespaces of manifests and hooks are mapped",
+			options: ImportOptions{
+				Namespace:        "target",
+				NamespaceMapping: map[string]string{"old": "new"},
+			},
+			expectedManifest:     strings.Replace(manifest, "namespace: old", "namespace: new", 1),
+			expectedHookManifest: strings.Replace(manifest, "namespace: old", "namespace: new", 1),
+		},
+		{
+			name: "case 2: release already exists",
+			existing: []*release.Release{
+				newArchiveTestRelease(1, release.StatusDeployed, ""),
+			},
+			options:      ImportOptions{Namespace: "target"},
+			errorMatcher: IsReleaseAlreadyExists,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			k8sClient := fake.NewSimpleClientset()
+			c := &Client{
+				k8sClient:     k8sClient,
+				logger:        microloggertest.New(),
+				releaseLocker: newReleaseLocker(),
+				tracer:        noop.NewTracerProvider().Tracer("test"),
+			}
+
+			store := storage.Init(driver.NewSecrets(k8sClient.CoreV1().Secrets("target")))
+			for _, rel := range tc.existing {
+				rel.Namespace = "target"
+				err := store.Create(rel)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			a := &releaseArchive{
+				Version:   releaseArchiveVersion,
+				Name:      "foo",
+				Namespace: "default",
+				Revisions: []*release.Release{
+					newArchiveTestRelease(1, release.StatusSuperseded, manifest),
+					newArchiveTestRelease(2, release.StatusDeployed, manifest),
+				},
+			}
+
+			err := c.importReleaseArchive(context.Background(), nil, a, tc.options)
+
+			switch {
+			case err == nil && tc.errorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			history, err := store.History("foo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(history) != 2 {
+				t.Fatalf("expected 2 imported revisions got %d", len(history))
+			}
+			for _, rel := range history {
+				if rel.Namespace != "target" {
+					t.Fatalf("expected namespace %#q got %#q", "target", rel.Namespace)
+				}
+				if diff := cmp.Diff(tc.expectedManifest, rel.Manifest); diff != "" {
+					t.Fatalf("want matching manifest \n %s", diff)
+				}
+				if diff := cmp.Diff(tc.expectedHookManifest, rel.Hooks[0].Manifest); diff != "" {
+					t.Fatalf("want matching hook manifest \n %s", diff)
+				}
+			}
+		})
+	}
+}
+
+func Test_decodeReleaseArchive(t *testing.T) {
+	testCases := []struct {
+		name        string
+		archive     interface{}
+		expectedErr func(error) bool
+	}{
+		{
+			name: "case 0: valid archive",
+			archive: releaseArchive{
+				Version:   releaseArchiveVersion,
+				Name:      "foo",
+				Namespace: "default",
+				Revisions: []*release.Release{
+					{Name: "foo", Version: 1, Info: &release.Info{Status: release.StatusSuperseded}},
+					{Name: "foo", Version: 2, Info: &release.Info{Status: release.StatusDeployed}},
+				},
+			},
+		},
+		{
+			name: "case 1: unsupported version",
+			archive: releaseArchive{
+				Version: "v0",
+				Name:    "foo",
+				Revisions: []*release.Release{
+					{Name: "foo", Version: 1, Info: &release.Info{Status: release.StatusDeployed}},
+				},
+			},
+			expectedErr: IsInvalidReleaseArchive,
+		},
+		{
+			name: "case 2: revision of another release",
+			archive: releaseArchive{
+				Version: releaseArchiveVersion,
+				Name:    "foo",
+				Revisions: []*release.Release{
+					{Name: "bar", Version: 1, Info: &release.Info{Status: release.StatusDeployed}},
+				},
+			},
+			expectedErr: IsInvalidReleaseArchive,
+		},
+		{
+			name:        "case 3: not an archive",
+			archive:     nil,
+			expectedErr: IsInvalidReleaseArchive,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			var archive []byte
+			if tc.archive != nil {
+				data, err := json.Marshal(tc.archive)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var buf bytes.Buffer
+				w := gzip.NewWriter(&buf)
+				_, _ = w.Write(data)
+				_ = w.Close()
+
+				archive = buf.Bytes()
+			}
+
+			_, err := decodeReleaseArchive(archive)
+			switch {
+			case err == nil && tc.expectedErr == nil:
+				// correct; carry on
+			case err != nil && tc.expectedErr == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.expectedErr != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.expectedErr(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+		})
+	}
+}
+
+func Test_Client_createRevisions(t *testing.T) {
+	testCases := []struct {
+		name            string
+		failingRevision int
+		expectedErr     bool
+		expectedSecrets int
+	}{
+		{
+			name:            "case 0: all revisions are created",
+			expectedSecrets: 3,
+		},
+		{
+			name:            "case 1: created revisions are deleted when the first revision fails",
+			failingRevision: 1,
+			expectedErr:     true,
+		},
+		{
+			name:            "case 2: created revisions are deleted when a later revision fails",
+			failingRevision: 3,
+			expectedErr:     true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			k8sClient := fake.NewSimpleClientset()
+			k8sClient.PrependReactor("create", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				secret := action.(clienttesting.CreateAction).GetObject().(*corev1.Secret)
+				if tc.failingRevision > 0 && secret.Labels["version"] == strconv.Itoa(tc.failingRevision) {
+					return true, nil, errors.New("storage unavailable")
+				}
+				return false, nil, nil
+			})
+
+			c := &Client{
+				logger: microloggertest.New(),
+			}
+
+			var revisions []*release.Release
+			for v := 1; v <= 3; v++ {
+				revisions = append(revisions, &release.Release{
+					Name:      "foo",
+					Namespace: "default",
+					Version:   v,
+					Info:      &release.Info{Status: release.StatusSuperseded},
+				})
+			}
+
+			releases := storage.Init(driver.NewSecrets(k8sClient.CoreV1().Secrets("default")))
+			err := c.createRevisions(context.Background(), releases, revisions)
+			if err != nil && !tc.expectedErr {
+				t.Fatalf("error == %#v, want nil", err)
+			} else if err == nil && tc.expectedErr {
+				t.Fatalf("error == nil, want non-nil")
+			}
+
+			secrets, err := k8sClient.CoreV1().Secrets("default").List(context.Background(), metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(secrets.Items) != tc.expectedSecrets {
+				t.Fatalf("expected %d stored revisions got %d", tc.expectedSecrets, len(secrets.Items))
+			}
+		})
+	}
+}
+
+func newArchiveTestRelease(version int, status release.Status, manifest string) *release.Release {
+	return &release.Release{
+		Name:      "foo",
+		Namespace: "default",
+		Version:   version,
+		Info:      &release.Info{Status: status},
+		Manifest:  manifest,
+		Hooks: []*release.Hook{
+			{
+				Name:     "config",
+				Kind:     "ConfigMap",
+				Manifest: manifest,
+				Events:   []release.HookEvent{release.HookPreInstall},
+			},
+		},
+	}
+}
@@ -0,0 +1,224 @@
+package helmclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// Operations of audit records.
+const (
+	AuditOperationDelete   = "delete"
+	AuditOperationImport   = "import"
+	AuditOperationInstall  = "install"
+	AuditOperationMigrate  = "migrate"
+	AuditOperationRecover  = "recover"
+	AuditOperationRollback = "rollback"
+	AuditOperationUpgrade  = "upgrade"
+)
+
+// Outcomes of audit records.
+const (
+	AuditOutcomeFailure = "failure"
+	AuditOutcomeSuccess = "success"
+)
+
+// AuditSink receives an AuditRecord for every mutating operation on a
+// release. Operations failing before they acquired the release lock, e.g.
+// because of an invalid configuration, did not touch the release and are not
+// recorded. Errors returned by the sink are logged and do not fail the
+// operation.
+type AuditSink interface {
+	Write(ctx context.Context, record AuditRecord) error
+}
+
+// AuditRecord describes a single mutating operation on a release.
+type AuditRecord struct {
+	// Actor identifies the client which executed the operation. See
+	// Config.AuditActor.
+	Actor        string `json:"actor,omitempty"`
+	ChartName    string `json:"chartName,omitempty"`
+	ChartVersion string `json:"chartVersion,omitempty"`
+	// Duration is the time the operation took.
+	Duration time.Duration `json:"duration"`
+	// ErrorClass is the kind of the error the operation failed with, e.g.
+	// releaseNotFoundError. It is empty if the operation succeeded.
+	ErrorClass string `json:"errorClass,omitempty"`
+	Namespace  string `json:"namespace"`
+	// Operation is one of the AuditOperation constants.
+	Operation string `json:"operation"`
+	// Outcome is either AuditOutcomeSuccess or AuditOutcomeFailure.
+	Outcome string `json:"outcome"`
+	// PreviousRevision is the latest revision of the release before the
+	// operation or 0 if the release did not exist.
+	PreviousRevision int    `json:"previousRevision,omitempty"`
+	ReleaseName      string `json:"releaseName"`
+	// Revision is the latest revision of the release after the operation or
+	// 0 if the release does not exist anymore.
+	Revision int       `json:"revision,omitempty"`
+	Time     time.Time `json:"time"`
+	// ValuesDigest is the SHA-256 digest of the values of the operation or,
+	// for operations without values, of the user supplied values of the
+	// latest revision. The values themselves are never recorded as they may
+	// contain secrets.
+	ValuesDigest string `json:"valuesDigest,omitempty"`
+}
+
+// auditTrail collects the audit record of a single operation.
+type auditTrail struct {
+	client  *Client
+	record  AuditRecord
+	started bool
+	values  map[string]interface{}
+}
+
+// newAudit prepares auditing a mutating operation on the given release. The
+// returned trail must be started once the operation holds the release lock
+// and finished once the operation returned. Nothing is recorded if no audit
+// sink is configured or the trail was never started, e.g. because the
+// operation failed before it could acquire the release lock.
+func (c *Client) newAudit(operation, namespace, releaseName string, values map[string]interface{}) *auditTrail {
+	if c.auditSink == nil {
+		return nil
+	}
+
+	return &auditTrail{
+		client: c,
+		record: AuditRecord{
+			Actor:       c.auditActor,
+			Namespace:   namespace,
+			Operation:   operation,
+			ReleaseName: releaseName,
+		},
+		values: values,
+	}
+}
+
+// start records the start of the operation and the previous revision of the
+// release. Starting under the release lock keeps the time spent waiting for
+// the lock out of the duration and ensures no other operation of this client
+// changes the release between reading the previous revision and executing
+// the operation.
+func (a *auditTrail) start(ctx context.Context) {
+	if a == nil {
+		return
+	}
+
+	c := a.client
+
+	a.record.Time = time.Now()
+	a.started = true
+
+	previous, err := c.lastRevision(a.record.Namespace, a.record.ReleaseName)
+	if err != nil {
+		c.logger.LogCtx(ctx, "level", "warning", "message", fmt.Sprintf("failed to get previous revision of release %#q for audit record", a.record.ReleaseName), "stack", fmt.Sprintf("%#v", err))
+	} else if previous != nil {
+		a.record.PreviousRevision = previous.Version
+		a.setRelease(previous)
+	}
+}
+
+// finish completes the audit record with the outcome of the operation and
+// writes it to the audit sink.
+func (a *auditTrail) finish(ctx context.Context, err error) {
+	if a == nil || !a.started {
+		return
+	}
+
+	c := a.client
+
+	a.record.Duration = time.Since(a.record.Time)
+	a.record.Outcome = AuditOutcomeSuccess
+	if err != nil {
+		a.record.ErrorClass = errorClass(err)
+		a.record.Outcome = AuditOutcomeFailure
+	}
+
+	latest, lastErr := c.lastRevision(a.record.Namespace, a.record.ReleaseName)
+	if lastErr != nil {
+		c.logger.LogCtx(ctx, "level", "warning", "message", fmt.Sprintf("failed to get latest revision of release %#q for audit record", a.record.ReleaseName), "stack", fmt.Sprintf("%#v", lastErr))
+	} else if latest != nil {
+		a.record.Revision = latest.Version
+		a.setRelease(latest)
+	}
+
+	if a.values != nil {
+		a.record.ValuesDigest = valuesDigest(a.values)
+	}
+
+	writeErr := c.auditSink.Write(ctx, a.record)
+	if writeErr != nil {
+		c.logger.LogCtx(ctx, "level", "warning", "message", fmt.Sprintf("failed to write audit record of release %#q", a.record.ReleaseName), "stack", fmt.Sprintf("%#v", writeErr))
+	}
+}
+
+// setRelease sets the chart and values digest of the record from the given
+// revision.
+func (a *auditTrail) setRelease(rel *release.Release) {
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		a.record.ChartName = rel.Chart.Metadata.Name
+		a.record.ChartVersion = rel.Chart.Metadata.Version
+	}
+
+	a.record.ValuesDigest = valuesDigest(rel.Config)
+}
+
+// lastRevision returns the latest revision of the given release or nil if it
+// does not exist.
+func (c *Client) lastRevision(namespace, releaseName string) (*release.Release, error) {
+	store := storage.Init(driver.NewSecrets(c.k8sClient.CoreV1().Secrets(namespace)))
+
+	rel, err := store.Last(releaseName)
+	if IsReleaseNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return rel, nil
+}
+
+// valuesDigest returns the SHA-256 digest of the JSON encoding of the given
+// values. JSON encoding sorts map keys so equal values have equal digests.
+func valuesDigest(values map[string]interface{}) string {
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+
+	b, err := json.Marshal(values)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(b)
+
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// errorClass returns the kind of the given error.
+func errorClass(err error) string {
+	var hookFailedError *HookFailedError
+	if errors.As(err, &hookFailedError) {
+		return "HookFailedError"
+	}
+	var applyConflictError *ApplyConflictError
+	if errors.As(err, &applyConflictError) {
+		return "ApplyConflictError"
+	}
+
+	var microErr *microerror.Error
+	if errors.As(err, &microErr) {
+		return microErr.Kind
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,139 @@
+package helmclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/giantswarm/microerror"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// auditConfigMapKey is the key of the ConfigMap data holding the
+	// records as JSON lines.
+	auditConfigMapKey = "records"
+	// defaultAuditConfigMapSize is the default number of records kept in
+	// the ConfigMap. ConfigMaps are limited to 1MiB.
+	defaultAuditConfigMapSize = 100
+)
+
+type ConfigMapAuditSinkConfig struct {
+	K8sClient kubernetes.Interface
+
+	// Name is the name of the ConfigMap.
+	Name string
+	// Namespace is the namespace of the ConfigMap.
+	Namespace string
+	// Size is the maximum number of records kept in the ConfigMap. Once it
+	// is reached the oldest records are dropped. Defaults to 100.
+	Size int
+}
+
+// ConfigMapAuditSink is an AuditSink keeping the most recent records in a
+// ConfigMap. The ConfigMap is created if it does not exist.
+type ConfigMapAuditSink struct {
+	k8sClient kubernetes.Interface
+
+	name      string
+	namespace string
+	size      int
+}
+
+func NewConfigMapAuditSink(config ConfigMapAuditSinkConfig) (*ConfigMapAuditSink, error) {
+	if config.K8sClient == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.K8sClient must not be empty", config)
+	}
+	if config.Name == "" {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Name must not be empty", config)
+	}
+	if config.Namespace == "" {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Namespace must not be empty", config)
+	}
+	if config.Size == 0 {
+		config.Size = defaultAuditConfigMapSize
+	}
+	if config.Size < 0 {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Size must not be negative", config)
+	}
+
+	s := &ConfigMapAuditSink{
+		k8sClient: config.K8sClient,
+
+		name:      config.Name,
+		namespace: config.Namespace,
+		size:      config.Size,
+	}
+
+	return s, nil
+}
+
+func (s *ConfigMapAuditSink) Write(ctx context.Context, record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	configMaps := s.k8sClient.CoreV1().ConfigMaps(s.namespace)
+
+	// Other writers may update the ConfigMap concurrently. Updates are
+	// rejected on conflicts so the record is appended to the latest records
+	// again.
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := configMaps.Get(ctx, s.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			configMap = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      s.name,
+					Namespace: s.namespace,
+				},
+				Data: map[string]string{
+					auditConfigMapKey: appendAuditRecord("", line, s.size),
+				},
+			}
+
+			_, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// Turn into a conflict so that the record is appended
+				// to the ConfigMap created in the meantime.
+				return apierrors.NewConflict(corev1.Resource("configmaps"), s.name, err)
+			}
+			return err
+		} else if err != nil {
+			return err
+		}
+
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		configMap.Data[auditConfigMapKey] = appendAuditRecord(configMap.Data[auditConfigMapKey], line, s.size)
+
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// appendAuditRecord appends the line to the given JSON lines and drops the
+// oldest lines exceeding size.
+func appendAuditRecord(records string, line []byte, size int) string {
+	lines := bytes.Split(bytes.TrimSpace([]byte(records)), []byte("\n"))
+	if len(lines) == 1 && len(lines[0]) == 0 {
+		lines = nil
+	}
+
+	lines = append(lines, line)
+	if len(lines) > size {
+		lines = lines[len(lines)-size:]
+	}
+
+	return string(bytes.Join(lines, []byte("\n"))) + "\n"
+}
@@ -0,0 +1,73 @@
+package helmclient
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/giantswarm/microerror"
+	"github.com/spf13/afero"
+)
+
+type FileAuditSinkConfig struct {
+	// Fs is the file system the audit log is written to. Defaults to the
+	// OS file system.
+	Fs afero.Fs
+	// Path is the path of the audit log file. Records are appended to it as
+	// JSON lines.
+	Path string
+}
+
+// FileAuditSink is an AuditSink appending records as JSON lines to a file.
+type FileAuditSink struct {
+	fs   afero.Fs
+	path string
+
+	mutex sync.Mutex
+}
+
+func NewFileAuditSink(config FileAuditSinkConfig) (*FileAuditSink, error) {
+	if config.Fs == nil {
+		config.Fs = afero.NewOsFs()
+	}
+	if config.Path == "" {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Path must not be empty", config)
+	}
+
+	s := &FileAuditSink{
+		fs:   config.Fs,
+		path: config.Path,
+	}
+
+	return s, nil
+}
+
+func (s *FileAuditSink) Write(ctx context.Context, record AuditRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	b = append(b, '\n')
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	f, err := s.fs.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	_, err = f.Write(b)
+	if err != nil {
+		_ = f.Close()
+		return microerror.Mask(err)
+	}
+
+	err = f.Close()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
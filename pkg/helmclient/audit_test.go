@@ -0,0 +1,372 @@
+package helmclient
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/spf13/afero"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_errorClass(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{
+			name:     "case 0: microerror kind",
+			err:      microerror.Maskf(releaseNotFoundError, "release %#q not found", "test"),
+			expected: "releaseNotFoundError",
+		},
+		{
+			name:     "case 1: hook failed",
+			err:      microerror.Mask(&HookFailedError{err: microerror.Mask(executionFailedError)}),
+			expected: "HookFailedError",
+		},
+		{
+			name:     "case 2: unknown error",
+			err:      context.DeadlineExceeded,
+			expected: "unknown",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			class := errorClass(tc.err)
+			if class != tc.expected {
+				t.Fatalf("expected %#q got %#q", tc.expected, class)
+			}
+		})
+	}
+}
+
+func Test_valuesDigest(t *testing.T) {
+	a := valuesDigest(map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": true}})
+	b := valuesDigest(map[string]interface{}{"b": map[string]interface{}{"c": true}, "a": 1})
+	if a != b {
+		t.Fatalf("expected equal digests got %#q and %#q", a, b)
+	}
+	if !strings.HasPrefix(a, "sha256:") {
+		t.Fatalf("expected sha256 digest got %#q", a)
+	}
+}
+
+func Test_auditTrail(t *testing.T) {
+	testCases := []struct {
+		name           string
+		before         []*release.Release
+		after          []*release.Release
+		values         map[string]interface{}
+		start          bool
+		err            error
+		expectedRecord *AuditRecord
+	}{
+		{
+			name:  "case 0: install",
+			after: []*release.Release{newAuditTestRelease(1, "1.0.0")},
+			start: true,
+			expectedRecord: &AuditRecord{
+				ChartName:    "foo",
+				ChartVersion: "1.0.0",
+				Outcome:      AuditOutcomeSuccess,
+				Revision:     1,
+			},
+		},
+		{
+			name:   "case 1: failed upgrade",
+			before: []*release.Release{newAuditTestRelease(1, "1.0.0")},
+			after:  []*release.Release{newAuditTestRelease(2, "2.0.0")},
+			start:  true,
+			err:    microerror.Maskf(releaseNotFoundError, "release %#q not found", "foo"),
+			expectedRecord: &AuditRecord{
+				ChartName:        "foo",
+				ChartVersion:     "2.0.0",
+				ErrorClass:       "releaseNotFoundError",
+				Outcome:          AuditOutcomeFailure,
+				PreviousRevision: 1,
+				Revision:         2,
+			},
+		},
+		{
+			name:   "case 2: delete",
+			before: []*release.Release{newAuditTestRelease(1, "1.0.0")},
+			start:  true,
+			expectedRecord: &AuditRecord{
+				ChartName:        "foo",
+				ChartVersion:     "1.0.0",
+				Outcome:          AuditOutcomeSuccess,
+				PreviousRevision: 1,
+			},
+		},
+		{
+			name:   "case 3: values of the operation are digested",
+			after:  []*release.Release{newAuditTestRelease(1, "1.0.0")},
+			values: map[string]interface{}{"replicas": 2},
+			start:  true,
+			expectedRecord: &AuditRecord{
+				ChartName:    "foo",
+				ChartVersion: "1.0.0",
+				Outcome:      AuditOutcomeSuccess,
+				Revision:     1,
+				ValuesDigest: valuesDigest(map[string]interface{}{"replicas": 2}),
+			},
+		},
+		{
+			name:           "case 4: not started because locking failed",
+			before:         []*release.Release{newAuditTestRelease(1, "1.0.0")},
+			err:            microerror.Maskf(releaseLockedError, "release %#q is locked", "foo"),
+			expectedRecord: nil,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			k8sClient := fake.NewSimpleClientset()
+			sink := &auditTestSink{}
+			c := &Client{
+				auditActor: "operator",
+				auditSink:  sink,
+				k8sClient:  k8sClient,
+				logger:     microloggertest.New(),
+			}
+
+			store := storage.Init(driver.NewSecrets(k8sClient.CoreV1().Secrets("default")))
+			for _, rel := range tc.before {
+				err := store.Create(rel)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			audit := c.newAudit(AuditOperationUpgrade, "default", "foo", tc.values)
+			if tc.start {
+				audit.start(context.Background())
+			}
+
+			// The operation replaces the release by the revisions after it.
+			for _, rel := range tc.before {
+				_, err := store.Delete(rel.Name, rel.Version)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, rel := range tc.after {
+				err := store.Create(rel)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			audit.finish(context.Background(), tc.err)
+
+			var record *AuditRecord
+			if len(sink.records) > 1 {
+				t.Fatalf("expected at most one record got %d", len(sink.records))
+			} else if len(sink.records) == 1 {
+				record = &sink.records[0]
+				if record.Time.IsZero() || record.Duration < 0 {
+					t.Fatalf("expected start time and duration got %v and %v", record.Time, record.Duration)
+				}
+			}
+
+			var expectedRecord *AuditRecord
+			if tc.expectedRecord != nil {
+				r := *tc.expectedRecord
+				r.Actor = "operator"
+				r.Namespace = "default"
+				r.Operation = AuditOperationUpgrade
+				r.ReleaseName = "foo"
+				if r.ValuesDigest == "" {
+					r.ValuesDigest = valuesDigest(nil)
+				}
+				expectedRecord = &r
+			}
+
+			opt := cmpopts.IgnoreFields(AuditRecord{}, "Duration", "Time")
+			if diff := cmp.Diff(expectedRecord, record, opt); diff != "" {
+				t.Fatalf("want matching audit record \n %s", diff)
+			}
+		})
+	}
+}
+
+func Test_auditTrail_noSink(t *testing.T) {
+	c := &Client{}
+
+	// Without audit sink nothing is recorded and the nil trail must be
+	// usable.
+	audit := c.newAudit(AuditOperationDelete, "default", "foo", nil)
+	if audit != nil {
+		t.Fatalf("expected nil audit trail got %#v", audit)
+	}
+	audit.start(context.Background())
+	audit.finish(context.Background(), nil)
+}
+
+func Test_Client_lastRevision(t *testing.T) {
+	testCases := []struct {
+		name             string
+		history          []*release.Release
+		expectedRevision int
+	}{
+		{
+			name:             "case 0: release not found",
+			history:          nil,
+			expectedRevision: 0,
+		},
+		{
+			name: "case 1: latest revision",
+			history: []*release.Release{
+				newAuditTestRelease(1, "1.0.0"),
+				newAuditTestRelease(3, "3.0.0"),
+				newAuditTestRelease(2, "2.0.0"),
+			},
+			expectedRevision: 3,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			k8sClient := fake.NewSimpleClientset()
+			c := &Client{
+				k8sClient: k8sClient,
+			}
+
+			store := storage.Init(driver.NewSecrets(k8sClient.CoreV1().Secrets("default")))
+			for _, rel := range tc.history {
+				err := store.Create(rel)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			rel, err := c.lastRevision("default", "foo")
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			var revision int
+			if rel != nil {
+				revision = rel.Version
+			}
+			if revision != tc.expectedRevision {
+				t.Fatalf("expected revision %d got %d", tc.expectedRevision, revision)
+			}
+		})
+	}
+}
+
+func Test_FileAuditSink(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	sink, err := NewFileAuditSink(FileAuditSinkConfig{Fs: fs, Path: "/audit.log"})
+	if err != nil {
+		t.Fatalf("expected nil error got %#v", err)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		err = sink.Write(context.Background(), AuditRecord{Operation: AuditOperationInstall, ReleaseName: name})
+		if err != nil {
+			t.Fatalf("expected nil error got %#v", err)
+		}
+	}
+
+	b, err := afero.ReadFile(fs, "/audit.log")
+	if err != nil {
+		t.Fatalf("expected nil error got %#v", err)
+	}
+
+	names := decodeAuditRecordNames(t, string(b))
+	if strings.Join(names, ",") != "a,b" {
+		t.Fatalf("expected records a,b got %v", names)
+	}
+}
+
+func Test_ConfigMapAuditSink(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+
+	sink, err := NewConfigMapAuditSink(ConfigMapAuditSinkConfig{
+		K8sClient: k8sClient,
+		Name:      "helmclient-audit",
+		Namespace: "giantswarm",
+		Size:      2,
+	})
+	if err != nil {
+		t.Fatalf("expected nil error got %#v", err)
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		err = sink.Write(context.Background(), AuditRecord{Operation: AuditOperationUpgrade, ReleaseName: name})
+		if err != nil {
+			t.Fatalf("expected nil error got %#v", err)
+		}
+	}
+
+	configMap, err := k8sClient.CoreV1().ConfigMaps("giantswarm").Get(context.Background(), "helmclient-audit", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected nil error got %#v", err)
+	}
+
+	names := decodeAuditRecordNames(t, configMap.Data[auditConfigMapKey])
+	if strings.Join(names, ",") != "b,c" {
+		t.Fatalf("expected records b,c got %v", names)
+	}
+}
+
+func decodeAuditRecordNames(t *testing.T, lines string) []string {
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(lines), "\n") {
+		var record AuditRecord
+		err := json.Unmarshal([]byte(line), &record)
+		if err != nil {
+			t.Fatalf("expected nil error got %#v", err)
+		}
+		names = append(names, record.ReleaseName)
+	}
+
+	return names
+}
+
+// auditTestSink keeps the written records in memory.
+type auditTestSink struct {
+	records []AuditRecord
+}
+
+func (s *auditTestSink) Write(ctx context.Context, record AuditRecord) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+func newAuditTestRelease(version int, chartVersion string) *release.Release {
+	return &release.Release{
+		Name:      "foo",
+		Namespace: "default",
+		Version:   version,
+		Info:      &release.Info{Status: release.StatusDeployed},
+		Chart: &chart.Chart{
+			Metadata: &chart.Metadata{
+				Name:    "foo",
+				Version: chartVersion,
+			},
+		},
+	}
+}
@@ -0,0 +1,220 @@
+package helmclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/giantswarm/microerror"
+)
+
+// RunBatch executes the given install, upgrade and delete operations using a
+// bounded pool of workers. Operations only start once all the operations
+// they depend on succeeded. A failing operation does not stop the batch.
+// Operations depending on it are skipped and reported with a
+// batchDependencyFailedError instead. The returned map contains one result
+// per operation keyed by namespace/releaseName. An error is only returned if
+// the batch itself is invalid, e.g. because of unknown or cyclic
+// dependencies.
+func (c *Client) RunBatch(ctx context.Context, operations []BatchOperation, options BatchOptions) (map[string]BatchResult, error) {
+	eventName := "run_batch"
+
+	ctx, span := c.tracer.Start(ctx, eventName)
+	defer span.End()
+
+	m := c.metrics.observe(eventName, "")
+	defer m.stop()
+
+	results, err := c.runBatch(ctx, operations, options)
+	if err != nil {
+		m.fail()
+		recordSpanError(span, err)
+		return nil, microerror.Mask(err)
+	}
+
+	return results, nil
+}
+
+func (c *Client) runBatch(ctx context.Context, operations []BatchOperation, options BatchOptions) (map[string]BatchResult, error) {
+	if options.Workers <= 0 {
+		options.Workers = defaultBatchWorkers
+	}
+
+	err := validateBatch(operations)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return scheduleBatch(ctx, operations, options.Workers, c.executeBatchOperation), nil
+}
+
+// scheduleBatch executes the given valid operations using execute once their
+// dependencies succeeded. At most workers operations are executed
+// concurrently.
+func scheduleBatch(ctx context.Context, operations []BatchOperation, workers int, execute func(ctx context.Context, op BatchOperation) error) map[string]BatchResult {
+	var mutex sync.Mutex
+	results := map[string]BatchResult{}
+
+	done := map[string]chan struct{}{}
+	for _, op := range operations {
+		done[op.Key()] = make(chan struct{})
+	}
+
+	// Every operation gets its own goroutine which waits for its
+	// dependencies. Only the execution itself is limited by the worker
+	// semaphore so that waiting operations do not block workers.
+	semaphore := make(chan struct{}, workers)
+
+	var wg sync.WaitGroup
+	for _, op := range operations {
+		wg.Add(1)
+
+		go func(op BatchOperation) {
+			defer wg.Done()
+			defer close(done[op.Key()])
+
+			result := runBatchOperation(ctx, op, execute, semaphore, done, results, &mutex)
+
+			mutex.Lock()
+			results[op.Key()] = result
+			mutex.Unlock()
+		}(op)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+func runBatchOperation(ctx context.Context, op BatchOperation, execute func(ctx context.Context, op BatchOperation) error, workers chan struct{}, done map[string]chan struct{}, results map[string]BatchResult, mutex *sync.Mutex) BatchResult {
+	for _, dep := range op.DependsOn {
+		select {
+		case <-done[dep]:
+		case <-ctx.Done():
+			return BatchResult{Error: microerror.Mask(ctx.Err())}
+		}
+
+		mutex.Lock()
+		depResult := results[dep]
+		mutex.Unlock()
+
+		if depResult.Error != nil {
+			return BatchResult{
+				Error:   microerror.Maskf(batchDependencyFailedError, "dependency %#q of %#q failed", dep, op.Key()),
+				Skipped: true,
+			}
+		}
+	}
+
+	select {
+	case workers <- struct{}{}:
+	case <-ctx.Done():
+		return BatchResult{Error: microerror.Mask(ctx.Err())}
+	}
+	defer func() { <-workers }()
+
+	start := time.Now()
+
+	err := execute(ctx, op)
+
+	return BatchResult{
+		Duration: time.Since(start),
+		Error:    err,
+	}
+}
+
+// executeBatchOperation executes a single operation of a batch.
+func (c *Client) executeBatchOperation(ctx context.Context, op BatchOperation) error {
+	var err error
+	switch op.Type {
+	case BatchOperationInstall:
+		options := op.InstallOptions
+		options.ReleaseName = op.ReleaseName
+		err = c.InstallReleaseFromTarball(ctx, op.ChartPath, op.Namespace, op.Values, options)
+	case BatchOperationUpgrade:
+		err = c.UpdateReleaseFromTarball(ctx, op.ChartPath, op.Namespace, op.ReleaseName, op.Values, op.UpdateOptions)
+	case BatchOperationDelete:
+		_, err = c.DeleteRelease(ctx, op.Namespace, op.ReleaseName, op.DeleteOptions)
+	}
+
+	return err
+}
+
+// validateBatch ensures operation types are known, install options name the
+// release of the operation, every release is only operated on once and all
+// dependencies exist and are free of cycles.
+func validateBatch(operations []BatchOperation) error {
+	byKey := map[string]BatchOperation{}
+
+	for _, op := range operations {
+		switch op.Type {
+		case BatchOperationInstall, BatchOperationUpgrade, BatchOperationDelete:
+		default:
+			return microerror.Maskf(invalidConfigError, "unknown batch operation type %#q for %#q", op.Type, op.Key())
+		}
+		if op.Namespace == "" || op.ReleaseName == "" {
+			return microerror.Maskf(invalidConfigError, "batch operation namespace and release name must not be empty")
+		}
+		if op.Type == BatchOperationInstall && op.InstallOptions.ReleaseName != "" && op.InstallOptions.ReleaseName != op.ReleaseName {
+			return microerror.Maskf(invalidConfigError, "install options release name %#q of %#q must match the operation release name", op.InstallOptions.ReleaseName, op.Key())
+		}
+		if _, ok := byKey[op.Key()]; ok {
+			return microerror.Maskf(invalidConfigError, "duplicate batch operation for %#q", op.Key())
+		}
+
+		byKey[op.Key()] = op
+	}
+
+	for _, op := range operations {
+		for _, dep := range op.DependsOn {
+			if _, ok := byKey[dep]; !ok {
+				return microerror.Maskf(invalidConfigError, "unknown dependency %#q of %#q", dep, op.Key())
+			}
+		}
+	}
+
+	// Detect cycles using a depth first search. Operations in a cycle would
+	// wait for each other forever.
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+
+	var visit func(key string, path []string) error
+	visit = func(key string, path []string) error {
+		switch state[key] {
+		case visiting:
+			return microerror.Maskf(invalidConfigError, "cyclic batch dependencies %v", append(path, key))
+		case visited:
+			return nil
+		}
+
+		state[key] = visiting
+		for _, dep := range byKey[key].DependsOn {
+			err := visit(dep, append(path, key))
+			if err != nil {
+				return microerror.Mask(err)
+			}
+		}
+		state[key] = visited
+
+		return nil
+	}
+
+	for _, op := range operations {
+		err := visit(op.Key(), nil)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	return nil
+}
+
+// Key returns the key identifying the operation in batch results and
+// dependencies.
+func (op BatchOperation) Key() string {
+	return fmt.Sprintf("%s/%s", op.Namespace, op.ReleaseName)
+}
@@ -0,0 +1,216 @@
+package helmclient
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_validateBatch(t *testing.T) {
+	testCases := []struct {
+		name         string
+		operations   []BatchOperation
+		errorMatcher func(error) bool
+	}{
+		{
+			name: "case 0: independent operations",
+			operations: []BatchOperation{
+				{Type: BatchOperationInstall, Namespace: "default", ReleaseName: "foo"},
+				{Type: BatchOperationDelete, Namespace: "default", ReleaseName: "bar"},
+			},
+		},
+		{
+			name: "case 1: valid dependency chain",
+			operations: []BatchOperation{
+				{Type: BatchOperationInstall, Namespace: "default", ReleaseName: "foo"},
+				{Type: BatchOperationUpgrade, Namespace: "default", ReleaseName: "bar", DependsOn: []string{"default/foo"}},
+				{Type: BatchOperationUpgrade, Namespace: "other", ReleaseName: "baz", DependsOn: []string{"default/foo", "default/bar"}},
+			},
+		},
+		{
+			name: "case 2: unknown operation type",
+			operations: []BatchOperation{
+				{Type: "rollback", Namespace: "default", ReleaseName: "foo"},
+			},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name: "case 3: duplicate release",
+			operations: []BatchOperation{
+				{Type: BatchOperationInstall, Namespace: "default", ReleaseName: "foo"},
+				{Type: BatchOperationDelete, Namespace: "default", ReleaseName: "foo"},
+			},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name: "case 4: unknown dependency",
+			operations: []BatchOperation{
+				{Type: BatchOperationInstall, Namespace: "default", ReleaseName: "foo", DependsOn: []string{"default/bar"}},
+			},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name: "case 5: cyclic dependencies",
+			operations: []BatchOperation{
+				{Type: BatchOperationInstall, Namespace: "default", ReleaseName: "foo", DependsOn: []string{"default/baz"}},
+				{Type: BatchOperationInstall, Namespace: "default", ReleaseName: "bar", DependsOn: []string{"default/foo"}},
+				{Type: BatchOperationInstall, Namespace: "default", ReleaseName: "baz", DependsOn: []string{"default/bar"}},
+			},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name: "case 6: install options naming the release",
+			operations: []BatchOperation{
+				{Type: BatchOperationInstall, Namespace: "default", ReleaseName: "foo", InstallOptions: InstallOptions{ReleaseName: "foo"}},
+			},
+		},
+		{
+			name: "case 7: install options naming another release",
+			operations: []BatchOperation{
+				{Type: BatchOperationInstall, Namespace: "default", ReleaseName: "foo", InstallOptions: InstallOptions{ReleaseName: "bar"}},
+			},
+			errorMatcher: IsInvalidConfig,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			err := validateBatch(tc.operations)
+
+			switch {
+			case err == nil && tc.errorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+		})
+	}
+}
+
+func Test_scheduleBatch(t *testing.T) {
+	testCases := []struct {
+		name               string
+		operations         []BatchOperation
+		workers            int
+		failing            []string
+		expectedFailed     []string
+		expectedSkipped    []string
+		expectedMaxRunning int
+	}{
+		{
+			name: "case 0: dependencies are executed first",
+			operations: []BatchOperation{
+				{Type: BatchOperationUpgrade, Namespace: "default", ReleaseName: "baz", DependsOn: []string{"default/foo", "default/bar"}},
+				{Type: BatchOperationUpgrade, Namespace: "default", ReleaseName: "bar", DependsOn: []string{"default/foo"}},
+				{Type: BatchOperationInstall, Namespace: "default", ReleaseName: "foo"},
+			},
+			workers:            4,
+			expectedMaxRunning: 1,
+		},
+		{
+			name: "case 1: failed dependency skips dependent operations",
+			operations: []BatchOperation{
+				{Type: BatchOperationInstall, Namespace: "default", ReleaseName: "foo"},
+				{Type: BatchOperationUpgrade, Namespace: "default", ReleaseName: "bar", DependsOn: []string{"default/foo"}},
+				{Type: BatchOperationUpgrade, Namespace: "default", ReleaseName: "baz", DependsOn: []string{"default/bar"}},
+				{Type: BatchOperationDelete, Namespace: "default", ReleaseName: "qux"},
+			},
+			workers:            1,
+			failing:            []string{"default/foo"},
+			expectedFailed:     []string{"default/foo"},
+			expectedSkipped:    []string{"default/bar", "default/baz"},
+			expectedMaxRunning: 1,
+		},
+		{
+			name: "case 2: concurrency is limited to the number of workers",
+			operations: []BatchOperation{
+				{Type: BatchOperationInstall, Namespace: "default", ReleaseName: "a"},
+				{Type: BatchOperationInstall, Namespace: "default", ReleaseName: "b"},
+				{Type: BatchOperationInstall, Namespace: "default", ReleaseName: "c"},
+				{Type: BatchOperationInstall, Namespace: "default", ReleaseName: "d"},
+				{Type: BatchOperationInstall, Namespace: "default", ReleaseName: "e"},
+				{Type: BatchOperationInstall, Namespace: "default", ReleaseName: "f"},
+			},
+			workers:            2,
+			expectedMaxRunning: 2,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			var mutex sync.Mutex
+			var running, maxRunning int
+			finished := map[string]bool{}
+
+			execute := func(ctx context.Context, op BatchOperation) error {
+				mutex.Lock()
+				for _, dep := range op.DependsOn {
+					if !finished[dep] {
+						t.Errorf("expected %#q to be executed after %#q", op.Key(), dep)
+					}
+				}
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mutex.Unlock()
+
+				// Give other operations the chance to run concurrently.
+				time.Sleep(20 * time.Millisecond)
+
+				mutex.Lock()
+				running--
+				finished[op.Key()] = true
+				mutex.Unlock()
+
+				for _, key := range tc.failing {
+					if key == op.Key() {
+						return errors.New("operation failed")
+					}
+				}
+
+				return nil
+			}
+
+			results := scheduleBatch(context.Background(), tc.operations, tc.workers, execute)
+
+			if len(results) != len(tc.operations) {
+				t.Fatalf("expected %d results got %d", len(tc.operations), len(results))
+			}
+			for _, op := range tc.operations {
+				result := results[op.Key()]
+
+				switch {
+				case slices.Contains(tc.expectedSkipped, op.Key()):
+					if !result.Skipped || !IsBatchDependencyFailed(result.Error) {
+						t.Fatalf("expected %#q to be skipped got %#v", op.Key(), result)
+					}
+				case slices.Contains(tc.expectedFailed, op.Key()):
+					if result.Skipped || result.Error == nil {
+						t.Fatalf("expected %#q to fail got %#v", op.Key(), result)
+					}
+				default:
+					if result.Skipped || result.Error != nil {
+						t.Fatalf("expected %#q to succeed got %#v", op.Key(), result)
+					}
+				}
+			}
+
+			if maxRunning != tc.expectedMaxRunning {
+				t.Fatalf("expected at most %d concurrent operations got %d", tc.expectedMaxRunning, maxRunning)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package helmclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/kube"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+const (
+	// crdEstablishedPollInterval is the interval in which created and
+	// upgraded CRDs are polled until they are established.
+	crdEstablishedPollInterval = time.Second
+	// crdEstablishedTimeout is the time CRDs may take to become established.
+	// This matches the timeout Helm uses when it creates CRDs itself.
+	crdEstablishedTimeout = 60 * time.Second
+)
+
+var crdResource = apiextensionsv1.SchemeGroupVersion.WithResource("customresourcedefinitions")
+
+// ApplyCRDsFromTarball creates and upgrades the CRDs in the crds/ directory of
+// the given chart and its dependencies. Helm itself only creates missing CRDs
+// and never upgrades them. Upgrading a CRD fails with a
+// crdStoredVersionRemovedError if it would remove a version which is still
+// listed in the stored versions of the existing CRD. The returned changes
+// list the CRDs that were created or whose spec changed. It returns once all
+// of them are established.
+func (c *Client) ApplyCRDsFromTarball(ctx context.Context, chartPath string) ([]CRDChange, error) {
+	eventName := "apply_crds_from_tarball"
+
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeChartPath, chartPath),
+	))
+	defer span.End()
+
+	m := c.metrics.observe(eventName, "")
+	defer m.stop()
+
+	chartRequested, err := c.loadHelmChart(ctx, chartPath)
+	err = translateHelmError(err, "", "")
+	if err != nil {
+		m.fail()
+		recordSpanError(span, err)
+		return nil, microerror.Mask(err)
+	}
+
+	changes, err := c.applyCRDs(ctx, chartRequested, nil)
+	err = translateHelmError(err, "", "")
+	if err != nil {
+		m.fail()
+		recordSpanError(span, err)
+		return nil, microerror.Mask(err)
+	}
+
+	return changes, nil
+}
+
+// applyCRDs creates and upgrades the CRDs of the given chart and waits until
+// they are established. The discovery cache of the given action configuration
+// and the REST mapper are reset afterwards so that custom resources of the
+// chart's templates can be built right away.
+func (c *Client) applyCRDs(ctx context.Context, ch *chart.Chart, cfg *action.Configuration) ([]CRDChange, error) {
+	var desired []*apiextensionsv1.CustomResourceDefinition
+	for _, file := range ch.CRDObjects() {
+		objects, err := parseManifest(string(file.File.Data))
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		for _, o := range objects {
+			if !isCRD(o.GroupVersionKind()) {
+				continue
+			}
+
+			crd, err := toCRD(o)
+			if err != nil {
+				return nil, microerror.Mask(err)
+			}
+
+			desired = append(desired, crd)
+		}
+	}
+
+	// Check all CRDs before changing any of them so that an unsafe chart
+	// does not leave its CRDs partially upgraded.
+	existing := map[string]*apiextensionsv1.CustomResourceDefinition{}
+	for _, crd := range desired {
+		o, err := c.dynamicClient.Resource(crdResource).Get(ctx, crd.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		current, err := toCRD(o)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		err = checkStoredVersions(current, crd)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		existing[crd.Name] = current
+	}
+
+	var changes []CRDChange
+	for _, crd := range desired {
+		current, ok := existing[crd.Name]
+		if !ok {
+			o, err := fromCRD(crd)
+			if err != nil {
+				return nil, microerror.Mask(err)
+			}
+
+			_, err = c.dynamicClient.Resource(crdResource).Create(ctx, o, metav1.CreateOptions{})
+			if err != nil {
+				return nil, microerror.Mask(err)
+			}
+
+			changes = append(changes, CRDChange{Change: ObjectAdded, Name: crd.Name})
+			continue
+		}
+
+		crd.ResourceVersion = current.ResourceVersion
+
+		o, err := fromCRD(crd)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		updated, err := c.dynamicClient.Resource(crdResource).Update(ctx, o, metav1.UpdateOptions{})
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		// The API server only increments the generation when the spec
+		// changed. Comparing specs locally would report changes for every
+		// field defaulted by the API server.
+		if updated.GetGeneration() != current.Generation {
+			changes = append(changes, CRDChange{Change: ObjectChanged, Name: crd.Name})
+		}
+	}
+
+	for _, change := range changes {
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("CRD %#q %s", change.Name, change.Change))
+	}
+
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	err := c.waitForCRDsEstablished(ctx, changes)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	err = c.resetDiscovery(cfg)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return changes, nil
+}
+
+// waitForCRDsEstablished waits until all changed CRDs are established and
+// their versions are served.
+func (c *Client) waitForCRDsEstablished(ctx context.Context, changes []CRDChange) error {
+	ctx, cancel := context.WithTimeout(ctx, crdEstablishedTimeout)
+	defer cancel()
+
+	established := NewConditionReadinessChecker(string(apiextensionsv1.Established))
+
+	for _, change := range changes {
+		err := wait.PollUntilContextCancel(ctx, crdEstablishedPollInterval, true, func(ctx context.Context) (bool, error) {
+			o, err := c.dynamicClient.Resource(crdResource).Get(ctx, change.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, microerror.Mask(err)
+			}
+
+			return established.IsReady(ctx, o)
+		})
+		if wait.Interrupted(err) {
+			return microerror.Maskf(notReadyError, "CRD %#q did not become established", change.Name)
+		} else if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	return nil
+}
+
+// resetDiscovery drops cached API resources so that new CRDs are recognized
+// when Helm builds the rendered resources.
+func (c *Client) resetDiscovery(cfg *action.Configuration) error {
+	if resettable, ok := c.restMapper.(meta.ResettableRESTMapper); ok {
+		resettable.Reset()
+	}
+
+	if cfg == nil || cfg.RESTClientGetter == nil {
+		return nil
+	}
+
+	discoveryClient, err := cfg.RESTClientGetter.ToDiscoveryClient()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	discoveryClient.Invalidate()
+
+	return nil
+}
+
+// checkStoredVersions ensures the desired CRD still serves every version
+// objects of the current CRD may be stored in. Removing such a version
+// makes the stored objects unreadable.
+func checkStoredVersions(current, desired *apiextensionsv1.CustomResourceDefinition) error {
+	versions := map[string]bool{}
+	for _, v := range desired.Spec.Versions {
+		versions[v.Name] = true
+	}
+
+	for _, v := range current.Status.StoredVersions {
+		if !versions[v] {
+			return microerror.Maskf(crdStoredVersionRemovedError, "CRD %#q removes version %#q which is still in its stored versions %v", current.Name, v, current.Status.StoredVersions)
+		}
+	}
+
+	return nil
+}
+
+func toCRD(o *unstructured.Unstructured) (*apiextensionsv1.CustomResourceDefinition, error) {
+	var crd apiextensionsv1.CustomResourceDefinition
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(o.Object, &crd)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return &crd, nil
+}
+
+func fromCRD(crd *apiextensionsv1.CustomResourceDefinition) (*unstructured.Unstructured, error) {
+	o, err := runtime.DefaultUnstructuredConverter.ToUnstructured(crd)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	// The status is managed by the API server and must not be sent.
+	delete(o, "status")
+
+	u := &unstructured.Unstructured{Object: o}
+	u.SetGroupVersionKind(apiextensionsv1.SchemeGroupVersion.WithKind("CustomResourceDefinition"))
+
+	return u, nil
+}
+
+// keepCRDsClient is a Helm kube client which does not delete CRDs. It is used
+// to keep CRDs rendered from chart templates in place when uninstalling a
+// release. All other operations are delegated to the Helm kube client.
+type keepCRDsClient struct {
+	kubeClient
+
+	kept []ObjectReference
+}
+
+// Delete deletes all resources except CRDs.
+func (c *keepCRDsClient) Delete(resources kube.ResourceList) (*kube.Result, []error) {
+	return c.kubeClient.Delete(c.filter(resources))
+}
+
+// DeleteWithPropagationPolicy deletes all resources except CRDs.
+func (c *keepCRDsClient) DeleteWithPropagationPolicy(resources kube.ResourceList, policy metav1.DeletionPropagation) (*kube.Result, []error) {
+	return c.kubeClient.DeleteWithPropagationPolicy(c.filter(resources), policy)
+}
+
+func (c *keepCRDsClient) filter(resources kube.ResourceList) kube.ResourceList {
+	return resources.Filter(func(info *resource.Info) bool {
+		if !isCRD(info.Mapping.GroupVersionKind) {
+			return true
+		}
+
+		c.kept = append(c.kept, ObjectReference{
+			APIVersion: info.Mapping.GroupVersionKind.GroupVersion().String(),
+			Kind:       info.Mapping.GroupVersionKind.Kind,
+			Name:       info.Name,
+		})
+
+		return false
+	})
+}
+
+func isCRD(gvk schema.GroupVersionKind) bool {
+	return gvk.GroupKind() == apiextensionsv1.Kind("CustomResourceDefinition")
+}
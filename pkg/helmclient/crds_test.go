@@ -0,0 +1,258 @@
+package helmclient
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/google/go-cmp/cmp"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/kube"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func Test_checkStoredVersions(t *testing.T) {
+	testCases := []struct {
+		name           string
+		storedVersions []string
+		versions       []string
+		expectedErr    func(error) bool
+	}{
+		{
+			name:           "case 0: stored version kept",
+			storedVersions: []string{"v1alpha1"},
+			versions:       []string{"v1alpha1", "v1beta1"},
+		},
+		{
+			name:           "case 1: unstored version removed",
+			storedVersions: []string{"v1beta1"},
+			versions:       []string{"v1beta1"},
+		},
+		{
+			name:           "case 2: stored version removed",
+			storedVersions: []string{"v1alpha1", "v1beta1"},
+			versions:       []string{"v1beta1"},
+			expectedErr:    IsCRDStoredVersionRemoved,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			current := &apiextensionsv1.CustomResourceDefinition{}
+			current.Name = "apps.example.com"
+			current.Status.StoredVersions = tc.storedVersions
+
+			desired := &apiextensionsv1.CustomResourceDefinition{}
+			for _, v := range tc.versions {
+				desired.Spec.Versions = append(desired.Spec.Versions, apiextensionsv1.CustomResourceDefinitionVersion{Name: v})
+			}
+
+			err := checkStoredVersions(current, desired)
+			switch {
+			case err == nil && tc.expectedErr == nil:
+				// correct; carry on
+			case err != nil && tc.expectedErr == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.expectedErr != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.expectedErr(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+		})
+	}
+}
+
+func Test_Client_applyCRDs(t *testing.T) {
+	manifest := `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: apps.example.com
+spec:
+  group: example.com
+  names:
+    kind: App
+    plural: apps
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+`
+
+	testCases := []struct {
+		name            string
+		existing        []runtime.Object
+		expectedChanges []CRDChange
+		expectedReset   bool
+	}{
+		{
+			name:            "case 0: CRD is created",
+			expectedChanges: []CRDChange{{Change: ObjectAdded, Name: "apps.example.com"}},
+			expectedReset:   true,
+		},
+		{
+			name: "case 1: unchanged CRD",
+			existing: []runtime.Object{
+				&unstructured.Unstructured{Object: map[string]interface{}{
+					"apiVersion": "apiextensions.k8s.io/v1",
+					"kind":       "CustomResourceDefinition",
+					"metadata":   map[string]interface{}{"name": "apps.example.com"},
+				}},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{crdResource: "CustomResourceDefinitionList"}, tc.existing...)
+			// The API server establishes CRDs asynchronously. The fake
+			// establishes them once they are read.
+			dynamicClient.PrependReactor("get", "customresourcedefinitions", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				o, err := dynamicClient.Tracker().Get(crdResource, "", action.(clienttesting.GetAction).GetName())
+				if err != nil {
+					return true, nil, err
+				}
+
+				u := o.(*unstructured.Unstructured).DeepCopy()
+				_ = unstructured.SetNestedSlice(u.Object, []interface{}{
+					map[string]interface{}{"type": "Established", "status": "True"},
+				}, "status", "conditions")
+
+				return true, u, nil
+			})
+
+			restMapper := &resettableRESTMapper{RESTMapper: meta.NewDefaultRESTMapper(nil)}
+			c := &Client{
+				dynamicClient: dynamicClient,
+				logger:        microloggertest.New(),
+				restMapper:    restMapper,
+			}
+
+			ch := &chart.Chart{
+				Metadata: &chart.Metadata{Name: "app"},
+				Files: []*chart.File{
+					{Name: "crds/app.yaml", Data: []byte(manifest)},
+				},
+			}
+
+			changes, err := c.applyCRDs(context.Background(), ch, nil)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			if !cmp.Equal(changes, tc.expectedChanges) {
+				t.Fatalf("want matching changes \n %s", cmp.Diff(tc.expectedChanges, changes))
+			}
+			if restMapper.reset != tc.expectedReset {
+				t.Fatalf("reset == %t, want %t", restMapper.reset, tc.expectedReset)
+			}
+		})
+	}
+}
+
+type resettableRESTMapper struct {
+	meta.RESTMapper
+
+	reset bool
+}
+
+func (m *resettableRESTMapper) Reset() {
+	m.reset = true
+}
+
+func Test_keepCRDsClient_Delete(t *testing.T) {
+	crd := &resource.Info{
+		Name: "apps.application.giantswarm.io",
+		Mapping: &meta.RESTMapping{
+			GroupVersionKind: apiextensionsv1.SchemeGroupVersion.WithKind("CustomResourceDefinition"),
+		},
+	}
+	deployment := &resource.Info{
+		Name:      "app",
+		Namespace: "default",
+		Mapping: &meta.RESTMapping{
+			GroupVersionKind: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+		},
+	}
+
+	testCases := []struct {
+		name            string
+		delete          func(c *keepCRDsClient, resources kube.ResourceList) (*kube.Result, []error)
+		resources       kube.ResourceList
+		expectedDeleted []string
+		expectedKept    []ObjectReference
+	}{
+		{
+			name: "case 0: CRDs are kept",
+			delete: func(c *keepCRDsClient, resources kube.ResourceList) (*kube.Result, []error) {
+				return c.Delete(resources)
+			},
+			resources:       kube.ResourceList{crd, deployment},
+			expectedDeleted: []string{"app"},
+			expectedKept: []ObjectReference{
+				{APIVersion: "apiextensions.k8s.io/v1", Kind: "CustomResourceDefinition", Name: "apps.application.giantswarm.io"},
+			},
+		},
+		{
+			name: "case 1: CRDs are kept with a propagation policy",
+			delete: func(c *keepCRDsClient, resources kube.ResourceList) (*kube.Result, []error) {
+				return c.DeleteWithPropagationPolicy(resources, metav1.DeletePropagationForeground)
+			},
+			resources:       kube.ResourceList{crd, deployment},
+			expectedDeleted: []string{"app"},
+			expectedKept: []ObjectReference{
+				{APIVersion: "apiextensions.k8s.io/v1", Kind: "CustomResourceDefinition", Name: "apps.application.giantswarm.io"},
+			},
+		},
+		{
+			name: "case 2: other objects are deleted",
+			delete: func(c *keepCRDsClient, resources kube.ResourceList) (*kube.Result, []error) {
+				return c.Delete(resources)
+			},
+			resources:       kube.ResourceList{deployment},
+			expectedDeleted: []string{"app"},
+			expectedKept:    nil,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			c := &keepCRDsClient{
+				kubeClient: &kubefake.FailingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}},
+			}
+
+			result, errs := tc.delete(c, tc.resources)
+			if len(errs) > 0 {
+				t.Fatalf("errors == %#v, want nil", errs)
+			}
+
+			var deleted []string
+			for _, info := range result.Deleted {
+				deleted = append(deleted, info.Name)
+			}
+			if diff := cmp.Diff(tc.expectedDeleted, deleted); diff != "" {
+				t.Fatalf("want matching deleted objects \n %s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedKept, c.kept); diff != "" {
+				t.Fatalf("want matching kept CRDs \n %s", diff)
+			}
+		})
+	}
+}
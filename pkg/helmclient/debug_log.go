@@ -0,0 +1,123 @@
+package helmclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// maxDebugLogSize is the maximum size in bytes of the debug log attached
+	// to the error of a failed operation. The most recent messages are kept
+	// as they are the most relevant for the failure.
+	maxDebugLogSize = 16 * 1024
+)
+
+type debugLogContextKey struct{}
+
+// DebugLogError is returned by operations running Helm actions when they
+// fail. It wraps the actual error, so that it can still be asserted, and
+// carries the debug log Helm wrote during the failed operation.
+type DebugLogError struct {
+	// DebugLog are the most recent debug messages Helm logged during the
+	// operation, one per line. The size is bounded. Older messages are
+	// dropped.
+	DebugLog string
+
+	err error
+}
+
+func (e *DebugLogError) Error() string {
+	return e.err.Error()
+}
+
+func (e *DebugLogError) Unwrap() error {
+	return e.err
+}
+
+// DebugLog returns the Helm debug log attached to the error of a failed
+// operation or an empty string if there is none.
+func DebugLog(err error) string {
+	var debugLogError *DebugLogError
+	if errors.As(err, &debugLogError) {
+		return debugLogError.DebugLog
+	}
+
+	return ""
+}
+
+// debugLog collects the debug messages Helm logs during a single operation.
+type debugLog struct {
+	mutex    sync.Mutex
+	dropped  int
+	messages []string
+	size     int
+}
+
+// withDebugLog returns a context collecting the debug messages Helm logs
+// for action configurations created with it.
+func withDebugLog(ctx context.Context) (context.Context, *debugLog) {
+	l := &debugLog{}
+	return context.WithValue(ctx, debugLogContextKey{}, l), l
+}
+
+func debugLogFrom(ctx context.Context) *debugLog {
+	l, _ := ctx.Value(debugLogContextKey{}).(*debugLog)
+	return l
+}
+
+func (l *debugLog) write(message string) {
+	if l == nil {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// Keep the end of oversized messages, leaving room for the separating
+	// newline, and start on a rune boundary to keep the log valid UTF-8.
+	if len(message) >= maxDebugLogSize {
+		cut := len(message) - maxDebugLogSize + 1
+		for cut < len(message) && !utf8.RuneStart(message[cut]) {
+			cut++
+		}
+		message = message[cut:]
+	}
+
+	l.messages = append(l.messages, message)
+	l.size += len(message) + 1
+
+	for l.size > maxDebugLogSize {
+		l.size -= len(l.messages[0]) + 1
+		l.messages = l.messages[1:]
+		l.dropped++
+	}
+}
+
+// attach returns err wrapped in a DebugLogError carrying the collected debug
+// log. err is returned as is if nothing was logged.
+func (l *debugLog) attach(err error) error {
+	if l == nil || err == nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if len(l.messages) == 0 {
+		return err
+	}
+
+	log := strings.Join(l.messages, "\n")
+	if l.dropped > 0 {
+		log = fmt.Sprintf("[%d earlier messages dropped]\n%s", l.dropped, log)
+	}
+
+	return &DebugLogError{
+		DebugLog: log,
+		err:      err,
+	}
+}
@@ -0,0 +1,79 @@
+package helmclient
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger/microloggertest"
+)
+
+func Test_debugLog_attach(t *testing.T) {
+	ctx, debugLog := withDebugLog(context.Background())
+
+	c := &Client{logger: microloggertest.New()}
+	log := c.debugLogFunc(ctx)
+	log("creating %d resource(s)", 3)
+	log("beginning wait for %d resources with timeout of %s", 3, "5m0s")
+
+	err := microerror.Mask(debugLog.attach(microerror.Maskf(executionFailedError, "boom")))
+
+	if !IsExecutionFailed(err) {
+		t.Fatalf("expected executionFailedError got %#v", err)
+	}
+
+	expected := "creating 3 resource(s)\nbeginning wait for 3 resources with timeout of 5m0s"
+	if DebugLog(err) != expected {
+		t.Fatalf("expected debug log %q got %q", expected, DebugLog(err))
+	}
+}
+
+func Test_debugLog_bounded(t *testing.T) {
+	_, debugLog := withDebugLog(context.Background())
+
+	line := strings.Repeat("x", 1023)
+	for i := 0; i < 20; i++ {
+		debugLog.write(line)
+	}
+
+	log := DebugLog(debugLog.attach(microerror.Mask(executionFailedError)))
+	if !strings.HasPrefix(log, "[4 earlier messages dropped]\n") {
+		t.Fatalf("expected dropped messages note got %q", log[:40])
+	}
+	if strings.Count(log, line) != 16 {
+		t.Fatalf("expected 16 messages got %d", strings.Count(log, line))
+	}
+}
+
+func Test_debugLog_oversizedMessage(t *testing.T) {
+	_, debugLog := withDebugLog(context.Background())
+
+	// Each rune is 3 bytes long so the cut falls inside a rune.
+	message := strings.Repeat("€", maxDebugLogSize)
+	debugLog.write(message)
+
+	log := DebugLog(debugLog.attach(microerror.Mask(executionFailedError)))
+	if log == "" {
+		t.Fatalf("expected oversized message to be kept")
+	}
+	if len(log) >= maxDebugLogSize {
+		t.Fatalf("expected debug log smaller than %d bytes got %d", maxDebugLogSize, len(log))
+	}
+	if !utf8.ValidString(log) {
+		t.Fatalf("expected valid UTF-8 debug log")
+	}
+	if !strings.HasSuffix(message, log) {
+		t.Fatalf("expected the end of the message to be kept")
+	}
+}
+
+func Test_debugLog_noMessages(t *testing.T) {
+	_, debugLog := withDebugLog(context.Background())
+
+	err := debugLog.attach(microerror.Mask(executionFailedError))
+	if DebugLog(err) != "" {
+		t.Fatalf("expected empty debug log got %q", DebugLog(err))
+	}
+}
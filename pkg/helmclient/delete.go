@@ -2,52 +2,184 @@ package helmclient
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	"github.com/giantswarm/microerror"
-	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
-// DeleteRelease uninstalls a chart given its release name.
-func (c *Client) DeleteRelease(ctx context.Context, namespace, releaseName string, options DeleteOptions) error {
+// DeleteRelease uninstalls a chart given its release name. The returned result
+// lists the resources that were kept due to the helm.sh/resource-policy: keep
+// annotation or DeleteOptions.KeepCRDs.
+func (c *Client) DeleteRelease(ctx context.Context, namespace, releaseName string, options DeleteOptions) (*DeleteResult, error) {
 	eventName := "delete_release"
 
-	t := prometheus.NewTimer(histogram.WithLabelValues(eventName))
-	defer func() {
-		eventCounter.WithLabelValues(eventName, releaseName).Inc()
-		t.ObserveDuration()
-	}()
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeReleaseNamespace, namespace),
+		attribute.String(attributeReleaseName, releaseName),
+	))
+	defer span.End()
 
-	err := c.deleteRelease(ctx, namespace, releaseName, options)
+	m := c.metrics.observe(eventName, namespace)
+	defer m.stop()
+
+	ctx, debugLog := withDebugLog(ctx)
+
+	audit := c.newAudit(AuditOperationDelete, namespace, releaseName, nil)
+	result, err := c.deleteRelease(ctx, audit, namespace, releaseName, options)
+	err = translateHelmError(err, namespace, releaseName)
+	audit.finish(ctx, err)
+	c.recordEvent(options.EventObject, deleteOperation, namespace, releaseName, err)
 	if err != nil {
-		errorGauge.WithLabelValues(eventName).Inc()
-		return microerror.Mask(err)
+		m.fail()
+		recordSpanError(span, err)
+		return nil, microerror.Mask(debugLog.attach(err))
 	}
 
-	return nil
+	return result, nil
 }
 
-func (c *Client) deleteRelease(ctx context.Context, namespace, releaseName string, options DeleteOptions) error {
-	cfg, err := c.newActionConfig(ctx, namespace)
+func (c *Client) deleteRelease(ctx context.Context, audit *auditTrail, namespace, releaseName string, options DeleteOptions) (*DeleteResult, error) {
+	ctx, unlock, err := c.lockRelease(ctx, namespace, releaseName)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	defer unlock()
+
+	audit.start(ctx)
+
+	cfg, kubeClients, err := c.newActionConfigWithKubeClients(ctx, namespace, kubeClientOptions{
+		KeepCRDs: options.KeepCRDs,
+	})
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	result, err := c.uninstallRelease(ctx, cfg, kubeClients.keepCRDs, namespace, releaseName, options)
 	if err != nil {
-		return microerror.Mask(err)
+		return nil, microerror.Mask(err)
 	}
 
+	return result, nil
+}
+
+// uninstallRelease uninstalls the release using the given action
+// configuration. keepCRDs is the client keeping CRDs if DeleteOptions.KeepCRDs
+// is set.
+func (c *Client) uninstallRelease(ctx context.Context, cfg *action.Configuration, keepCRDs *keepCRDsClient, namespace, releaseName string, options DeleteOptions) (*DeleteResult, error) {
 	uninstall := action.NewUninstall(cfg)
 
-	// Configure action with supported upgrade options.
-	options.configure(uninstall)
+	// Configure action with supported uninstall options.
+	err := options.configure(uninstall)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	start := time.Now()
 
-	_, err = uninstall.Run(releaseName)
+	res, err := uninstall.Run(releaseName)
 	if err != nil {
-		return microerror.Mask(err)
+		// Helm does not store the release when a pre-delete hook fails and
+		// purges it after post-delete hooks unless history is kept. The
+		// returned release carries the hook state instead.
+		if res != nil && res.Release != nil {
+			err = c.hookFailure(ctx, namespace, res.Release, start, err)
+		}
+		return nil, microerror.Mask(err)
 	}
 
-	return nil
+	result := &DeleteResult{}
+	if res != nil && res.Release != nil {
+		result.KeptObjects, err = c.keptObjects(res.Release)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+	}
+	if keepCRDs != nil {
+		result.KeptObjects = append(result.KeptObjects, keepCRDs.kept...)
+	}
+
+	return result, nil
+}
+
+// keptObjects returns the objects of the release manifest annotated with
+// helm.sh/resource-policy: keep. Helm does not delete these objects when
+// uninstalling. Namespaced objects rendered without a namespace are in the
+// namespace of the release.
+func (c *Client) keptObjects(rel *release.Release) ([]ObjectReference, error) {
+	objects, err := parseManifest(rel.Manifest)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var kept []ObjectReference
+	for _, o := range objects {
+		policy := o.GetAnnotations()[kube.ResourcePolicyAnno]
+		if strings.ToLower(strings.TrimSpace(policy)) != kube.KeepPolicy {
+			continue
+		}
+
+		namespace := o.GetNamespace()
+		if namespace == "" {
+			namespaced, err := c.isNamespaced(o)
+			if err != nil {
+				return nil, microerror.Mask(err)
+			}
+			if namespaced {
+				namespace = rel.Namespace
+			}
+		}
+
+		kept = append(kept, ObjectReference{
+			APIVersion: o.GetAPIVersion(),
+			Kind:       o.GetKind(),
+			Name:       o.GetName(),
+			Namespace:  namespace,
+		})
+	}
+
+	return kept, nil
+}
+
+// isNamespaced returns true if the kind of the given object is namespaced.
+func (c *Client) isNamespaced(o *unstructured.Unstructured) (bool, error) {
+	gvk := o.GroupVersionKind()
+
+	mapping, err := c.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	return mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
 }
 
-func (options DeleteOptions) configure(action *action.Uninstall) {
-	if options.Timeout > 0 {
-		action.Timeout = options.Timeout
+func (options DeleteOptions) configure(action *action.Uninstall) error {
+	if options.Timeout == 0 {
+		options.Timeout = time.Second * defaultK8sClientTimeout
+	}
+	if options.DeletionPropagation == "" {
+		options.DeletionPropagation = DeletionPropagationBackground
+	}
+
+	switch options.DeletionPropagation {
+	case DeletionPropagationBackground, DeletionPropagationForeground, DeletionPropagationOrphan:
+	default:
+		return microerror.Maskf(invalidConfigError, "unknown deletion propagation %#q", options.DeletionPropagation)
 	}
+
+	action.DeletionPropagation = options.DeletionPropagation
+	action.Description = options.Description
+	action.DisableHooks = options.DisableHooks
+	action.KeepHistory = options.KeepHistory
+	action.Timeout = options.Timeout
+	action.Wait = options.Wait
+
+	return nil
 }
@@ -0,0 +1,300 @@
+package helmclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/google/go-cmp/cmp"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/kube"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_DeleteOptions_configure(t *testing.T) {
+	testCases := []struct {
+		name            string
+		options         DeleteOptions
+		expectedTimeout time.Duration
+	}{
+		{
+			name:            "case 0: wait without timeout uses the default timeout",
+			options:         DeleteOptions{Wait: true},
+			expectedTimeout: time.Second * defaultK8sClientTimeout,
+		},
+		{
+			name:            "case 1: custom timeout",
+			options:         DeleteOptions{Timeout: time.Minute, Wait: true},
+			expectedTimeout: time.Minute,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			uninstall := action.NewUninstall(&action.Configuration{})
+
+			err := tc.options.configure(uninstall)
+			if err != nil {
+				t.Fatalf("expected nil error got %#v", err)
+			}
+
+			if uninstall.Timeout != tc.expectedTimeout {
+				t.Fatalf("expected timeout %s got %s", tc.expectedTimeout, uninstall.Timeout)
+			}
+			if !uninstall.Wait {
+				t.Fatalf("expected wait to be set")
+			}
+		})
+	}
+}
+
+func Test_Client_keptObjects(t *testing.T) {
+	testCases := []struct {
+		name            string
+		manifest        string
+		expectedObjects []ObjectReference
+		errorMatcher    func(error) bool
+	}{
+		{
+			name: "case 0: namespace of namespaced objects is defaulted",
+			manifest: `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    helm.sh/resource-policy: keep
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: monitoring
+  annotations:
+    helm.sh/resource-policy: keep
+`,
+			expectedObjects: []ObjectReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "app", Namespace: "default"},
+				{APIVersion: "v1", Kind: "ConfigMap", Name: "config", Namespace: "monitoring"},
+			},
+		},
+		{
+			name: "case 1: cluster scoped objects have no namespace",
+			manifest: `---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: viewer
+  annotations:
+    helm.sh/resource-policy: " Keep "
+`,
+			expectedObjects: []ObjectReference{
+				{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole", Name: "viewer"},
+			},
+		},
+		{
+			name: "case 2: objects without keep policy are not kept",
+			manifest: `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+`,
+			expectedObjects: nil,
+		},
+		{
+			name: "case 3: invalid manifest",
+			manifest: `---
+kind: [
+`,
+			errorMatcher: IsInvalidManifest,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			c := &Client{
+				restMapper: newDeleteTestRESTMapper(),
+			}
+
+			objects, err := c.keptObjects(&release.Release{Name: "foo", Namespace: "default", Manifest: tc.manifest})
+
+			switch {
+			case err == nil && tc.errorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if diff := cmp.Diff(tc.expectedObjects, objects); diff != "" {
+				t.Fatalf("want matching kept objects \n %s", diff)
+			}
+		})
+	}
+}
+
+func Test_Client_uninstallRelease(t *testing.T) {
+	crd := &resource.Info{
+		Name: "apps.example.com",
+		Mapping: &meta.RESTMapping{
+			GroupVersionKind: apiextensionsv1.SchemeGroupVersion.WithKind("CustomResourceDefinition"),
+		},
+	}
+
+	testCases := []struct {
+		name            string
+		release         *release.Release
+		keepCRDs        bool
+		options         DeleteOptions
+		expectedObjects []ObjectReference
+		expectedHistory bool
+		errorMatcher    func(error) bool
+	}{
+		{
+			name:    "case 0: kept objects are reported",
+			release: newDeleteTestRelease("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\n  annotations:\n    helm.sh/resource-policy: keep\n", nil),
+			expectedObjects: []ObjectReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "app", Namespace: "default"},
+			},
+		},
+		{
+			name:     "case 1: kept CRDs are reported",
+			release:  newDeleteTestRelease("", nil),
+			keepCRDs: true,
+			expectedObjects: []ObjectReference{
+				{APIVersion: "apiextensions.k8s.io/v1", Kind: "CustomResourceDefinition", Name: "apps.example.com"},
+			},
+		},
+		{
+			name:            "case 2: history is kept",
+			release:         newDeleteTestRelease("", nil),
+			options:         DeleteOptions{KeepHistory: true},
+			expectedHistory: true,
+		},
+		{
+			name: "case 3: pre-delete hook fails",
+			release: newDeleteTestRelease("", &release.Hook{
+				Name:     "cleanup",
+				Kind:     "Pod",
+				Manifest: "apiVersion: v1\nkind: Pod\nmetadata:\n  name: cleanup\n",
+				Events:   []release.HookEvent{release.HookPreDelete},
+			}),
+			expectedHistory: true,
+			errorMatcher:    IsHookFailed,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			k8sClient := fake.NewSimpleClientset()
+			c := &Client{
+				k8sClient:  k8sClient,
+				logger:     microloggertest.New(),
+				restMapper: newDeleteTestRESTMapper(),
+			}
+
+			var kubeClient kubeClient = &kubefake.FailingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}, WatchUntilReadyError: errors.New("pod failed")}
+			var keepCRDs *keepCRDsClient
+			if tc.keepCRDs {
+				// The fake kube client does not build objects. Delete the
+				// CRD the chart rendered in its place.
+				keepCRDs = &keepCRDsClient{kubeClient: kubeClient}
+				_, errs := keepCRDs.Delete(kube.ResourceList{crd})
+				if len(errs) > 0 {
+					t.Fatal(errs)
+				}
+				kubeClient = keepCRDs
+			}
+
+			cfg := &action.Configuration{
+				Releases:     storage.Init(driver.NewSecrets(k8sClient.CoreV1().Secrets("default"))),
+				KubeClient:   kubeClient,
+				Capabilities: chartutil.DefaultCapabilities,
+				Log:          func(string, ...interface{}) {},
+			}
+			err := cfg.Releases.Create(tc.release)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := c.uninstallRelease(context.Background(), cfg, keepCRDs, "default", "foo", tc.options)
+
+			switch {
+			case err == nil && tc.errorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if err == nil {
+				if diff := cmp.Diff(tc.expectedObjects, result.KeptObjects); diff != "" {
+					t.Fatalf("want matching kept objects \n %s", diff)
+				}
+			}
+
+			_, err = cfg.Releases.History("foo")
+			if IsReleaseNotFound(err) == tc.expectedHistory {
+				t.Fatalf("expected history kept %t got error %#v", tc.expectedHistory, err)
+			}
+		})
+	}
+}
+
+func newDeleteTestRelease(manifest string, hook *release.Hook) *release.Release {
+	rel := &release.Release{
+		Name:      "foo",
+		Namespace: "default",
+		Version:   1,
+		Info:      &release.Info{Status: release.StatusDeployed},
+		Chart: &chart.Chart{
+			Metadata: &chart.Metadata{
+				APIVersion: chart.APIVersionV2,
+				Name:       "foo",
+				Version:    "1.0.0",
+			},
+		},
+		Manifest: manifest,
+	}
+	if hook != nil {
+		rel.Hooks = []*release.Hook{hook}
+	}
+
+	return rel
+}
+
+func newDeleteTestRESTMapper() meta.RESTMapper {
+	restMapper := meta.NewDefaultRESTMapper(nil)
+	restMapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	restMapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	restMapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+
+	return restMapper
+}
@@ -3,42 +3,48 @@ package helmclient
 import (
 	"errors"
 	"net"
-	"regexp"
-	"strings"
 
 	"github.com/giantswarm/microerror"
-	"helm.sh/helm/v3/pkg/storage/driver"
 )
 
-const (
-	resourceAlreadyExistsErrorPrefix = "rendered manifests contain a resource that already exists"
-)
+// isHelmError asserts the given kind of the errors translated from Helm
+// errors. Errors which were not translated, e.g. errors returned by Helm
+// directly or built by callers, are translated first so that they keep
+// matching.
+func isHelmError(err error, kind *microerror.Error) bool {
+	if err == nil {
+		return false
+	}
+
+	return errors.Is(err, kind) || errors.Is(translateHelmError(err, "", ""), kind)
+}
 
 var resourceAlreadyExistsError = &microerror.Error{
 	Kind: "resourceAlreadyExistsError",
 }
 
-// IsResourceAlreadyExists asserts resourceAlreadyExistError.
+// IsResourceAlreadyExists asserts resourceAlreadyExistsError.
 func IsResourceAlreadyExists(err error) bool {
-	if err == nil {
-		return false
-	}
+	return isHelmError(err, resourceAlreadyExistsError)
+}
 
-	c := microerror.Cause(err)
+var adoptionConflictError = &microerror.Error{
+	Kind: "adoptionConflictError",
+}
 
-	if strings.Contains(c.Error(), resourceAlreadyExistsErrorPrefix) {
-		return true
-	}
-	if c == resourceAlreadyExistsError {
-		return true
-	}
+// IsAdoptionConflict asserts adoptionConflictError.
+func IsAdoptionConflict(err error) bool {
+	return errors.Is(err, adoptionConflictError)
+}
 
-	return false
+var batchDependencyFailedError = &microerror.Error{
+	Kind: "batchDependencyFailedError",
 }
 
-const (
-	cannotReuseReleaseErrorPrefix = "cannot re-use"
-)
+// IsBatchDependencyFailed asserts batchDependencyFailedError.
+func IsBatchDependencyFailed(err error) bool {
+	return errors.Is(err, batchDependencyFailedError)
+}
 
 var cannotReuseReleaseError = &microerror.Error{
 	Kind: "cannotReuseReleaseError",
@@ -46,25 +52,17 @@ var cannotReuseReleaseError = &microerror.Error{
 
 // IsCannotReuseRelease asserts cannotReuseReleaseError.
 func IsCannotReuseRelease(err error) bool {
-	if err == nil {
-		return false
-	}
-
-	c := microerror.Cause(err)
-
-	if strings.Contains(c.Error(), cannotReuseReleaseErrorPrefix) {
-		return true
-	}
-	if c == cannotReuseReleaseError {
-		return true
-	}
+	return isHelmError(err, cannotReuseReleaseError)
+}
 
-	return false
+var crdStoredVersionRemovedError = &microerror.Error{
+	Kind: "crdStoredVersionRemovedError",
 }
 
-var (
-	emptyChartTemplatesRegexp = regexp.MustCompile(`release \S+ failed: no objects visited`)
-)
+// IsCRDStoredVersionRemoved asserts crdStoredVersionRemovedError.
+func IsCRDStoredVersionRemoved(err error) bool {
+	return errors.Is(err, crdStoredVersionRemovedError)
+}
 
 var emptyChartTemplatesError = &microerror.Error{
 	Kind: "emptyChartTemplatesError",
@@ -72,20 +70,7 @@ var emptyChartTemplatesError = &microerror.Error{
 
 // IsEmptyChartTemplates asserts emptyChartTemplatesError.
 func IsEmptyChartTemplates(err error) bool {
-	if err == nil {
-		return false
-	}
-
-	c := microerror.Cause(err)
-
-	if c == emptyChartTemplatesError {
-		return true
-	}
-	if emptyChartTemplatesRegexp.MatchString(c.Error()) {
-		return true
-	}
-
-	return false
+	return isHelmError(err, emptyChartTemplatesError)
 }
 
 var executionFailedError = &microerror.Error{
@@ -94,7 +79,7 @@ var executionFailedError = &microerror.Error{
 
 // IsExecutionFailed asserts executionFailedError.
 func IsExecutionFailed(err error) bool {
-	return microerror.Cause(err) == executionFailedError
+	return errors.Is(err, executionFailedError)
 }
 
 var invalidConfigError = &microerror.Error{
@@ -103,59 +88,34 @@ var invalidConfigError = &microerror.Error{
 
 // IsInvalidConfig asserts invalidConfigError.
 func IsInvalidConfig(err error) bool {
-	return microerror.Cause(err) == invalidConfigError
+	return errors.Is(err, invalidConfigError)
 }
 
-const (
-	invalidGZipHeaderErrorPrefix = "gzip: invalid header"
-)
-
 var invalidGZipHeaderError = &microerror.Error{
 	Kind: "invalidGZipHeaderError",
 }
 
 // IsInvalidGZipHeader asserts invalidGZipHeaderError.
 func IsInvalidGZipHeader(err error) bool {
-	if err == nil {
-		return false
-	}
-
-	c := microerror.Cause(err)
-
-	if strings.HasPrefix(c.Error(), invalidGZipHeaderErrorPrefix) {
-		return true
-	}
-	if c == invalidGZipHeaderError {
-		return true
-	}
-
-	return false
+	return isHelmError(err, invalidGZipHeaderError)
 }
 
-const (
-	invalidManifestPrefix = "unable to build kubernetes objects from release manifest"
-)
-
 var invalidManifestError = &microerror.Error{
 	Kind: "invalidManifestError",
 }
 
 // IsInvalidManifest asserts invalidManifestError.
 func IsInvalidManifest(err error) bool {
-	if err == nil {
-		return false
-	}
-
-	c := microerror.Cause(err)
+	return isHelmError(err, invalidManifestError)
+}
 
-	if strings.HasPrefix(c.Error(), invalidManifestPrefix) {
-		return true
-	}
-	if c == invalidManifestError {
-		return true
-	}
+var invalidReleaseArchiveError = &microerror.Error{
+	Kind: "invalidReleaseArchiveError",
+}
 
-	return false
+// IsInvalidReleaseArchive asserts invalidReleaseArchiveError.
+func IsInvalidReleaseArchive(err error) bool {
+	return errors.Is(err, invalidReleaseArchiveError)
 }
 
 var notFoundError = &microerror.Error{
@@ -164,7 +124,16 @@ var notFoundError = &microerror.Error{
 
 // IsNotFound asserts notFoundError.
 func IsNotFound(err error) bool {
-	return microerror.Cause(err) == notFoundError
+	return errors.Is(err, notFoundError)
+}
+
+var notReadyError = &microerror.Error{
+	Kind: "notReadyError",
+}
+
+// IsNotReady asserts notReadyError.
+func IsNotReady(err error) bool {
+	return errors.Is(err, notReadyError)
 }
 
 var parsingDestFailedError = &microerror.Error{
@@ -173,7 +142,7 @@ var parsingDestFailedError = &microerror.Error{
 
 // IsParsingDestFailedError asserts parsingDestFailedError.
 func IsParsingDestFailedError(err error) bool {
-	return microerror.Cause(err) == parsingDestFailedError
+	return errors.Is(err, parsingDestFailedError)
 }
 
 var parsingSrcFailedError = &microerror.Error{
@@ -182,7 +151,7 @@ var parsingSrcFailedError = &microerror.Error{
 
 // IsparsingSrcFailedError asserts parsingSrcFailedError.
 func IsParsingSrcFailedError(err error) bool {
-	return microerror.Cause(err) == parsingSrcFailedError
+	return errors.Is(err, parsingSrcFailedError)
 }
 
 var pullChartFailedError = &microerror.Error{
@@ -191,7 +160,7 @@ var pullChartFailedError = &microerror.Error{
 
 // IsPullChartFailedError asserts pullChartFailedError.
 func IsPullChartFailedError(err error) bool {
-	return microerror.Cause(err) == pullChartFailedError
+	return errors.Is(err, pullChartFailedError)
 }
 
 var pullChartNotFoundError = &microerror.Error{
@@ -200,7 +169,7 @@ var pullChartNotFoundError = &microerror.Error{
 
 // IsPullChartNotFound asserts pullChartNotFoundError.
 func IsPullChartNotFound(err error) bool {
-	return microerror.Cause(err) == pullChartNotFoundError
+	return errors.Is(err, pullChartNotFoundError)
 }
 
 var pullChartTimeoutError = &microerror.Error{
@@ -209,22 +178,12 @@ var pullChartTimeoutError = &microerror.Error{
 
 // IsPullChartTimeout asserts pullChartTimeoutError.
 func IsPullChartTimeout(err error) bool {
-	if err == nil {
-		return false
-	}
-
-	c := microerror.Cause(err)
-
-	if c == pullChartTimeoutError {
+	if errors.Is(err, pullChartTimeoutError) {
 		return true
 	}
 
-	netErr, ok := err.(net.Error)
-	if !ok {
-		return false
-	}
-
-	return netErr.Timeout()
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
 
 var releaseAlreadyExistsError = &microerror.Error{
@@ -233,26 +192,17 @@ var releaseAlreadyExistsError = &microerror.Error{
 
 // IsReleaseAlreadyExists asserts releaseAlreadyExistsError.
 func IsReleaseAlreadyExists(err error) bool {
-	if err == nil {
-		return false
-	}
-
-	c := microerror.Cause(err)
-
-	if errors.Is(err, driver.ErrReleaseExists) {
-		return true
-	}
-	if c == releaseAlreadyExistsError {
-		return true
-	}
+	return isHelmError(err, releaseAlreadyExistsError)
+}
 
-	return false
+var releaseLockedError = &microerror.Error{
+	Kind: "releaseLockedError",
 }
 
-const (
-	releaseNameInvalidErrorPrefix = "invalid release name"
-	releaseNameInvalidErrorSuffix = "and the length must not be longer than 53"
-)
+// IsReleaseLocked asserts releaseLockedError.
+func IsReleaseLocked(err error) bool {
+	return errors.Is(err, releaseLockedError)
+}
 
 var releaseNameInvalidError = &microerror.Error{
 	Kind: "releaseNameInvalidError",
@@ -260,49 +210,16 @@ var releaseNameInvalidError = &microerror.Error{
 
 // IsReleaseNameInvalid asserts releaseNameInvalidError.
 func IsReleaseNameInvalid(err error) bool {
-	if err == nil {
-		return false
-	}
-
-	c := microerror.Cause(err)
-
-	if strings.HasPrefix(c.Error(), releaseNameInvalidErrorPrefix) {
-		return true
-	}
-	if strings.HasSuffix(c.Error(), releaseNameInvalidErrorSuffix) {
-		return true
-	}
-	if c == releaseNameInvalidError {
-		return true
-	}
-
-	return false
+	return isHelmError(err, releaseNameInvalidError)
 }
 
-const (
-	releaseNotDeployedErrorSuffix = "has no deployed releases"
-)
-
 var releaseNotDeployedError = &microerror.Error{
 	Kind: "releaseNotDeployedError",
 }
 
 // IsReleaseNotDeployed asserts releaseNotDeployedError.
 func IsReleaseNotDeployed(err error) bool {
-	if err == nil {
-		return false
-	}
-
-	c := microerror.Cause(err)
-
-	if strings.HasSuffix(c.Error(), releaseNotDeployedErrorSuffix) {
-		return true
-	}
-	if c == releaseNotDeployedError {
-		return true
-	}
-
-	return false
+	return isHelmError(err, releaseNotDeployedError)
 }
 
 var releaseNotFoundError = &microerror.Error{
@@ -311,25 +228,26 @@ var releaseNotFoundError = &microerror.Error{
 
 // IsReleaseNotFound asserts releaseNotFoundError.
 func IsReleaseNotFound(err error) bool {
-	if err == nil {
-		return false
-	}
+	return isHelmError(err, releaseNotFoundError)
+}
 
-	c := microerror.Cause(err)
+var releaseNotStaleError = &microerror.Error{
+	Kind: "releaseNotStaleError",
+}
 
-	if errors.Is(err, driver.ErrReleaseNotFound) {
-		return true
-	}
-	if c == releaseNotFoundError {
-		return true
-	}
+// IsReleaseNotStale asserts releaseNotStaleError.
+func IsReleaseNotStale(err error) bool {
+	return errors.Is(err, releaseNotStaleError)
+}
 
-	return false
+var releaseNotStuckError = &microerror.Error{
+	Kind: "releaseNotStuckError",
 }
 
-var (
-	tarballNotFoundRegexp = regexp.MustCompile(`stat \S+: no such file or directory`)
-)
+// IsReleaseNotStuck asserts releaseNotStuckError.
+func IsReleaseNotStuck(err error) bool {
+	return errors.Is(err, releaseNotStuckError)
+}
 
 var tarballNotFoundError = &microerror.Error{
 	Kind: "tarballNotFoundError",
@@ -337,20 +255,7 @@ var tarballNotFoundError = &microerror.Error{
 
 // IsTarballNotFound asserts tarballNotFoundError.
 func IsTarballNotFound(err error) bool {
-	if err == nil {
-		return false
-	}
-
-	c := microerror.Cause(err)
-
-	if c == tarballNotFoundError {
-		return true
-	}
-	if tarballNotFoundRegexp.MatchString(c.Error()) {
-		return true
-	}
-
-	return false
+	return isHelmError(err, tarballNotFoundError)
 }
 
 var testReleaseFailureError = &microerror.Error{
@@ -359,7 +264,7 @@ var testReleaseFailureError = &microerror.Error{
 
 // IsTestReleaseFailure asserts testReleaseFailureError.
 func IsTestReleaseFailure(err error) bool {
-	return microerror.Cause(err) == testReleaseFailureError
+	return errors.Is(err, testReleaseFailureError)
 }
 
 var testReleaseTimeoutError = &microerror.Error{
@@ -368,7 +273,7 @@ var testReleaseTimeoutError = &microerror.Error{
 
 // IsTestReleaseTimeout asserts testReleaseTimeoutError.
 func IsTestReleaseTimeout(err error) bool {
-	return microerror.Cause(err) == testReleaseTimeoutError
+	return errors.Is(err, testReleaseTimeoutError)
 }
 
 var tooManyResultsError = &microerror.Error{
@@ -377,57 +282,23 @@ var tooManyResultsError = &microerror.Error{
 
 // IsTooManyResults asserts tooManyResultsError.
 func IsTooManyResults(err error) bool {
-	return microerror.Cause(err) == tooManyResultsError
+	return errors.Is(err, tooManyResultsError)
 }
 
-var (
-	yamlConversionFailedErrorText = "error converting YAML to JSON:"
-)
-
 var yamlConversionFailedError = &microerror.Error{
 	Kind: "yamlConversionFailedError",
 }
 
 // IsYamlConversionFailed asserts yamlConversionFailedError.
 func IsYamlConversionFailed(err error) bool {
-	if err == nil {
-		return false
-	}
-
-	c := microerror.Cause(err)
-
-	if c == yamlConversionFailedError {
-		return true
-	}
-	if strings.Contains(c.Error(), yamlConversionFailedErrorText) {
-		return true
-	}
-
-	return false
+	return isHelmError(err, yamlConversionFailedError)
 }
 
-var (
-	validationFailedErrorText = "error validating data"
-)
-
 var validationFailedError = &microerror.Error{
 	Kind: "validationFailedError",
 }
 
 // IsValidationFailedError asserts validationFailedError.
 func IsValidationFailedError(err error) bool {
-	if err == nil {
-		return false
-	}
-
-	c := microerror.Cause(err)
-
-	if c == validationFailedError {
-		return true
-	}
-	if strings.Contains(c.Error(), validationFailedErrorText) {
-		return true
-	}
-
-	return false
+	return isHelmError(err, validationFailedError)
 }
@@ -0,0 +1,382 @@
+package helmclient
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/giantswarm/microerror"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// Test_translateHelmError is the corpus of the errors Helm returns. Whenever
+// Helm changes a message it must be added here.
+func Test_translateHelmError(t *testing.T) {
+	testCases := []struct {
+		name          string
+		err           error
+		expectedError error
+		matchers      []string
+		sentinel      error
+	}{
+		{
+			name: "case 0: install conflicts with unowned object",
+			err:  fmt.Errorf("Unable to continue with install: %w", errors.New(`ConfigMap "app-config" in namespace "default" exists and cannot be imported into the current release: invalid ownership metadata; label validation error: missing key "app.kubernetes.io/managed-by": must be set to "Helm"; annotation validation error: missing key "meta.helm.sh/release-name": must be set to "app"; annotation validation error: missing key "meta.helm.sh/release-namespace": must be set to "default"`)),
+			expectedError: &ResourceAlreadyExistsError{
+				Object: ObjectReference{
+					Kind:      "ConfigMap",
+					Name:      "app-config",
+					Namespace: "default",
+				},
+				ReleaseName: "app",
+			},
+			matchers: []string{"IsResourceAlreadyExists"},
+		},
+		{
+			name: "case 1: upgrade conflicts with object of other release",
+			err:  fmt.Errorf("Unable to continue with update: %w", errors.New(`Deployment "web" in namespace "prod" exists and cannot be imported into the current release: invalid ownership metadata; annotation validation error: key "meta.helm.sh/release-name" must equal "app": current value is "legacy-web"; annotation validation error: key "meta.helm.sh/release-namespace" must equal "default": current value is "legacy"`)),
+			expectedError: &ResourceAlreadyExistsError{
+				Object: ObjectReference{
+					Kind:      "Deployment",
+					Name:      "web",
+					Namespace: "prod",
+				},
+				OwnerReleaseName:      "legacy-web",
+				OwnerReleaseNamespace: "legacy",
+				ReleaseName:           "app",
+			},
+			matchers: []string{"IsResourceAlreadyExists"},
+		},
+		{
+			name: "case 2: install conflicts with cluster scoped object",
+			err:  fmt.Errorf("Unable to continue with install: %w", errors.New(`ClusterRole "viewer" in namespace "" exists and cannot be imported into the current release: invalid ownership metadata; label validation error: missing key "app.kubernetes.io/managed-by": must be set to "Helm"`)),
+			expectedError: &ResourceAlreadyExistsError{
+				Object: ObjectReference{
+					Kind: "ClusterRole",
+					Name: "viewer",
+				},
+				ReleaseName: "app",
+			},
+			matchers: []string{"IsResourceAlreadyExists"},
+		},
+		{
+			name: "case 3: conflict of Helm before v3.2.0",
+			err:  errors.New("rendered manifests contain a resource that already exists. Unable to continue with install: existing resource conflict: namespace: default, name: foo, existing_kind: /v1, Kind=ConfigMap, new_kind: /v1, Kind=ConfigMap"),
+			expectedError: &ResourceAlreadyExistsError{
+				Object: ObjectReference{
+					APIVersion: "v1",
+					Kind:       "ConfigMap",
+					Name:       "foo",
+					Namespace:  "default",
+				},
+				ReleaseName: "app",
+			},
+			matchers: []string{"IsResourceAlreadyExists"},
+		},
+		{
+			name: "case 4: name still in use",
+			err:  errors.New("cannot re-use a name that is still in use"),
+			expectedError: &CannotReuseReleaseError{
+				Namespace:   "default",
+				ReleaseName: "app",
+			},
+			matchers: []string{"IsCannotReuseRelease"},
+		},
+		{
+			name: "case 5: invalid release name",
+			err:  errors.New(`invalid release name, must match regex ^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$ and the length must not be longer than 53`),
+			expectedError: &ReleaseNameInvalidError{
+				ReleaseName: "app",
+			},
+			matchers: []string{"IsReleaseNameInvalid"},
+		},
+		{
+			name: "case 6: install manifest fails validation",
+			err:  fmt.Errorf("unable to build kubernetes objects from release manifest: %w", errors.New(`error validating "": error validating data: ValidationError(Deployment.spec): missing required field "selector" in io.k8s.api.apps.v1.DeploymentSpec`)),
+			expectedError: &InvalidManifestError{
+				Manifest: "release",
+				Reason:   `error validating "": error validating data: ValidationError(Deployment.spec): missing required field "selector" in io.k8s.api.apps.v1.DeploymentSpec`,
+			},
+			matchers: []string{"IsInvalidManifest", "IsValidationFailedError"},
+		},
+		{
+			name: "case 7: upgrade manifest contains unknown kind",
+			err:  fmt.Errorf("unable to build kubernetes objects from new release manifest: %w", errors.New(`resource mapping not found for name: "foo" namespace: "" from "": no matches for kind "Foo" in version "example.com/v1"`)),
+			expectedError: &InvalidManifestError{
+				Manifest: "new release",
+				Reason:   `resource mapping not found for name: "foo" namespace: "" from "": no matches for kind "Foo" in version "example.com/v1"`,
+			},
+			matchers: []string{"IsInvalidManifest"},
+		},
+		{
+			name: "case 8: rollback of invalid current manifest",
+			err:  fmt.Errorf("unable to build kubernetes objects from current release manifest: %w", errors.New(`error validating "": error validating data: unknown object type "nil" in ConfigMap.data.foo`)),
+			expectedError: &InvalidManifestError{
+				Manifest: "current release",
+				Reason:   `error validating "": error validating data: unknown object type "nil" in ConfigMap.data.foo`,
+			},
+			matchers: []string{"IsInvalidManifest", "IsValidationFailedError"},
+		},
+		{
+			name: "case 9: release not found",
+			err:  driver.ErrReleaseNotFound,
+			expectedError: &ReleaseNotFoundError{
+				Namespace:   "default",
+				ReleaseName: "app",
+			},
+			matchers: []string{"IsReleaseNotFound"},
+			sentinel: driver.ErrReleaseNotFound,
+		},
+		{
+			name: "case 10: release has no deployed revision",
+			err:  fmt.Errorf("%q has no deployed releases", "app"),
+			expectedError: &ReleaseNotDeployedError{
+				Namespace:   "default",
+				ReleaseName: "app",
+			},
+			matchers: []string{"IsReleaseNotDeployed"},
+		},
+		{
+			name: "case 11: release name reported by storage driver",
+			err:  driver.NewErrNoDeployedReleases("other"),
+			expectedError: &ReleaseNotDeployedError{
+				Namespace:   "default",
+				ReleaseName: "other",
+			},
+			matchers: []string{"IsReleaseNotDeployed"},
+			sentinel: driver.ErrNoDeployedReleases,
+		},
+		{
+			name: "case 12: chart templates are empty",
+			err:  fmt.Errorf("release app failed: %w", kube.ErrNoObjectsVisited),
+			expectedError: &EmptyChartTemplatesError{
+				Namespace:   "default",
+				ReleaseName: "app",
+			},
+			matchers: []string{"IsEmptyChartTemplates"},
+			sentinel: kube.ErrNoObjectsVisited,
+		},
+		{
+			name:     "case 13: release exists",
+			err:      driver.ErrReleaseExists,
+			matchers: []string{"IsReleaseAlreadyExists"},
+			sentinel: driver.ErrReleaseExists,
+		},
+		{
+			name:     "case 14: chart is not gzipped",
+			err:      gzip.ErrHeader,
+			matchers: []string{"IsInvalidGZipHeader"},
+			sentinel: gzip.ErrHeader,
+		},
+		{
+			name:     "case 15: chart tarball does not exist",
+			err:      &fs.PathError{Op: "stat", Path: "/tmp/chart.tgz", Err: syscall.ENOENT},
+			matchers: []string{"IsTarballNotFound"},
+			sentinel: fs.ErrNotExist,
+		},
+		{
+			name:     "case 16: template is no valid YAML",
+			err:      fmt.Errorf("YAML parse error on app/templates/configmap.yaml: %w", errors.New("error converting YAML to JSON: yaml: line 3: mapping values are not allowed in this context")),
+			matchers: []string{"IsYamlConversionFailed"},
+		},
+		{
+			name: "case 17: unknown error",
+			err:  errors.New("connection refused"),
+		},
+	}
+
+	allMatchers := map[string]func(error) bool{
+		"IsCannotReuseRelease":    IsCannotReuseRelease,
+		"IsEmptyChartTemplates":   IsEmptyChartTemplates,
+		"IsInvalidGZipHeader":     IsInvalidGZipHeader,
+		"IsInvalidManifest":       IsInvalidManifest,
+		"IsReleaseAlreadyExists":  IsReleaseAlreadyExists,
+		"IsReleaseNameInvalid":    IsReleaseNameInvalid,
+		"IsReleaseNotDeployed":    IsReleaseNotDeployed,
+		"IsReleaseNotFound":       IsReleaseNotFound,
+		"IsResourceAlreadyExists": IsResourceAlreadyExists,
+		"IsTarballNotFound":       IsTarballNotFound,
+		"IsValidationFailedError": IsValidationFailedError,
+		"IsYamlConversionFailed":  IsYamlConversionFailed,
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			err := microerror.Mask(translateHelmError(microerror.Mask(tc.err), "default", "app"))
+
+			if err.Error() != tc.err.Error() {
+				t.Fatalf("want message %q, got %q", tc.err.Error(), err.Error())
+			}
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("want original error to be wrapped")
+			}
+			if tc.sentinel != nil && !errors.Is(err, tc.sentinel) {
+				t.Fatalf("want %v to be wrapped", tc.sentinel)
+			}
+
+			for name, matcher := range allMatchers {
+				expected := slices.Contains(tc.matchers, name)
+				if matcher(err) != expected {
+					t.Fatalf("want %s to return %t", name, expected)
+				}
+			}
+
+			if tc.expectedError != nil {
+				target := reflect.New(reflect.TypeOf(tc.expectedError))
+				if !errors.As(err, target.Interface()) {
+					t.Fatalf("want %T, got %#v", tc.expectedError, err)
+				}
+				opts := cmpopts.IgnoreUnexported(
+					CannotReuseReleaseError{},
+					EmptyChartTemplatesError{},
+					InvalidManifestError{},
+					ReleaseNameInvalidError{},
+					ReleaseNotDeployedError{},
+					ReleaseNotFoundError{},
+					ResourceAlreadyExistsError{},
+				)
+				if diff := cmp.Diff(tc.expectedError, target.Elem().Interface(), opts); diff != "" {
+					t.Fatalf("want matching error \n %s", diff)
+				}
+			}
+
+			if translated := translateHelmError(err, "default", "other"); translated != err {
+				t.Fatalf("want translated error to be returned as is")
+			}
+
+			// Errors which were not translated, e.g. errors returned by Helm
+			// directly or built by callers, must match as well.
+			untranslated := []error{
+				tc.err,
+				microerror.Mask(tc.err),
+				fmt.Errorf("installing release: %w", tc.err),
+			}
+			for _, err := range untranslated {
+				for name, matcher := range allMatchers {
+					expected := slices.Contains(tc.matchers, name)
+					if matcher(err) != expected {
+						t.Fatalf("want %s to return %t for untranslated error %q", name, expected, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func Test_IsPullChartTimeout(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name:     "case 0: pull chart timeout",
+			err:      microerror.Maskf(pullChartTimeoutError, "timeout"),
+			expected: true,
+		},
+		{
+			name:     "case 1: wrapped network timeout",
+			err:      microerror.Mask(fmt.Errorf("pulling chart: %w", &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded})),
+			expected: true,
+		},
+		{
+			name:     "case 2: network error without timeout",
+			err:      microerror.Mask(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}),
+			expected: false,
+		},
+		{
+			name:     "case 3: nil error",
+			err:      nil,
+			expected: false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			if IsPullChartTimeout(tc.err) != tc.expected {
+				t.Fatalf("expected %t got %t", tc.expected, !tc.expected)
+			}
+		})
+	}
+}
+
+func Test_translateHelmError_builtObjects(t *testing.T) {
+	deployment := &resource.Info{
+		Name:      "web",
+		Namespace: "prod",
+		Mapping: &meta.RESTMapping{
+			GroupVersionKind: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+		},
+	}
+	clusterRole := &resource.Info{
+		Name: "viewer",
+		Mapping: &meta.RESTMapping{
+			GroupVersionKind: schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"},
+		},
+	}
+
+	testCases := []struct {
+		name               string
+		err                error
+		expectedAPIVersion string
+	}{
+		{
+			name:               "case 0: namespaced object is resolved",
+			err:                errors.New(`Unable to continue with install: Deployment "web" in namespace "prod" exists and cannot be imported into the current release: invalid ownership metadata`),
+			expectedAPIVersion: "apps/v1",
+		},
+		{
+			name:               "case 1: cluster scoped object is resolved",
+			err:                errors.New(`Unable to continue with install: ClusterRole "viewer" in namespace "" exists and cannot be imported into the current release: invalid ownership metadata`),
+			expectedAPIVersion: "rbac.authorization.k8s.io/v1",
+		},
+		{
+			name:               "case 2: object which was not built is not resolved",
+			err:                errors.New(`Unable to continue with install: Deployment "web" in namespace "default" exists and cannot be imported into the current release: invalid ownership metadata`),
+			expectedAPIVersion: "",
+		},
+		{
+			name:               "case 3: API version reported by Helm is kept",
+			err:                errors.New("rendered manifests contain a resource that already exists. Unable to continue with install: existing resource conflict: namespace: prod, name: web, existing_kind: apps/v1beta1, Kind=Deployment, new_kind: apps/v1beta1, Kind=Deployment"),
+			expectedAPIVersion: "apps/v1beta1",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			kubeClient := &recordingKubeClient{
+				built: kube.ResourceList{deployment, clusterRole},
+			}
+
+			err := translateHelmError(microerror.Mask(kubeClient.withBuiltObjects(tc.err)), "default", "app")
+
+			var conflict *ResourceAlreadyExistsError
+			if !errors.As(err, &conflict) {
+				t.Fatalf("want %T, got %#v", conflict, err)
+			}
+			if conflict.Object.APIVersion != tc.expectedAPIVersion {
+				t.Fatalf("expected API version %#q got %#q", tc.expectedAPIVersion, conflict.Object.APIVersion)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package helmclient
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// maxEventMessageLength is the maximum length of the message of a
+	// Kubernetes Event recorded by the client. Longer messages, e.g. of
+	// errors including hook logs, are truncated.
+	maxEventMessageLength = 1024
+)
+
+// Reasons of the Kubernetes Events recorded for release operations.
+const (
+	EventReasonDeleteFailed      = "DeleteFailed"
+	EventReasonDeleteSucceeded   = "DeleteSucceeded"
+	EventReasonHookFailed        = "HookFailed"
+	EventReasonInstallFailed     = "InstallFailed"
+	EventReasonInstallSucceeded  = "InstallSucceeded"
+	EventReasonRollbackFailed    = "RollbackFailed"
+	EventReasonRollbackSucceeded = "RollbackSucceeded"
+	EventReasonTestFailed        = "TestFailed"
+	EventReasonTestSucceeded     = "TestSucceeded"
+	EventReasonUpgradeFailed     = "UpgradeFailed"
+	EventReasonUpgradeSucceeded  = "UpgradeSucceeded"
+)
+
+// releaseOperation describes an operation on a release for which Kubernetes
+// Events are recorded.
+type releaseOperation struct {
+	// name is used in messages of failed operations, e.g. "Failed to
+	// install".
+	name string
+	// done is used in messages of succeeded operations, e.g. "Installed".
+	done            string
+	reasonFailed    string
+	reasonSucceeded string
+}
+
+var (
+	deleteOperation   = releaseOperation{name: "delete", done: "Deleted", reasonFailed: EventReasonDeleteFailed, reasonSucceeded: EventReasonDeleteSucceeded}
+	installOperation  = releaseOperation{name: "install", done: "Installed", reasonFailed: EventReasonInstallFailed, reasonSucceeded: EventReasonInstallSucceeded}
+	rollbackOperation = releaseOperation{name: "roll back", done: "Rolled back", reasonFailed: EventReasonRollbackFailed, reasonSucceeded: EventReasonRollbackSucceeded}
+	testOperation     = releaseOperation{name: "test", done: "Tested", reasonFailed: EventReasonTestFailed, reasonSucceeded: EventReasonTestSucceeded}
+	upgradeOperation  = releaseOperation{name: "upgrade", done: "Upgraded", reasonFailed: EventReasonUpgradeFailed, reasonSucceeded: EventReasonUpgradeSucceeded}
+)
+
+// recordEvent records a Kubernetes Event about the outcome of the operation
+// on the given release against object. Nothing is recorded if no event
+// recorder is configured or object is nil. Failed hooks are recorded with
+// EventReasonHookFailed instead of the failure reason of the operation.
+func (c *Client) recordEvent(object runtime.Object, operation releaseOperation, namespace, releaseName string, err error) {
+	if c.eventRecorder == nil || object == nil {
+		return
+	}
+
+	if err == nil {
+		c.eventRecorder.Event(object, corev1.EventTypeNormal, operation.reasonSucceeded, fmt.Sprintf("%s release %#q in namespace %#q", operation.done, releaseName, namespace))
+		return
+	}
+
+	reason := operation.reasonFailed
+	if IsHookFailed(err) {
+		reason = EventReasonHookFailed
+	}
+
+	message := fmt.Sprintf("Failed to %s release %#q in namespace %#q: %s", operation.name, releaseName, namespace, err)
+
+	c.eventRecorder.Event(object, corev1.EventTypeWarning, reason, truncateMessage(message, maxEventMessageLength))
+}
+
+// truncateMessage shortens the message to at most max bytes. It is cut on a
+// rune boundary so that the result stays valid UTF-8.
+func truncateMessage(message string, max int) string {
+	if len(message) <= max {
+		return message
+	}
+
+	cut := max - 3
+	for cut > 0 && !utf8.RuneStart(message[cut]) {
+		cut--
+	}
+
+	return message[:cut] + "..."
+}
@@ -0,0 +1,155 @@
+package helmclient
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/giantswarm/microerror"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+func Test_recordEvent(t *testing.T) {
+	object := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app",
+			Namespace: "default",
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		object        runtime.Object
+		operation     releaseOperation
+		err           error
+		expectedEvent string
+	}{
+		{
+			name:          "case 0: succeeded install",
+			object:        object,
+			operation:     installOperation,
+			expectedEvent: "Normal InstallSucceeded Installed release `test` in namespace `default`",
+		},
+		{
+			name:          "case 1: failed upgrade",
+			object:        object,
+			operation:     upgradeOperation,
+			err:           microerror.Maskf(executionFailedError, "boom"),
+			expectedEvent: "Warning UpgradeFailed Failed to upgrade release `test` in namespace `default`: execution failed error: boom",
+		},
+		{
+			name:      "case 2: failed hook",
+			object:    object,
+			operation: installOperation,
+			err: microerror.Mask(&HookFailedError{
+				Events:      []string{"pre-install"},
+				Hook:        "migrate",
+				Kind:        "Job",
+				ReleaseName: "test",
+				err:         microerror.Maskf(executionFailedError, "boom"),
+			}),
+			expectedEvent: "Warning HookFailed Failed to install release `test` in namespace `default`: pre-install hook `migrate` of kind `Job` for release `test` failed: execution failed error: boom",
+		},
+		{
+			name:      "case 3: no object",
+			operation: deleteOperation,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			recorder := record.NewFakeRecorder(1)
+			c := &Client{
+				eventRecorder: recorder,
+			}
+
+			c.recordEvent(tc.object, tc.operation, "default", "test", tc.err)
+
+			select {
+			case event := <-recorder.Events:
+				if event != tc.expectedEvent {
+					t.Fatalf("expected event %q got %q", tc.expectedEvent, event)
+				}
+			default:
+				if tc.expectedEvent != "" {
+					t.Fatalf("expected event %q got none", tc.expectedEvent)
+				}
+			}
+		})
+	}
+}
+
+func Test_recordEvent_truncatesMessage(t *testing.T) {
+	recorder := record.NewFakeRecorder(1)
+	c := &Client{
+		eventRecorder: recorder,
+	}
+
+	c.recordEvent(&corev1.ConfigMap{}, testOperation, "default", "test", microerror.Maskf(executionFailedError, "%s", strings.Repeat("x", 2*maxEventMessageLength)))
+
+	event := <-recorder.Events
+	message := strings.TrimPrefix(event, "Warning TestFailed ")
+	if len(message) != maxEventMessageLength {
+		t.Fatalf("expected message length %d got %d", maxEventMessageLength, len(message))
+	}
+}
+
+func Test_truncateMessage(t *testing.T) {
+	testCases := []struct {
+		name            string
+		message         string
+		expectedMessage string
+	}{
+		{
+			name:            "case 0: short message is kept",
+			message:         "failed",
+			expectedMessage: "failed",
+		},
+		{
+			name:            "case 1: message of maximum length is kept",
+			message:         "0123456789",
+			expectedMessage: "0123456789",
+		},
+		{
+			name:            "case 2: long message is truncated",
+			message:         "0123456789a",
+			expectedMessage: "0123456...",
+		},
+		{
+			name:            "case 3: short message with multi-byte rune is kept",
+			message:         "01234€",
+			expectedMessage: "01234€",
+		},
+		{
+			name:            "case 4: multi-byte rune is not split",
+			message:         "012345€789",
+			expectedMessage: "012345...",
+		},
+		{
+			name:            "case 5: message of multi-byte runes only",
+			message:         "üüüüüü",
+			expectedMessage: "üüü...",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			message := truncateMessage(tc.message, 10)
+			if message != tc.expectedMessage {
+				t.Fatalf("expected message %q got %q", tc.expectedMessage, message)
+			}
+			if len(message) > 10 {
+				t.Fatalf("expected message of at most %d bytes got %d", 10, len(message))
+			}
+			if !utf8.ValidString(message) {
+				t.Fatalf("expected valid UTF-8 got %q", message)
+			}
+		})
+	}
+}
@@ -1,43 +1,176 @@
 package helmclient
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"io"
 
 	"github.com/giantswarm/microerror"
-	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
 )
 
 // GetReleaseContent gets the current status of the Helm Release including any
 // values provided when the chart was installed. The releaseName is the name
-// of the Helm Release that is set when the Helm Chart is installed.
-func (c *Client) GetReleaseContent(ctx context.Context, namespace, releaseName string) (*ReleaseContent, error) {
+// of the Helm Release that is set when the Helm Chart is installed. The
+// options control which additional parts of the release like the rendered
+// manifest are included.
+func (c *Client) GetReleaseContent(ctx context.Context, namespace, releaseName string, options GetOptions) (*ReleaseContent, error) {
 	eventName := "get_release_content"
 
-	t := prometheus.NewTimer(histogram.WithLabelValues(eventName))
-	defer t.ObserveDuration()
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeReleaseNamespace, namespace),
+		attribute.String(attributeReleaseName, releaseName),
+	))
+	defer span.End()
 
-	releaseContent, err := c.getReleaseContent(ctx, namespace, releaseName)
+	m := c.metrics.observe(eventName, namespace)
+	defer m.stop()
+
+	releaseContent, err := c.getReleaseContent(ctx, namespace, releaseName, 0, options)
+	err = translateHelmError(err, namespace, releaseName)
 	if err != nil {
-		errorGauge.WithLabelValues(eventName).Inc()
+		m.fail()
+		recordSpanError(span, err)
 		return nil, microerror.Mask(err)
 	}
 
 	return releaseContent, nil
 }
 
-func (c *Client) getReleaseContent(ctx context.Context, namespace, releaseName string) (*ReleaseContent, error) {
+// getReleaseContent gets the given revision of the release. Revision 0 is
+// the latest revision.
+func (c *Client) getReleaseContent(ctx context.Context, namespace, releaseName string, revision int, options GetOptions) (*ReleaseContent, error) {
 	cfg, err := c.newActionConfig(ctx, namespace)
 	if err != nil {
 		return nil, microerror.Mask(err)
 	}
 
 	get := action.NewGet(cfg)
+	get.Version = revision
 
 	res, err := get.Run(releaseName)
 	if err != nil {
 		return nil, microerror.Mask(err)
 	}
 
-	return releaseToReleaseContent(res), nil
+	releaseContent := releaseToReleaseContent(res)
+
+	err = options.populate(releaseContent, res)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return releaseContent, nil
+}
+
+// populate adds the optional parts of the release selected by the options to
+// the given release content.
+func (options GetOptions) populate(releaseContent *ReleaseContent, res *release.Release) error {
+	if options.IncludeManifest {
+		objects, err := parseManifest(res.Manifest)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		releaseContent.Manifest = res.Manifest
+		releaseContent.Objects = objects
+	}
+
+	if options.IncludeHooks {
+		for _, hook := range res.Hooks {
+			releaseContent.Hooks = append(releaseContent.Hooks, hookToReleaseHook(hook))
+		}
+	}
+
+	if options.IncludeNotes && res.Info != nil {
+		releaseContent.Notes = res.Info.Notes
+	}
+
+	if options.IncludeComputedValues && res.Chart != nil {
+		computed, err := chartutil.CoalesceValues(res.Chart, res.Config)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		releaseContent.ChartValues = res.Chart.Values
+		releaseContent.ComputedValues = computed
+	}
+
+	return nil
+}
+
+func hookToReleaseHook(hook *release.Hook) ReleaseHook {
+	releaseHook := ReleaseHook{
+		CompletedAt: hook.LastRun.CompletedAt.Time,
+		Kind:        hook.Kind,
+		Name:        hook.Name,
+		Path:        hook.Path,
+		Phase:       hook.LastRun.Phase.String(),
+		StartedAt:   hook.LastRun.StartedAt.Time,
+		Weight:      hook.Weight,
+	}
+
+	for _, event := range hook.Events {
+		releaseHook.Events = append(releaseHook.Events, event.String())
+	}
+
+	return releaseHook
+}
+
+// parseManifest parses the multi document YAML manifest rendered by Helm into
+// unstructured objects. Empty documents are skipped.
+func parseManifest(manifest string) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewBufferString(manifest), 4096)
+
+	for {
+		var object map[string]interface{}
+
+		err := decoder.Decode(&object)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, microerror.Maskf(invalidManifestError, "%s", err)
+		}
+
+		if len(object) == 0 {
+			continue
+		}
+
+		objects = append(objects, &unstructured.Unstructured{Object: object})
+	}
+
+	return objects, nil
+}
+
+// objectResource returns the dynamic client for the given object of a
+// manifest. Namespaced objects without a namespace are expected in the given
+// namespace.
+func (c *Client) objectResource(o *unstructured.Unstructured, namespace string) (dynamic.ResourceInterface, error) {
+	gvk := o.GroupVersionKind()
+
+	mapping, err := c.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return c.dynamicClient.Resource(mapping.Resource), nil
+	}
+
+	if o.GetNamespace() != "" {
+		namespace = o.GetNamespace()
+	}
+
+	return c.dynamicClient.Resource(mapping.Resource).Namespace(namespace), nil
 }
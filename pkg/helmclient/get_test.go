@@ -0,0 +1,198 @@
+package helmclient
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	helmtime "helm.sh/helm/v3/pkg/time"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func Test_GetOptions_populate(t *testing.T) {
+	manifest := "---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n"
+
+	testCases := []struct {
+		name            string
+		options         GetOptions
+		manifest        string
+		expectedContent *ReleaseContent
+		errorMatcher    func(error) bool
+	}{
+		{
+			name:            "case 0: nothing included by default",
+			options:         GetOptions{},
+			manifest:        manifest,
+			expectedContent: &ReleaseContent{},
+		},
+		{
+			name:     "case 1: manifest",
+			options:  GetOptions{IncludeManifest: true},
+			manifest: manifest,
+			expectedContent: &ReleaseContent{
+				Manifest: manifest,
+				Objects: []*unstructured.Unstructured{
+					{
+						Object: map[string]interface{}{
+							"apiVersion": "v1",
+							"kind":       "ConfigMap",
+							"metadata":   map[string]interface{}{"name": "config"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:         "case 2: invalid manifest",
+			options:      GetOptions{IncludeManifest: true},
+			manifest:     "---\nkind: [\n",
+			errorMatcher: IsInvalidManifest,
+		},
+		{
+			name:     "case 3: hooks and notes",
+			options:  GetOptions{IncludeHooks: true, IncludeNotes: true},
+			manifest: manifest,
+			expectedContent: &ReleaseContent{
+				Hooks: []ReleaseHook{
+					{Events: []string{"pre-install"}, Kind: "Job", Name: "migrate", Path: "foo/templates/migrate.yaml"},
+				},
+				Notes: "Thank you for installing foo.",
+			},
+		},
+		{
+			name:     "case 4: computed values",
+			options:  GetOptions{IncludeComputedValues: true},
+			manifest: manifest,
+			expectedContent: &ReleaseContent{
+				ChartValues: map[string]interface{}{
+					"replicas": 1,
+					"image":    "foo",
+				},
+				ComputedValues: map[string]interface{}{
+					"replicas": 3,
+					"image":    "foo",
+				},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			res := &release.Release{
+				Name:     "foo",
+				Manifest: tc.manifest,
+				Hooks: []*release.Hook{
+					{
+						Events: []release.HookEvent{release.HookPreInstall},
+						Kind:   "Job",
+						Name:   "migrate",
+						Path:   "foo/templates/migrate.yaml",
+					},
+				},
+				Info: &release.Info{
+					Notes: "Thank you for installing foo.",
+				},
+				Chart: &chart.Chart{
+					Metadata: &chart.Metadata{Name: "foo", Version: "1.0.0"},
+					Values: map[string]interface{}{
+						"replicas": 1,
+						"image":    "foo",
+					},
+				},
+				Config: map[string]interface{}{
+					"replicas": 3,
+				},
+			}
+
+			releaseContent := &ReleaseContent{}
+			err := tc.options.populate(releaseContent, res)
+
+			switch {
+			case err == nil && tc.errorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(tc.expectedContent, releaseContent); diff != "" {
+				t.Fatalf("want matching release content \n %s", diff)
+			}
+		})
+	}
+}
+
+func Test_hookToReleaseHook(t *testing.T) {
+	started := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	completed := started.Add(time.Minute)
+
+	testCases := []struct {
+		name         string
+		hook         *release.Hook
+		expectedHook ReleaseHook
+	}{
+		{
+			name: "case 0: hook which never ran",
+			hook: &release.Hook{
+				Events: []release.HookEvent{release.HookPreUpgrade, release.HookPreInstall},
+				Kind:   "Job",
+				Name:   "migrate",
+				Path:   "foo/templates/migrate.yaml",
+				Weight: -5,
+			},
+			expectedHook: ReleaseHook{
+				Events: []string{"pre-upgrade", "pre-install"},
+				Kind:   "Job",
+				Name:   "migrate",
+				Path:   "foo/templates/migrate.yaml",
+				Weight: -5,
+			},
+		},
+		{
+			name: "case 1: hook which ran",
+			hook: &release.Hook{
+				Events: []release.HookEvent{release.HookTest},
+				Kind:   "Pod",
+				Name:   "test",
+				Path:   "foo/templates/tests/test.yaml",
+				LastRun: release.HookExecution{
+					StartedAt:   helmtime.Time{Time: started},
+					CompletedAt: helmtime.Time{Time: completed},
+					Phase:       release.HookPhaseFailed,
+				},
+			},
+			expectedHook: ReleaseHook{
+				CompletedAt: completed,
+				Events:      []string{"test"},
+				Kind:        "Pod",
+				Name:        "test",
+				Path:        "foo/templates/tests/test.yaml",
+				Phase:       "Failed",
+				StartedAt:   started,
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			hook := hookToReleaseHook(tc.hook)
+			if diff := cmp.Diff(tc.expectedHook, hook); diff != "" {
+				t.Fatalf("want matching hook \n %s", diff)
+			}
+		})
+	}
+}
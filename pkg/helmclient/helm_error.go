@@ -0,0 +1,336 @@
+package helmclient
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/giantswarm/microerror"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// Helm only returns sentinel errors for a few failures. All other failures
+// can only be told apart by their messages. The patterns below match the
+// messages of Helm 3. They are covered by the corpus in error_test.go which
+// needs to be extended whenever Helm changes a message.
+var (
+	cannotReuseReleaseText    = "cannot re-use a name that is still in use"
+	emptyChartTemplatesRegexp = regexp.MustCompile(`release \S+ failed: no objects visited`)
+	// existingResourceConflictRegexp matches the conflict message of Helm
+	// releases before v3.2.0.
+	existingResourceConflictRegexp = regexp.MustCompile(`existing resource conflict: (?:kind: \S+, )?namespace: (\S*), name: ([^,]+), existing_kind: ([^,]*), Kind=(\w+)`)
+	invalidGZipHeaderText          = "gzip: invalid header"
+	invalidManifestRegexp          = regexp.MustCompile(`unable to build kubernetes objects from ((?:new |current )?release) manifest: (.*)`)
+	ownerReleaseNameRegexp         = regexp.MustCompile(`key "meta\.helm\.sh/release-name" must equal "[^"]*": current value is "([^"]*)"`)
+	ownerReleaseNamespaceRegexp    = regexp.MustCompile(`key "meta\.helm\.sh/release-namespace" must equal "[^"]*": current value is "([^"]*)"`)
+	releaseNameInvalidText         = "invalid release name"
+	releaseNotDeployedText         = "has no deployed releases"
+	resourceAlreadyExistsRegexp    = regexp.MustCompile(`(\w+) "([^"]+)" in namespace "([^"]*)" exists and cannot be imported into the current release`)
+	resourceAlreadyExistsText      = "rendered manifests contain a resource that already exists"
+	tarballNotFoundRegexp          = regexp.MustCompile(`stat \S+: no such file or directory`)
+	validationFailedText           = "error validating data"
+	yamlConversionFailedText       = "error converting YAML to JSON:"
+)
+
+// helmError is embedded in the typed errors translated from Helm errors. Its
+// Unwrap returns both the matching microerror kind, so that the Is matchers
+// keep working, and the original Helm error, so that Helm's sentinel errors
+// can still be asserted using errors.Is.
+type helmError struct {
+	kind *microerror.Error
+	err  error
+}
+
+func (e *helmError) Error() string {
+	return e.err.Error()
+}
+
+func (e *helmError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+func (e *helmError) translated() {}
+
+// CannotReuseReleaseError is returned when installing a release whose name is
+// still in use by a release which is not uninstalled.
+type CannotReuseReleaseError struct {
+	Namespace   string
+	ReleaseName string
+
+	helmError
+}
+
+// EmptyChartTemplatesError is returned when the rendered templates of a chart
+// contain no objects.
+type EmptyChartTemplatesError struct {
+	Namespace   string
+	ReleaseName string
+
+	helmError
+}
+
+// InvalidManifestError is returned when Helm cannot build Kubernetes objects
+// from a rendered manifest, e.g. because an object does not pass schema
+// validation.
+type InvalidManifestError struct {
+	// Manifest is the manifest which is invalid. One of "release", "new
+	// release" or "current release".
+	Manifest string
+	// Reason is the error Helm reported for the manifest.
+	Reason string
+
+	helmError
+}
+
+// ReleaseNameInvalidError is returned when the release name does not meet
+// Helm's naming rules.
+type ReleaseNameInvalidError struct {
+	ReleaseName string
+
+	helmError
+}
+
+// ReleaseNotDeployedError is returned when upgrading or rolling back a release
+// which has no deployed revision.
+type ReleaseNotDeployedError struct {
+	Namespace   string
+	ReleaseName string
+
+	helmError
+}
+
+// ReleaseNotFoundError is returned when the release does not exist.
+type ReleaseNotFoundError struct {
+	Namespace   string
+	ReleaseName string
+
+	helmError
+}
+
+// ResourceAlreadyExistsError is returned when a rendered object already
+// exists in the cluster and is not owned by the release.
+type ResourceAlreadyExistsError struct {
+	// Object is the conflicting object. Helm 3.2 and newer do not report
+	// its API version, so it is resolved from the rendered manifest.
+	Object ObjectReference
+	// OwnerReleaseName is the release owning the conflicting object if it
+	// is owned by another release.
+	OwnerReleaseName string
+	// OwnerReleaseNamespace is the namespace of the release owning the
+	// conflicting object if it is owned by another release.
+	OwnerReleaseNamespace string
+	ReleaseName           string
+
+	helmError
+}
+
+// translateHelmError translates errors returned by Helm into the typed errors
+// of this package. Errors which are translated already or are not known are
+// returned as they are. The namespace and releaseName are the ones of the
+// failed operation and used when Helm does not report them itself.
+func translateHelmError(err error, namespace, releaseName string) error {
+	if err == nil {
+		return nil
+	}
+
+	var translated interface{ translated() }
+	if errors.As(err, &translated) {
+		return err
+	}
+
+	var storageDriverError *driver.StorageDriverError
+	if errors.As(err, &storageDriverError) && storageDriverError.ReleaseName != "" {
+		releaseName = storageDriverError.ReleaseName
+	}
+
+	message := err.Error()
+
+	switch {
+	case errors.Is(err, driver.ErrReleaseNotFound):
+		return &ReleaseNotFoundError{
+			Namespace:   namespace,
+			ReleaseName: releaseName,
+			helmError:   helmError{kind: releaseNotFoundError, err: err},
+		}
+	case errors.Is(err, driver.ErrNoDeployedReleases) || strings.HasSuffix(message, releaseNotDeployedText):
+		return &ReleaseNotDeployedError{
+			Namespace:   namespace,
+			ReleaseName: releaseName,
+			helmError:   helmError{kind: releaseNotDeployedError, err: err},
+		}
+	case errors.Is(err, driver.ErrReleaseExists):
+		return &helmError{kind: releaseAlreadyExistsError, err: err}
+	case errors.Is(err, kube.ErrNoObjectsVisited) || emptyChartTemplatesRegexp.MatchString(message):
+		return &EmptyChartTemplatesError{
+			Namespace:   namespace,
+			ReleaseName: releaseName,
+			helmError:   helmError{kind: emptyChartTemplatesError, err: err},
+		}
+	case errors.Is(err, gzip.ErrHeader) || strings.HasPrefix(message, invalidGZipHeaderText):
+		return &helmError{kind: invalidGZipHeaderError, err: err}
+	case isTarballNotFound(err) || tarballNotFoundRegexp.MatchString(message):
+		return &helmError{kind: tarballNotFoundError, err: err}
+	case strings.Contains(message, cannotReuseReleaseText):
+		return &CannotReuseReleaseError{
+			Namespace:   namespace,
+			ReleaseName: releaseName,
+			helmError:   helmError{kind: cannotReuseReleaseError, err: err},
+		}
+	case strings.Contains(message, releaseNameInvalidText):
+		return &ReleaseNameInvalidError{
+			ReleaseName: releaseName,
+			helmError:   helmError{kind: releaseNameInvalidError, err: err},
+		}
+	}
+
+	if e := newResourceAlreadyExistsError(err, message, releaseName); e != nil {
+		return e
+	}
+
+	if matches := invalidManifestRegexp.FindStringSubmatch(message); matches != nil {
+		manifestErr := err
+		if strings.Contains(message, validationFailedText) {
+			// Keep asserting schema validation failures as
+			// validationFailedError as well.
+			manifestErr = &helmError{kind: validationFailedError, err: err}
+		}
+
+		return &InvalidManifestError{
+			Manifest:  matches[1],
+			Reason:    matches[2],
+			helmError: helmError{kind: invalidManifestError, err: manifestErr},
+		}
+	}
+
+	switch {
+	case strings.Contains(message, yamlConversionFailedText):
+		return &helmError{kind: yamlConversionFailedError, err: err}
+	case strings.Contains(message, validationFailedText):
+		return &helmError{kind: validationFailedError, err: err}
+	}
+
+	return err
+}
+
+// newResourceAlreadyExistsError returns a ResourceAlreadyExistsError if the
+// message reports a conflict with an existing object or nil otherwise.
+func newResourceAlreadyExistsError(err error, message, releaseName string) *ResourceAlreadyExistsError {
+	e := &ResourceAlreadyExistsError{
+		ReleaseName: releaseName,
+		helmError:   helmError{kind: resourceAlreadyExistsError, err: err},
+	}
+
+	if matches := resourceAlreadyExistsRegexp.FindStringSubmatch(message); matches != nil {
+		e.Object = ObjectReference{
+			Kind:      matches[1],
+			Name:      matches[2],
+			Namespace: matches[3],
+		}
+	} else if matches := existingResourceConflictRegexp.FindStringSubmatch(message); matches != nil {
+		e.Object = ObjectReference{
+			APIVersion: strings.TrimPrefix(matches[3], "/"),
+			Kind:       matches[4],
+			Name:       matches[2],
+			Namespace:  matches[1],
+		}
+	} else if !strings.Contains(message, resourceAlreadyExistsText) {
+		return nil
+	}
+
+	// Helm 3.2 and newer do not report the API version of the conflicting
+	// object. Resolve it from the objects built from the rendered manifest.
+	var builtObjects *builtObjectsError
+	if e.Object.APIVersion == "" && errors.As(err, &builtObjects) {
+		info := builtObjects.builtObject(e.Object.Kind, e.Object.Namespace, e.Object.Name)
+		if info != nil {
+			e.Object.APIVersion = info.Mapping.GroupVersionKind.GroupVersion().String()
+		}
+	}
+
+	if matches := ownerReleaseNameRegexp.FindStringSubmatch(message); matches != nil {
+		e.OwnerReleaseName = matches[1]
+	}
+	if matches := ownerReleaseNamespaceRegexp.FindStringSubmatch(message); matches != nil {
+		e.OwnerReleaseNamespace = matches[1]
+	}
+
+	return e
+}
+
+// recordingKubeClient is a Helm kube client recording the objects of all
+// manifests built during an operation. They are used to resolve the objects
+// Helm reports in errors.
+type recordingKubeClient struct {
+	kubeClient
+
+	mutex sync.Mutex
+	built kube.ResourceList
+}
+
+func (c *recordingKubeClient) Build(reader io.Reader, validate bool) (kube.ResourceList, error) {
+	resources, err := c.kubeClient.Build(reader, validate)
+
+	c.mutex.Lock()
+	c.built = append(c.built, resources...)
+	c.mutex.Unlock()
+
+	return resources, err
+}
+
+// withBuiltObjects returns the given error of a failed operation carrying
+// the objects built so far. When the error is translated, the API version of
+// a conflicting object Helm reports without one is resolved from them.
+func (c *recordingKubeClient) withBuiltObjects(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return &builtObjectsError{
+		built: append(kube.ResourceList{}, c.built...),
+		err:   err,
+	}
+}
+
+// builtObjectsError carries the objects built during a failed operation. It
+// does not change the message of the error it wraps.
+type builtObjectsError struct {
+	built kube.ResourceList
+	err   error
+}
+
+func (e *builtObjectsError) Error() string {
+	return e.err.Error()
+}
+
+func (e *builtObjectsError) Unwrap() error {
+	return e.err
+}
+
+// builtObject returns the most recently built object of the given kind,
+// namespace and name or nil if no such object was built.
+func (e *builtObjectsError) builtObject(kind, namespace, name string) *resource.Info {
+	for i := len(e.built) - 1; i >= 0; i-- {
+		info := e.built[i]
+		if info.Mapping != nil && info.Mapping.GroupVersionKind.Kind == kind && info.Namespace == namespace && info.Name == name {
+			return info
+		}
+	}
+
+	return nil
+}
+
+// isTarballNotFound returns true if the error reports that a chart tarball
+// does not exist.
+func isTarballNotFound(err error) bool {
+	var pathError *fs.PathError
+	return errors.As(err, &pathError) && pathError.Op == "stat" && errors.Is(err, fs.ErrNotExist)
+}
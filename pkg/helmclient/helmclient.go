@@ -4,30 +4,52 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"os"
 	"time"
 
 	kubeconfig "github.com/giantswarm/kubeconfig/v4"
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/micrologger"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/afero"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/kube"
 	"helm.sh/helm/v3/pkg/release"
 	"helm.sh/helm/v3/pkg/storage"
 	"helm.sh/helm/v3/pkg/storage/driver"
 	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 	"oras.land/oras-go/pkg/content"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
 
 // Config represents the configuration used to create a helm client.
 type Config struct {
-	Fs afero.Fs
+	// AuditActor identifies the client in audit records, e.g. the name of
+	// the operator using it. Defaults to the hostname.
+	AuditActor string
+	// AuditSink receives an AuditRecord for every install, upgrade,
+	// rollback, delete, recovery, migration and import of a release. See
+	// NewFileAuditSink and NewConfigMapAuditSink. If this is nil, nothing is
+	// audited.
+	AuditSink AuditSink
+	// EventRecorder records Kubernetes Events about installs, upgrades,
+	// rollbacks, deletes and tests against the object set in the options of
+	// the operation, e.g. InstallOptions.EventObject. If this is nil, no
+	// Events are recorded.
+	EventRecorder record.EventRecorder
+	Fs            afero.Fs
 	// HelmClient sets a helm client used for all operations of the initiated
 	// client. If this is nil, a new helm client will be created. Setting the
 	// helm client here manually might only be sufficient for testing or
@@ -46,19 +68,91 @@ type Config struct {
 	RestMapper      meta.RESTMapper
 
 	HTTPClientTimeout time.Duration
+
+	// MaxHistory is the maximum number of revisions kept per release when
+	// upgrading or rolling back. It can be overridden per operation using
+	// UpdateOptions.MaxHistory and RollbackOptions.MaxHistory. Defaults to 10
+	// which is also the default for Helm 3. A negative value keeps all
+	// revisions.
+	MaxHistory int
+
+	// Registerer is used to register the Prometheus metrics of the client.
+	// Clients sharing a Registerer share their metrics. Defaults to
+	// prometheus.DefaultRegisterer.
+	Registerer prometheus.Registerer
+
+	// ReadinessCheckers are consulted in addition to Helm's built-in
+	// readiness checks when waiting during installs, upgrades and
+	// rollbacks. Objects of the release with a checker registered for their
+	// GroupVersionKind are polled until the checker reports them as ready.
+	// Helm marks the release as failed and skips post hooks otherwise. See
+	// NewConditionReadinessChecker for a checker based on status
+	// conditions.
+	ReadinessCheckers map[schema.GroupVersionKind]ReadinessChecker
+
+	// ReleaseLease enables a coordination.k8s.io Lease per release which is
+	// held while mutating the release. Mutating operations on the same
+	// release are always serialized within the process. The Lease extends
+	// this to all processes using this library against the same cluster.
+	// When the Lease is lost, e.g. because it could not be renewed before
+	// ReleaseLeaseDuration passed, the context of the operation is cancelled.
+	// Installs and upgrades then stop waiting for Helm and fail with a
+	// releaseLockedError, as does waiting for resources with a custom
+	// ReadinessChecker. Rollbacks and uninstalls cannot be cancelled and run
+	// to completion.
+	ReleaseLease bool
+	// ReleaseLeaseDuration is the time after which a Lease that has not been
+	// renewed can be taken over by another holder. Defaults to 60 seconds.
+	ReleaseLeaseDuration time.Duration
+	// ReleaseLeaseIdentity is the holder identity written to the Lease.
+	// Defaults to the hostname followed by a random suffix.
+	ReleaseLeaseIdentity string
+	// ReleaseLockFailFast makes operations on a release that is locked by
+	// another operation fail immediately with a releaseLockedError instead of
+	// waiting until the lock is free or the context is done.
+	ReleaseLockFailFast bool
+
+	// ReleaseMetricsNamespaces enables the helmclient_library_releases gauge
+	// counting the releases of the given namespaces by status. Use
+	// metav1.NamespaceAll to count releases of all namespaces, which
+	// requires permissions to list secrets cluster-wide. The release
+	// storage is listed on every scrape. The gauge reports the releases of
+	// a single cluster so every Client enabling it needs its own
+	// Registerer. Disabled by default.
+	ReleaseMetricsNamespaces []string
+
+	// TracerProvider provides the tracer used to create OpenTelemetry spans
+	// for every operation. Spans are children of the span found in the
+	// context passed to the operation. Defaults to the global tracer
+	// provider.
+	TracerProvider trace.TracerProvider
 }
 
 // Client knows how to talk with Helm.
 type Client struct {
+	auditActor      string
+	auditSink       AuditSink
+	dynamicClient   dynamic.Interface
+	eventRecorder   record.EventRecorder
 	fs              afero.Fs
 	helmClient      Interface
 	httpClient      *http.Client
 	k8sClient       kubernetes.Interface
 	logger          micrologger.Logger
+	maxHistory      int
+	metrics         *metrics
 	registryOptions content.RegistryOptions
 	restClient      rest.Interface
 	restConfig      *rest.Config
 	restMapper      meta.RESTMapper
+
+	readinessCheckers    map[schema.GroupVersionKind]ReadinessChecker
+	releaseLease         bool
+	releaseLeaseDuration time.Duration
+	releaseLeaseIdentity string
+	releaseLocker        *releaseLocker
+	releaseLockFailFast  bool
+	tracer               trace.Tracer
 }
 
 // debugLogFunc allows us to pass log messages from helm to micrologger.
@@ -112,25 +206,91 @@ func New(config Config) (*Client, error) {
 		config.RestMapper = restMapper
 	}
 
+	if config.MaxHistory == 0 {
+		config.MaxHistory = maxHistory
+	}
+
+	dynamicClient, err := dynamic.NewForConfigAndClient(rest.CopyConfig(config.RestConfig), rmHttpClient)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
 	if config.HTTPClientTimeout == 0 {
 		config.HTTPClientTimeout = defaultHTTPClientTimeout
 	}
 
+	if config.ReleaseLeaseDuration == 0 {
+		config.ReleaseLeaseDuration = time.Second * defaultReleaseLeaseDuration
+	}
+	if config.ReleaseLeaseDuration < 3*time.Second {
+		return nil, microerror.Maskf(invalidConfigError, "%T.ReleaseLeaseDuration must be at least 3s", config)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	if config.AuditActor == "" {
+		config.AuditActor = hostname
+	}
+	if config.ReleaseLeaseIdentity == "" {
+		config.ReleaseLeaseIdentity = fmt.Sprintf("%s_%s", hostname, rand.String(8))
+	}
+
+	if config.Registerer == nil {
+		config.Registerer = prometheus.DefaultRegisterer
+	}
+	if config.TracerProvider == nil {
+		config.TracerProvider = otel.GetTracerProvider()
+	}
+
+	var metadataClient metadata.Interface
+	if len(config.ReleaseMetricsNamespaces) > 0 {
+		metadataClient, err = metadata.NewForConfigAndClient(rest.CopyConfig(config.RestConfig), rmHttpClient)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+	}
+
+	metrics, err := newMetrics(metricsConfig{
+		Logger:            config.Logger,
+		MetadataClient:    metadataClient,
+		Registerer:        config.Registerer,
+		ReleaseNamespaces: config.ReleaseMetricsNamespaces,
+	})
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
 	// Set client timeout to prevent leakages.
 	httpClient := &http.Client{
 		Timeout: time.Second * time.Duration(config.HTTPClientTimeout),
 	}
 
 	c := &Client{
+		auditActor:      config.AuditActor,
+		auditSink:       config.AuditSink,
+		dynamicClient:   dynamicClient,
+		eventRecorder:   config.EventRecorder,
 		fs:              config.Fs,
 		helmClient:      config.HelmClient,
 		httpClient:      httpClient,
 		k8sClient:       config.K8sClient,
 		logger:          config.Logger,
+		maxHistory:      config.MaxHistory,
+		metrics:         metrics,
 		registryOptions: *config.RegistryOptions,
 		restClient:      config.RestClient,
 		restConfig:      config.RestConfig,
 		restMapper:      config.RestMapper,
+
+		readinessCheckers:    config.ReadinessCheckers,
+		releaseLease:         config.ReleaseLease,
+		releaseLeaseDuration: config.ReleaseLeaseDuration,
+		releaseLeaseIdentity: config.ReleaseLeaseIdentity,
+		releaseLocker:        newReleaseLocker(),
+		releaseLockFailFast:  config.ReleaseLockFailFast,
+		tracer:               config.TracerProvider.Tracer(tracerName),
 	}
 
 	return c, nil
@@ -140,32 +300,52 @@ func New(config Config) (*Client, error) {
 // klog.Infof function. We downgrade the messages from info to debug to match
 // our usual approach.
 func (c *Client) debugLogFunc(ctx context.Context) debugLogFunc {
+	debugLog := debugLogFrom(ctx)
+
 	return func(format string, args ...interface{}) {
 		message := fmt.Sprintf(format, args...)
 		c.logger.LogCtx(ctx, "level", "debug", "message", message)
+		debugLog.write(message)
 	}
 }
 
 // newActionConfig creates a config for the Helm action package.
 func (c *Client) newActionConfig(ctx context.Context, namespace string) (*action.Configuration, error) {
-	restClient, err := c.newRESTClientGetter(ctx, namespace)
+	cfg, _, err := c.newActionConfigWithKubeClients(ctx, namespace, kubeClientOptions{})
 	if err != nil {
 		return nil, microerror.Mask(err)
 	}
 
+	return cfg, nil
+}
+
+// newActionConfigWithKubeClients creates a config for the Helm action package
+// whose kube client is configured using the given options. The clients
+// wrapping the Helm kube client are returned as well.
+func (c *Client) newActionConfigWithKubeClients(ctx context.Context, namespace string, options kubeClientOptions) (*action.Configuration, *kubeClients, error) {
+	restClient, err := c.newRESTClientGetter(ctx, namespace)
+	if err != nil {
+		return nil, nil, microerror.Mask(err)
+	}
+
 	// Create a Helm kube client.
 	kubeClient := kube.New(restClient)
+	kubeClient.Log = c.debugLogFunc(ctx)
+
+	kubeClients := c.newKubeClients(ctx, kubeClient, options)
 
 	// Use secrets driver for release storage.
 	s := driver.NewSecrets(c.k8sClient.CoreV1().Secrets(namespace))
 	store := storage.Init(s)
 
-	return &action.Configuration{
+	cfg := &action.Configuration{
 		Log:              c.debugLogFunc(ctx),
-		KubeClient:       kubeClient,
+		KubeClient:       kubeClients.tracing,
 		Releases:         store,
 		RESTClientGetter: restClient,
-	}, nil
+	}
+
+	return cfg, kubeClients, nil
 }
 
 func (c *Client) newRESTClientGetter(ctx context.Context, namespace string) (*restClientGetter, error) {
@@ -214,10 +394,11 @@ func (r *restClientGetter) ToRESTMapper() (meta.RESTMapper, error) {
 
 func releaseToReleaseContent(res *release.Release) *ReleaseContent {
 	release := &ReleaseContent{
-		Name:     res.Name,
-		Revision: res.Version,
-		Status:   res.Info.Status.String(),
-		Values:   res.Config,
+		Name:      res.Name,
+		Namespace: res.Namespace,
+		Revision:  res.Version,
+		Status:    res.Info.Status.String(),
+		Values:    res.Config,
 	}
 
 	if res.Chart != nil && res.Chart.Metadata != nil {
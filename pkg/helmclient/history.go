@@ -2,9 +2,11 @@ package helmclient
 
 import (
 	"context"
+	"sort"
 
 	"github.com/giantswarm/microerror"
-	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/release"
 )
@@ -15,12 +17,20 @@ import (
 func (c *Client) GetReleaseHistory(ctx context.Context, namespace, releaseName string) ([]ReleaseHistory, error) {
 	eventName := "get_release_history"
 
-	t := prometheus.NewTimer(histogram.WithLabelValues(eventName))
-	defer t.ObserveDuration()
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeReleaseNamespace, namespace),
+		attribute.String(attributeReleaseName, releaseName),
+	))
+	defer span.End()
+
+	m := c.metrics.observe(eventName, namespace)
+	defer m.stop()
 
 	releaseHistory, err := c.getReleaseHistory(ctx, namespace, releaseName)
+	err = translateHelmError(err, namespace, releaseName)
 	if err != nil {
-		errorGauge.WithLabelValues(eventName).Inc()
+		m.fail()
+		recordSpanError(span, err)
 		return nil, microerror.Mask(err)
 	}
 
@@ -49,6 +59,126 @@ func (c *Client) getReleaseHistory(ctx context.Context, namespace, releaseName s
 	return releasesToReleaseHistory(releases), nil
 }
 
+// ListReleaseHistory lists the revisions of the given Helm Release. Unlike
+// GetReleaseHistory all stored revisions are considered and they can be
+// filtered by revision range and status and paginated. Revisions are sorted
+// by revision number in ascending order unless options.SortReverse is set.
+func (c *Client) ListReleaseHistory(ctx context.Context, namespace, releaseName string, options HistoryOptions) ([]ReleaseHistory, error) {
+	eventName := "list_release_history"
+
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeReleaseNamespace, namespace),
+		attribute.String(attributeReleaseName, releaseName),
+	))
+	defer span.End()
+
+	m := c.metrics.observe(eventName, namespace)
+	defer m.stop()
+
+	releaseHistory, err := c.listReleaseHistory(ctx, namespace, releaseName, options)
+	err = translateHelmError(err, namespace, releaseName)
+	if err != nil {
+		m.fail()
+		recordSpanError(span, err)
+		return nil, microerror.Mask(err)
+	}
+
+	return releaseHistory, nil
+}
+
+func (c *Client) listReleaseHistory(ctx context.Context, namespace, releaseName string, options HistoryOptions) ([]ReleaseHistory, error) {
+	err := options.validate()
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	cfg, err := c.newActionConfig(ctx, namespace)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	releaseHistory, err := listReleaseHistoryFrom(cfg, releaseName, options)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return releaseHistory, nil
+}
+
+// listReleaseHistoryFrom lists the revisions of the given release stored in
+// the release storage of the given action configuration.
+func listReleaseHistoryFrom(cfg *action.Configuration, releaseName string, options HistoryOptions) ([]ReleaseHistory, error) {
+	history := action.NewHistory(cfg)
+
+	releases, err := history.Run(releaseName)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return releasesToReleaseHistory(options.filter(releases)), nil
+}
+
+func (options HistoryOptions) validate() error {
+	if options.Limit < 0 || options.Offset < 0 {
+		return microerror.Maskf(invalidConfigError, "limit and offset must not be negative")
+	}
+	if options.FromRevision < 0 || options.ToRevision < 0 {
+		return microerror.Maskf(invalidConfigError, "revisions must not be negative")
+	}
+	if options.ToRevision > 0 && options.FromRevision > options.ToRevision {
+		return microerror.Maskf(invalidConfigError, "from revision %d must not be greater than to revision %d", options.FromRevision, options.ToRevision)
+	}
+	for _, status := range options.Statuses {
+		if _, ok := listStates[status]; !ok {
+			return microerror.Maskf(invalidConfigError, "unknown status %#q", status)
+		}
+	}
+
+	return nil
+}
+
+// filter applies revision range, status filter, sorting and pagination to the
+// given releases.
+func (options HistoryOptions) filter(releases []*release.Release) []*release.Release {
+	statuses := map[string]bool{}
+	for _, status := range options.Statuses {
+		statuses[status] = true
+	}
+
+	var filtered []*release.Release
+	for _, rel := range releases {
+		if options.FromRevision > 0 && rel.Version < options.FromRevision {
+			continue
+		}
+		if options.ToRevision > 0 && rel.Version > options.ToRevision {
+			continue
+		}
+		if len(statuses) > 0 && (rel.Info == nil || !statuses[rel.Info.Status.String()]) {
+			continue
+		}
+
+		filtered = append(filtered, rel)
+	}
+
+	sort.Slice(filtered, func(i, j int) bool {
+		if options.SortReverse {
+			return filtered[i].Version > filtered[j].Version
+		}
+		return filtered[i].Version < filtered[j].Version
+	})
+
+	if options.Offset >= len(filtered) {
+		return nil
+	}
+	filtered = filtered[options.Offset:]
+
+	if options.Limit > 0 && options.Limit < len(filtered) {
+		filtered = filtered[:options.Limit]
+	}
+
+	return filtered
+}
+
 func releasesToReleaseHistory(releases []*release.Release) []ReleaseHistory {
 	var history []ReleaseHistory
 
@@ -0,0 +1,224 @@
+package helmclient
+
+import (
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"helm.sh/helm/v3/pkg/action"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+func Test_HistoryOptions_validate(t *testing.T) {
+	testCases := []struct {
+		name         string
+		options      HistoryOptions
+		errorMatcher func(error) bool
+	}{
+		{
+			name:    "case 0: defaults",
+			options: HistoryOptions{},
+		},
+		{
+			name:    "case 1: revision range and statuses",
+			options: HistoryOptions{FromRevision: 2, ToRevision: 4, Statuses: []string{StatusDeployed, StatusSuperseded}},
+		},
+		{
+			name:    "case 2: open revision range",
+			options: HistoryOptions{FromRevision: 5},
+		},
+		{
+			name:         "case 3: negative limit",
+			options:      HistoryOptions{Limit: -1},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "case 4: negative offset",
+			options:      HistoryOptions{Offset: -1},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "case 5: negative revision",
+			options:      HistoryOptions{FromRevision: -1},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "case 6: from revision greater than to revision",
+			options:      HistoryOptions{FromRevision: 3, ToRevision: 2},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "case 7: unknown status",
+			options:      HistoryOptions{Statuses: []string{"broken"}},
+			errorMatcher: IsInvalidConfig,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			err := tc.options.validate()
+
+			switch {
+			case err == nil && tc.errorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+		})
+	}
+}
+
+func Test_HistoryOptions_filter(t *testing.T) {
+	testCases := []struct {
+		name              string
+		options           HistoryOptions
+		expectedRevisions []int
+	}{
+		{
+			name:              "case 0: all revisions in ascending order",
+			options:           HistoryOptions{},
+			expectedRevisions: []int{1, 2, 3, 4, 5},
+		},
+		{
+			name:              "case 1: revision range",
+			options:           HistoryOptions{FromRevision: 2, ToRevision: 4},
+			expectedRevisions: []int{2, 3, 4},
+		},
+		{
+			name:              "case 2: status filter",
+			options:           HistoryOptions{Statuses: []string{StatusFailed, StatusDeployed}},
+			expectedRevisions: []int{3, 5},
+		},
+		{
+			name:              "case 3: reverse order",
+			options:           HistoryOptions{SortReverse: true},
+			expectedRevisions: []int{5, 4, 3, 2, 1},
+		},
+		{
+			name:              "case 4: offset and limit after sorting",
+			options:           HistoryOptions{SortReverse: true, Offset: 1, Limit: 2},
+			expectedRevisions: []int{4, 3},
+		},
+		{
+			name:              "case 5: offset beyond the revisions",
+			options:           HistoryOptions{Offset: 5},
+			expectedRevisions: nil,
+		},
+		{
+			name:              "case 6: offset and limit after filtering",
+			options:           HistoryOptions{Statuses: []string{StatusSuperseded}, Offset: 1, Limit: 1},
+			expectedRevisions: []int{2},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			filtered := tc.options.filter(newHistoryTestReleases())
+
+			var revisions []int
+			for _, rel := range filtered {
+				revisions = append(revisions, rel.Version)
+			}
+			if diff := cmp.Diff(tc.expectedRevisions, revisions); diff != "" {
+				t.Fatalf("want matching revisions \n %s", diff)
+			}
+		})
+	}
+}
+
+func Test_listReleaseHistoryFrom(t *testing.T) {
+	testCases := []struct {
+		name            string
+		releaseName     string
+		options         HistoryOptions
+		expectedHistory []ReleaseHistory
+		errorMatcher    func(error) bool
+	}{
+		{
+			name:        "case 0: filtered history",
+			releaseName: "foo",
+			options:     HistoryOptions{FromRevision: 4},
+			expectedHistory: []ReleaseHistory{
+				{Name: "foo", Revision: 4, Status: StatusSuperseded},
+				{Name: "foo", Revision: 5, Status: StatusDeployed},
+			},
+		},
+		{
+			name:         "case 1: release not found",
+			releaseName:  "bar",
+			errorMatcher: IsReleaseNotFound,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			cfg := &action.Configuration{
+				KubeClient: &kubefake.FailingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}},
+				Log:        func(string, ...interface{}) {},
+				Releases:   storage.Init(driver.NewMemory()),
+			}
+			for _, rel := range newHistoryTestReleases() {
+				err := cfg.Releases.Create(rel)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			history, err := listReleaseHistoryFrom(cfg, tc.releaseName, tc.options)
+
+			switch {
+			case err == nil && tc.errorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if diff := cmp.Diff(tc.expectedHistory, history); diff != "" {
+				t.Fatalf("want matching history \n %s", diff)
+			}
+		})
+	}
+}
+
+// newHistoryTestReleases returns the history of a release whose third
+// revision failed. The revisions are not ordered like Helm's storage does not
+// order them either.
+func newHistoryTestReleases() []*release.Release {
+	statuses := map[int]release.Status{
+		1: release.StatusSuperseded,
+		2: release.StatusSuperseded,
+		3: release.StatusFailed,
+		4: release.StatusSuperseded,
+		5: release.StatusDeployed,
+	}
+
+	var releases []*release.Release
+	for _, version := range []int{3, 1, 5, 2, 4} {
+		releases = append(releases, &release.Release{
+			Name:      "foo",
+			Namespace: "default",
+			Version:   version,
+			Info:      &release.Info{Status: statuses[version]},
+		})
+	}
+
+	return releases
+}
@@ -0,0 +1,165 @@
+package helmclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// hookLogTailLines is the number of log lines of a failing hook pod
+	// attached to a HookFailedError.
+	hookLogTailLines = 20
+	// jobNameLabel is set by the Job controller on the pods it creates.
+	jobNameLabel = "job-name"
+)
+
+// HookFailedError is returned when a hook of a Helm Release failed. It wraps
+// the error returned by Helm.
+type HookFailedError struct {
+	// Events are the events the hook fires on, e.g. pre-install.
+	Events []string
+	// Hook is the name of the failed hook.
+	Hook string
+	// Kind is the Kubernetes kind of the failed hook.
+	Kind string
+	// Logs are the last log lines of the failing pod of the hook. This is
+	// empty if the hook is neither a Pod nor a Job or if the pod was
+	// already deleted by the hook delete policy.
+	Logs string
+	// Phase is the phase of the last run of the hook as stored by Helm.
+	// This is Running for hooks of rollbacks as Helm does not record their
+	// failure.
+	Phase string
+	// ReleaseName is the name of the Helm Release.
+	ReleaseName string
+
+	err error
+}
+
+func (e *HookFailedError) Error() string {
+	return fmt.Sprintf("%s hook %#q of kind %#q for release %#q failed: %s", strings.Join(e.Events, ","), e.Hook, e.Kind, e.ReleaseName, e.err)
+}
+
+func (e *HookFailedError) Unwrap() error {
+	return e.err
+}
+
+// IsHookFailed asserts HookFailedError.
+func IsHookFailed(err error) bool {
+	var hookFailedError *HookFailedError
+	return errors.As(err, &hookFailedError)
+}
+
+// lastHookFailure inspects the latest stored revision of the release after a
+// failed operation and returns a HookFailedError wrapping err if one of its
+// hooks failed since the operation started. Otherwise err is returned as is.
+func (c *Client) lastHookFailure(ctx context.Context, cfg *action.Configuration, namespace, releaseName string, since time.Time, err error) error {
+	rel, getErr := cfg.Releases.Last(releaseName)
+	if getErr != nil {
+		// The release may be gone, e.g. after an uninstall. There is
+		// nothing to inspect then.
+		return err
+	}
+
+	return c.hookFailure(ctx, namespace, rel, since, err)
+}
+
+// hookFailure returns a HookFailedError wrapping err if one of the hooks of
+// the given revision failed since the operation started. Otherwise err is
+// returned as is.
+//
+// Helm does not store the state of a failed hook for every operation. A
+// rollback records a hook as running before executing it but returns without
+// recording its failure. A hook still running in the stored revision after
+// the operation failed is therefore the one which failed.
+func (c *Client) hookFailure(ctx context.Context, namespace string, rel *release.Release, since time.Time, err error) error {
+	for _, hook := range rel.Hooks {
+		if hook.LastRun.StartedAt.Time.Before(since) {
+			continue
+		}
+		if hook.LastRun.Phase != release.HookPhaseFailed && hook.LastRun.Phase != release.HookPhaseRunning {
+			continue
+		}
+
+		hookFailedError := &HookFailedError{
+			Hook:        hook.Name,
+			Kind:        hook.Kind,
+			Logs:        c.getHookLogs(ctx, hookNamespace(hook, namespace), hook),
+			Phase:       hook.LastRun.Phase.String(),
+			ReleaseName: rel.Name,
+
+			err: err,
+		}
+		for _, event := range hook.Events {
+			hookFailedError.Events = append(hookFailedError.Events, event.String())
+		}
+
+		return hookFailedError
+	}
+
+	return err
+}
+
+// hookNamespace returns the namespace the given hook runs in. This is the
+// namespace of the release unless the hook sets its own.
+func hookNamespace(hook *release.Hook, namespace string) string {
+	objects, err := parseManifest(hook.Manifest)
+	if err != nil || len(objects) == 0 || objects[0].GetNamespace() == "" {
+		return namespace
+	}
+
+	return objects[0].GetNamespace()
+}
+
+// getHookLogs returns the last log lines of the pod run by the given hook.
+// Failing to fetch logs must not hide the hook failure so errors are only
+// logged.
+func (c *Client) getHookLogs(ctx context.Context, namespace string, hook *release.Hook) string {
+	var podName string
+
+	switch hook.Kind {
+	case "Pod":
+		podName = hook.Name
+	case "Job":
+		pods, err := c.k8sClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%s=%s", jobNameLabel, hook.Name),
+		})
+		if err != nil {
+			c.logger.LogCtx(ctx, "level", "warning", "message", fmt.Sprintf("failed to list pods of hook %#q in namespace %#q", hook.Name, namespace), "stack", fmt.Sprintf("%#v", err))
+			return ""
+		}
+
+		// Use the most recent pod which is the one of the last attempt.
+		var latest *corev1.Pod
+		for i, pod := range pods.Items {
+			if latest == nil || pod.CreationTimestamp.After(latest.CreationTimestamp.Time) {
+				latest = &pods.Items[i]
+			}
+		}
+		if latest != nil {
+			podName = latest.Name
+		}
+	}
+
+	if podName == "" {
+		return ""
+	}
+
+	tailLines := int64(hookLogTailLines)
+
+	logs, err := c.k8sClient.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{TailLines: &tailLines}).Do(ctx).Raw()
+	if err != nil {
+		c.logger.LogCtx(ctx, "level", "warning", "message", fmt.Sprintf("failed to get logs of hook pod %#q in namespace %#q", podName, namespace), "stack", fmt.Sprintf("%#v", err))
+		return ""
+	}
+
+	return string(logs)
+}
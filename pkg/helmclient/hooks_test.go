@@ -0,0 +1,226 @@
+package helmclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_hookFailure(t *testing.T) {
+	testCases := []struct {
+		name           string
+		event          release.HookEvent
+		run            func(c *Client, cfg *action.Configuration, start time.Time) error
+		expectedEvents []string
+		expectedPhase  release.HookPhase
+	}{
+		{
+			name:  "case 0: pre-delete hook fails",
+			event: release.HookPreDelete,
+			run: func(c *Client, cfg *action.Configuration, start time.Time) error {
+				res, err := action.NewUninstall(cfg).Run("test")
+				if err == nil || res == nil || res.Release == nil {
+					return err
+				}
+				return c.hookFailure(context.Background(), "default", res.Release, start, err)
+			},
+			expectedEvents: []string{"pre-delete"},
+			expectedPhase:  release.HookPhaseFailed,
+		},
+		{
+			name:  "case 1: post-delete hook fails",
+			event: release.HookPostDelete,
+			run: func(c *Client, cfg *action.Configuration, start time.Time) error {
+				res, err := action.NewUninstall(cfg).Run("test")
+				if err == nil || res == nil || res.Release == nil {
+					return err
+				}
+				return c.hookFailure(context.Background(), "default", res.Release, start, err)
+			},
+			expectedEvents: []string{"post-delete"},
+			expectedPhase:  release.HookPhaseFailed,
+		},
+		{
+			name:  "case 2: pre-rollback hook fails",
+			event: release.HookPreRollback,
+			run: func(c *Client, cfg *action.Configuration, start time.Time) error {
+				rollback := action.NewRollback(cfg)
+				rollback.Version = 1
+				err := rollback.Run("test")
+				return c.lastHookFailure(context.Background(), cfg, "default", "test", start, err)
+			},
+			expectedEvents: []string{"pre-rollback"},
+			expectedPhase:  release.HookPhaseRunning,
+		},
+		{
+			name:  "case 3: post-rollback hook fails",
+			event: release.HookPostRollback,
+			run: func(c *Client, cfg *action.Configuration, start time.Time) error {
+				rollback := action.NewRollback(cfg)
+				rollback.Version = 1
+				err := rollback.Run("test")
+				return c.lastHookFailure(context.Background(), cfg, "default", "test", start, err)
+			},
+			expectedEvents: []string{"post-rollback"},
+			expectedPhase:  release.HookPhaseRunning,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			k8sClient := fake.NewSimpleClientset()
+			c := &Client{
+				k8sClient: k8sClient,
+			}
+
+			// The secrets driver encodes releases like in a real cluster so
+			// that only the hook state Helm actually stores is visible.
+			cfg := &action.Configuration{
+				Releases:     storage.Init(driver.NewSecrets(k8sClient.CoreV1().Secrets("default"))),
+				KubeClient:   &kubefake.FailingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}, WatchUntilReadyError: errors.New("pod failed")},
+				Capabilities: chartutil.DefaultCapabilities,
+				Log:          func(string, ...interface{}) {},
+			}
+
+			for _, rel := range []*release.Release{
+				newHookTestRelease(1, release.StatusSuperseded, tc.event),
+				newHookTestRelease(2, release.StatusDeployed, tc.event),
+			} {
+				err := cfg.Releases.Create(rel)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := tc.run(c, cfg, time.Now())
+
+			var hookFailedError *HookFailedError
+			if !errors.As(err, &hookFailedError) {
+				t.Fatalf("expected %T got %#v", hookFailedError, err)
+			}
+			if hookFailedError.Hook != "migrate" {
+				t.Fatalf("expected hook %#q got %#q", "migrate", hookFailedError.Hook)
+			}
+			if hookFailedError.Kind != "Pod" {
+				t.Fatalf("expected kind %#q got %#q", "Pod", hookFailedError.Kind)
+			}
+			if len(hookFailedError.Events) != 1 || hookFailedError.Events[0] != tc.expectedEvents[0] {
+				t.Fatalf("expected events %v got %v", tc.expectedEvents, hookFailedError.Events)
+			}
+			if hookFailedError.Phase != tc.expectedPhase.String() {
+				t.Fatalf("expected phase %#q got %#q", tc.expectedPhase, hookFailedError.Phase)
+			}
+			if hookFailedError.Logs == "" {
+				t.Fatalf("expected logs of the hook pod")
+			}
+		})
+	}
+}
+
+func Test_Client_getHookLogs(t *testing.T) {
+	testCases := []struct {
+		name         string
+		hook         *release.Hook
+		podNamespace string
+		expectedLogs bool
+	}{
+		{
+			name: "case 0: job in the release namespace",
+			hook: &release.Hook{
+				Name:     "migrate",
+				Kind:     "Job",
+				Manifest: "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: migrate\n",
+			},
+			podNamespace: "default",
+			expectedLogs: true,
+		},
+		{
+			name: "case 1: job in its own namespace",
+			hook: &release.Hook{
+				Name:     "migrate",
+				Kind:     "Job",
+				Manifest: "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: migrate\n  namespace: jobs\n",
+			},
+			podNamespace: "jobs",
+			expectedLogs: true,
+		},
+		{
+			name: "case 2: job without pods",
+			hook: &release.Hook{
+				Name:     "migrate",
+				Kind:     "Job",
+				Manifest: "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: migrate\n",
+			},
+			podNamespace: "jobs",
+			expectedLogs: false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "migrate-abcde",
+					Namespace: tc.podNamespace,
+					Labels:    map[string]string{jobNameLabel: "migrate"},
+				},
+			}
+
+			c := &Client{
+				k8sClient: fake.NewSimpleClientset(pod),
+				logger:    microloggertest.New(),
+			}
+
+			logs := c.getHookLogs(context.Background(), hookNamespace(tc.hook, "default"), tc.hook)
+			if (logs != "") != tc.expectedLogs {
+				t.Fatalf("expected logs %t got %q", tc.expectedLogs, logs)
+			}
+		})
+	}
+}
+
+func newHookTestRelease(version int, status release.Status, event release.HookEvent) *release.Release {
+	return &release.Release{
+		Name:      "test",
+		Namespace: "default",
+		Version:   version,
+		Info: &release.Info{
+			Status: status,
+		},
+		Chart: &chart.Chart{
+			Metadata: &chart.Metadata{
+				APIVersion: chart.APIVersionV2,
+				Name:       "test",
+				Version:    "1.0.0",
+			},
+		},
+		Hooks: []*release.Hook{
+			{
+				Name:     "migrate",
+				Kind:     "Pod",
+				Path:     "templates/migrate.yaml",
+				Manifest: "apiVersion: v1\nkind: Pod\nmetadata:\n  name: migrate\n",
+				Events:   []release.HookEvent{event},
+			},
+		},
+	}
+}
@@ -5,32 +5,61 @@ import (
 	"time"
 
 	"github.com/giantswarm/microerror"
-	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"helm.sh/helm/v3/pkg/action"
-	"helm.sh/helm/v3/pkg/chart/loader"
 )
 
 // InstallReleaseFromTarball installs a chart packaged in the given tarball.
 func (c *Client) InstallReleaseFromTarball(ctx context.Context, chartPath, namespace string, values map[string]interface{}, options InstallOptions) error {
 	eventName := "install_release_from_tarball"
 
-	t := prometheus.NewTimer(histogram.WithLabelValues(eventName))
-	defer func() {
-		eventCounter.WithLabelValues(eventName, options.ReleaseName).Inc()
-		t.ObserveDuration()
-	}()
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeChartPath, chartPath),
+		attribute.String(attributeReleaseNamespace, namespace),
+		attribute.String(attributeReleaseName, options.ReleaseName),
+	))
+	defer span.End()
 
-	err := c.installReleaseFromTarball(ctx, chartPath, namespace, values, options)
+	m := c.metrics.observe(eventName, namespace)
+	defer m.stop()
+
+	ctx, debugLog := withDebugLog(ctx)
+
+	audit := c.newAudit(AuditOperationInstall, namespace, options.ReleaseName, values)
+	err := c.installReleaseFromTarball(ctx, audit, chartPath, namespace, values, options)
+	err = translateHelmError(err, namespace, options.ReleaseName)
+	audit.finish(ctx, err)
+	c.recordEvent(options.EventObject, installOperation, namespace, options.ReleaseName, err)
 	if err != nil {
-		errorGauge.WithLabelValues(eventName).Inc()
-		return microerror.Mask(err)
+		m.fail()
+		recordSpanError(span, err)
+		return microerror.Mask(debugLog.attach(err))
 	}
 
 	return nil
 }
 
-func (c *Client) installReleaseFromTarball(ctx context.Context, chartPath, namespace string, values map[string]interface{}, options InstallOptions) error {
-	cfg, err := c.newActionConfig(ctx, namespace)
+func (c *Client) installReleaseFromTarball(ctx context.Context, audit *auditTrail, chartPath, namespace string, values map[string]interface{}, options InstallOptions) error {
+	ctx, unlock, err := c.lockRelease(ctx, namespace, options.ReleaseName)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	defer unlock()
+
+	audit.start(ctx)
+
+	progress := newProgressReporter(options.Progress)
+
+	cfg, kubeClients, err := c.newActionConfigWithKubeClients(ctx, namespace, kubeClientOptions{
+		Adopt:            options.Adopt,
+		ReleaseName:      options.ReleaseName,
+		ReleaseNamespace: namespace,
+		Progress:         progress,
+		ServerSideApply:  options.ServerSideApply,
+		FieldManager:     options.FieldManager,
+		ForceConflicts:   options.ForceConflicts,
+	})
 	if err != nil {
 		return microerror.Mask(err)
 	}
@@ -39,17 +68,45 @@ func (c *Client) installReleaseFromTarball(ctx context.Context, chartPath, names
 
 	// Load the chart from the given path. This also ensures that all chart
 	// dependencies are present.
-	chartRequested, err := loader.Load(chartPath)
+	chartRequested, err := c.loadHelmChart(ctx, chartPath)
 	if err != nil {
 		return microerror.Mask(err)
 	}
 
+	progress.report(Progress{Phase: ProgressPhaseChartLoaded})
+
+	if options.ManageCRDs {
+		var changes []CRDChange
+		changes, err = c.applyCRDs(ctx, chartRequested, cfg)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+		progress.report(Progress{Phase: ProgressPhaseCRDsApplied, CRDs: changes})
+	}
+
+	// The chart is rendered once for the adoption check and once more when
+	// installing. Rendering is only reported for the first of them.
+	kubeClients.startRender()
+
+	// The adoption check renders the chart and resolves its objects, which
+	// requires the CRDs of custom resources to be present.
+	if options.Adopt {
+		err = c.checkAdoption(cfg, chartRequested, namespace, values, options)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
 	// Configure action with supported install options.
 	options.configure(install, namespace)
 
-	_, err = install.Run(chartRequested, values)
+	start := time.Now()
+
+	_, err = install.RunWithContext(ctx, chartRequested, values)
 	if err != nil {
-		return microerror.Mask(err)
+		err = cancellationCause(ctx, err)
+		err = kubeClients.recording.withBuiltObjects(err)
+		return microerror.Mask(c.lastHookFailure(ctx, cfg, namespace, options.ReleaseName, start, err))
 	}
 
 	return nil
@@ -63,9 +120,13 @@ func (options InstallOptions) configure(action *action.Install, namespace string
 	// Disable OpenAPI validation as some charts we need to deploy will contain
 	// validation errors.
 	action.DisableOpenAPIValidation = true
+	action.DisableHooks = options.DisableHooks
+	action.TakeOwnership = options.Adopt
 	action.Namespace = namespace
 	action.ReleaseName = options.ReleaseName
 	action.Timeout = options.Timeout
 	action.Wait = options.Wait
-	action.SkipCRDs = options.SkipCRDs
+	action.WaitForJobs = options.WaitForJobs
+	// CRDs are already applied by the client when managing them.
+	action.SkipCRDs = options.SkipCRDs || options.ManageCRDs
 }
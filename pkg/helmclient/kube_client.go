@@ -0,0 +1,88 @@
+package helmclient
+
+import (
+	"context"
+
+	"helm.sh/helm/v3/pkg/kube"
+)
+
+// kubeClient is the Helm kube client including the optional interfaces Helm
+// actions assert on it. The clients wrapping the Helm kube client implement
+// all of them so that wrapping does not disable any Helm functionality.
+type kubeClient interface {
+	kube.Interface
+	kube.InterfaceDeletionPropagation
+	kube.InterfaceExt
+	kube.InterfaceLogs
+	kube.InterfaceResources
+	kube.InterfaceThreeWayMerge
+}
+
+// kubeClientOptions configure the clients wrapping the Helm kube client of an
+// action configuration.
+type kubeClientOptions struct {
+	// Adopt checks right before Helm takes ownership of existing objects that
+	// they are not owned by another release than the one given by
+	// ReleaseName and ReleaseNamespace.
+	Adopt            bool
+	ReleaseName      string
+	ReleaseNamespace string
+	// KeepCRDs keeps CRDs when Helm deletes resources.
+	KeepCRDs bool
+	// Progress receives the progress of the operations Helm executes.
+	Progress *progressReporter
+	// ServerSideApply creates and updates resources using server-side apply
+	// with the given FieldManager and ForceConflicts.
+	ServerSideApply bool
+	FieldManager    string
+	ForceConflicts  bool
+}
+
+// kubeClients are the clients wrapping the Helm kube client of an action
+// configuration. From the outside in, Helm's operations are traced, their
+// progress is reported, resources with a custom readiness checker are waited
+// for and built objects are recorded before the operations are executed by
+// the Helm kube client or the client replacing it, e.g. for server-side
+// apply.
+type kubeClients struct {
+	// keepCRDs is only set when keeping CRDs.
+	keepCRDs  *keepCRDsClient
+	progress  *progressKubeClient
+	recording *recordingKubeClient
+	tracing   *tracingKubeClient
+}
+
+func (c *Client) newKubeClients(ctx context.Context, client *kube.Client, options kubeClientOptions) *kubeClients {
+	k := &kubeClients{}
+
+	var next kubeClient = client
+	if options.ServerSideApply {
+		next = newServerSideApplyClient(client, options.FieldManager, options.ForceConflicts)
+	} else if options.KeepCRDs {
+		k.keepCRDs = &keepCRDsClient{kubeClient: client}
+		next = k.keepCRDs
+	}
+	if options.Adopt {
+		next = &adoptingKubeClient{
+			kubeClient: next,
+
+			releaseName:      options.ReleaseName,
+			releaseNamespace: options.ReleaseNamespace,
+		}
+	}
+
+	k.recording = &recordingKubeClient{kubeClient: next}
+	readiness := newReadinessKubeClient(ctx, c.tracer, k.recording, client.Log, options.Progress, c.dynamicClient, c.readinessCheckers)
+	k.progress = newProgressKubeClient(ctx, readiness, client.Factory, options.Progress, c.readinessCheckers)
+	k.tracing = newTracingKubeClient(ctx, c.tracer, k.progress)
+
+	return k
+}
+
+// startRender records the start of rendering a chart. Helm renders charts
+// internally so rendering ends when Helm builds the rendered resources for
+// the first time.
+func (k *kubeClients) startRender() {
+	k.tracing.startRender()
+	k.progress.startRender()
+}
@@ -0,0 +1,94 @@
+package helmclient
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace/noop"
+	"helm.sh/helm/v3/pkg/kube"
+)
+
+func Test_Client_newKubeClients(t *testing.T) {
+	testCases := []struct {
+		name             string
+		options          kubeClientOptions
+		expectedKeepCRDs bool
+		expectedNext     func(kubeClient) bool
+	}{
+		{
+			name:             "case 0: Helm kube client",
+			options:          kubeClientOptions{},
+			expectedKeepCRDs: false,
+			expectedNext: func(next kubeClient) bool {
+				_, ok := next.(*kube.Client)
+				return ok
+			},
+		},
+		{
+			name:             "case 1: server-side apply",
+			options:          kubeClientOptions{ServerSideApply: true, FieldManager: "operator", ForceConflicts: true},
+			expectedKeepCRDs: false,
+			expectedNext: func(next kubeClient) bool {
+				client, ok := next.(*serverSideApplyClient)
+				return ok && client.fieldManager == "operator" && client.forceConflicts
+			},
+		},
+		{
+			name:             "case 2: server-side apply with default field manager",
+			options:          kubeClientOptions{ServerSideApply: true},
+			expectedKeepCRDs: false,
+			expectedNext: func(next kubeClient) bool {
+				client, ok := next.(*serverSideApplyClient)
+				return ok && client.fieldManager == defaultFieldManager && !client.forceConflicts
+			},
+		},
+		{
+			name:             "case 3: keeping CRDs",
+			options:          kubeClientOptions{KeepCRDs: true},
+			expectedKeepCRDs: true,
+			expectedNext: func(next kubeClient) bool {
+				_, ok := next.(*keepCRDsClient)
+				return ok
+			},
+		},
+		{
+			name:             "case 4: adopting objects",
+			options:          kubeClientOptions{Adopt: true, ReleaseName: "app", ReleaseNamespace: "default"},
+			expectedKeepCRDs: false,
+			expectedNext: func(next kubeClient) bool {
+				client, ok := next.(*adoptingKubeClient)
+				if !ok || client.releaseName != "app" || client.releaseNamespace != "default" {
+					return false
+				}
+				_, ok = client.kubeClient.(*kube.Client)
+				return ok
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			c := &Client{
+				tracer: noop.NewTracerProvider().Tracer("test"),
+			}
+
+			k := c.newKubeClients(context.Background(), &kube.Client{}, tc.options)
+
+			if (k.keepCRDs != nil) != tc.expectedKeepCRDs {
+				t.Fatalf("expected keeping CRDs %t got %t", tc.expectedKeepCRDs, k.keepCRDs != nil)
+			}
+			if !tc.expectedNext(k.recording.kubeClient) {
+				t.Fatalf("unexpected client %T wrapped by the recording client", k.recording.kubeClient)
+			}
+
+			// Helm must use the tracing client which passes operations on
+			// to the other clients.
+			if k.tracing.kubeClient != kubeClient(k.progress) {
+				t.Fatalf("expected tracing client to wrap the progress client got %T", k.tracing.kubeClient)
+			}
+		})
+	}
+}
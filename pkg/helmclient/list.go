@@ -2,22 +2,48 @@ package helmclient
 
 import (
 	"context"
+	"regexp"
 
 	"github.com/giantswarm/microerror"
-	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// listStates maps release statuses to the state mask used by Helm when
+// listing releases.
+var listStates = map[string]action.ListStates{
+	StatusUnknown:         action.ListUnknown,
+	StatusDeployed:        action.ListDeployed,
+	StatusUninstalled:     action.ListUninstalled,
+	StatusSuperseded:      action.ListSuperseded,
+	StatusFailed:          action.ListFailed,
+	StatusUninstalling:    action.ListUninstalling,
+	StatusPendingInstall:  action.ListPendingInstall,
+	StatusPendingUpgrade:  action.ListPendingUpgrade,
+	StatusPendingRollback: action.ListPendingRollback,
+}
+
 // ListReleaseContents gets the current status of all Helm Releases.
 func (c *Client) ListReleaseContents(ctx context.Context, namespace string) ([]*ReleaseContent, error) {
 	eventName := "list_release_contents"
 
-	t := prometheus.NewTimer(histogram.WithLabelValues(eventName))
-	defer t.ObserveDuration()
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeReleaseNamespace, namespace),
+	))
+	defer span.End()
+
+	m := c.metrics.observe(eventName, namespace)
+	defer m.stop()
 
 	releaseContent, err := c.listReleaseContents(ctx, namespace)
+	err = translateHelmError(err, namespace, "")
 	if err != nil {
-		errorGauge.WithLabelValues(eventName).Inc()
+		m.fail()
+		recordSpanError(span, err)
 		return nil, microerror.Mask(err)
 	}
 
@@ -45,3 +71,142 @@ func (c *Client) listReleaseContents(ctx context.Context, namespace string) ([]*
 
 	return releases, nil
 }
+
+// ListReleases lists Helm Releases in the given namespace, or in all
+// namespaces when options.AllNamespaces is set. Unlike ListReleaseContents
+// releases in any status are returned unless filtered by options.Statuses.
+func (c *Client) ListReleases(ctx context.Context, namespace string, options ListOptions) ([]*ReleaseContent, error) {
+	eventName := "list_releases"
+
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeReleaseNamespace, namespace),
+	))
+	defer span.End()
+
+	m := c.metrics.observe(eventName, namespace)
+	defer m.stop()
+
+	releaseContent, err := c.listReleases(ctx, namespace, options)
+	err = translateHelmError(err, namespace, "")
+	if err != nil {
+		m.fail()
+		recordSpanError(span, err)
+		return nil, microerror.Mask(err)
+	}
+
+	return releaseContent, nil
+}
+
+func (c *Client) listReleases(ctx context.Context, namespace string, options ListOptions) ([]*ReleaseContent, error) {
+	if options.AllNamespaces {
+		// The REST client getter requires a namespace even though it is not
+		// used for listing. The release storage is replaced below.
+		namespace = metav1.NamespaceDefault
+	}
+
+	cfg, err := c.newActionConfig(ctx, namespace)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	if options.AllNamespaces {
+		s := driver.NewSecrets(c.k8sClient.CoreV1().Secrets(metav1.NamespaceAll))
+		cfg.Releases = storage.Init(s)
+	}
+
+	releases, err := listReleasesFrom(cfg, options)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return releases, nil
+}
+
+// listReleasesFrom lists the releases of the release storage of the given
+// action configuration.
+func listReleasesFrom(cfg *action.Configuration, options ListOptions) ([]*ReleaseContent, error) {
+	list := action.NewList(cfg)
+
+	// Configure action with supported list options.
+	err := options.configure(list)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	res, err := list.Run()
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	// Filtering by chart name is not supported by Helm so limit and offset
+	// are applied here afterwards.
+	var releases = []*ReleaseContent{}
+
+	for _, rel := range res {
+		if options.ChartName != "" && (rel.Chart == nil || rel.Chart.Metadata == nil || rel.Chart.Metadata.Name != options.ChartName) {
+			continue
+		}
+
+		releases = append(releases, releaseToReleaseContent(rel))
+	}
+
+	if options.Offset >= len(releases) {
+		return []*ReleaseContent{}, nil
+	}
+	releases = releases[options.Offset:]
+
+	if options.Limit > 0 && options.Limit < len(releases) {
+		releases = releases[:options.Limit]
+	}
+
+	return releases, nil
+}
+
+func (options ListOptions) configure(list *action.List) error {
+	if options.Limit < 0 || options.Offset < 0 {
+		return microerror.Maskf(invalidConfigError, "limit and offset must not be negative")
+	}
+
+	if options.NameFilter != "" {
+		_, err := regexp.Compile(options.NameFilter)
+		if err != nil {
+			return microerror.Maskf(invalidConfigError, "invalid name filter %#q: %s", options.NameFilter, err)
+		}
+	}
+
+	list.StateMask = 0
+	for _, status := range options.Statuses {
+		state, ok := listStates[status]
+		if !ok {
+			return microerror.Maskf(invalidConfigError, "unknown status %#q", status)
+		}
+		list.StateMask |= state
+	}
+	// Helm only considers the latest revision of every release unless
+	// superseded revisions are listed exclusively.
+	if list.StateMask&action.ListSuperseded != 0 && list.StateMask != action.ListSuperseded {
+		return microerror.Maskf(invalidConfigError, "status %#q must not be combined with other statuses", StatusSuperseded)
+	}
+	if list.StateMask == 0 {
+		list.StateMask = action.ListAll
+	}
+
+	switch options.SortBy {
+	case "", ListSortByName:
+		if options.SortReverse {
+			list.Sort = action.ByNameDesc
+		}
+	case ListSortByDate:
+		list.Sort = action.ByDateAsc
+		if options.SortReverse {
+			list.Sort = action.ByDateDesc
+		}
+	default:
+		return microerror.Maskf(invalidConfigError, "unknown sort order %#q", options.SortBy)
+	}
+
+	list.AllNamespaces = options.AllNamespaces
+	list.Filter = options.NameFilter
+
+	return nil
+}
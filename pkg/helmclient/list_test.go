@@ -0,0 +1,218 @@
+package helmclient
+
+import (
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+func Test_ListOptions_configure(t *testing.T) {
+	testCases := []struct {
+		name              string
+		options           ListOptions
+		expectedStateMask action.ListStates
+		// expectedSort is the zero value when sorting by name.
+		expectedSort action.Sorter
+		errorMatcher func(error) bool
+	}{
+		{
+			name:              "case 0: defaults list all statuses by name",
+			options:           ListOptions{},
+			expectedStateMask: action.ListAll,
+		},
+		{
+			name:              "case 1: statuses are combined",
+			options:           ListOptions{Statuses: []string{StatusDeployed, StatusFailed}},
+			expectedStateMask: action.ListDeployed | action.ListFailed,
+		},
+		{
+			name:              "case 2: superseded only",
+			options:           ListOptions{Statuses: []string{StatusSuperseded}},
+			expectedStateMask: action.ListSuperseded,
+		},
+		{
+			name:         "case 3: superseded combined with other statuses",
+			options:      ListOptions{Statuses: []string{StatusSuperseded, StatusDeployed}},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "case 4: unknown status",
+			options:      ListOptions{Statuses: []string{"broken"}},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:              "case 5: newest first",
+			options:           ListOptions{SortBy: ListSortByDate, SortReverse: true},
+			expectedStateMask: action.ListAll,
+			expectedSort:      action.ByDateDesc,
+		},
+		{
+			name:         "case 6: unknown sort order",
+			options:      ListOptions{SortBy: "size"},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "case 7: invalid name filter",
+			options:      ListOptions{NameFilter: "("},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "case 8: negative limit",
+			options:      ListOptions{Limit: -1},
+			errorMatcher: IsInvalidConfig,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			list := action.NewList(&action.Configuration{})
+			err := tc.options.configure(list)
+
+			switch {
+			case err == nil && tc.errorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if list.StateMask != tc.expectedStateMask {
+				t.Fatalf("expected state mask %d got %d", tc.expectedStateMask, list.StateMask)
+			}
+			if list.Sort != tc.expectedSort {
+				t.Fatalf("expected sort %d got %d", tc.expectedSort, list.Sort)
+			}
+		})
+	}
+}
+
+func Test_listReleasesFrom(t *testing.T) {
+	testCases := []struct {
+		name              string
+		options           ListOptions
+		expectedReleases  []string
+		expectedRevisions []int
+	}{
+		{
+			name:              "case 0: latest revisions of all releases",
+			options:           ListOptions{},
+			expectedReleases:  []string{"bar", "baz", "foo"},
+			expectedRevisions: []int{1, 1, 2},
+		},
+		{
+			name:              "case 1: status filter",
+			options:           ListOptions{Statuses: []string{StatusDeployed}},
+			expectedReleases:  []string{"baz", "foo"},
+			expectedRevisions: []int{1, 2},
+		},
+		{
+			name:              "case 2: superseded revisions",
+			options:           ListOptions{Statuses: []string{StatusSuperseded}},
+			expectedReleases:  []string{"foo"},
+			expectedRevisions: []int{1},
+		},
+		{
+			name:              "case 3: chart name filter",
+			options:           ListOptions{ChartName: "a"},
+			expectedReleases:  []string{"baz", "foo"},
+			expectedRevisions: []int{1, 2},
+		},
+		{
+			name:              "case 4: name filter",
+			options:           ListOptions{NameFilter: "^ba"},
+			expectedReleases:  []string{"bar", "baz"},
+			expectedRevisions: []int{1, 1},
+		},
+		{
+			name:              "case 5: offset and limit after the chart name filter",
+			options:           ListOptions{ChartName: "a", Offset: 1, Limit: 1},
+			expectedReleases:  []string{"foo"},
+			expectedRevisions: []int{2},
+		},
+		{
+			name:              "case 6: offset beyond the releases",
+			options:           ListOptions{Offset: 3},
+			expectedReleases:  nil,
+			expectedRevisions: nil,
+		},
+		{
+			name:              "case 7: reverse order",
+			options:           ListOptions{SortReverse: true},
+			expectedReleases:  []string{"foo", "baz", "bar"},
+			expectedRevisions: []int{2, 1, 1},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			cfg := &action.Configuration{
+				KubeClient: &kubefake.FailingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}},
+				Log:        func(string, ...interface{}) {},
+				Releases:   storage.Init(driver.NewMemory()),
+			}
+			for _, rel := range []*release.Release{
+				newListTestRelease("foo", 1, release.StatusSuperseded, "a"),
+				newListTestRelease("foo", 2, release.StatusDeployed, "a"),
+				newListTestRelease("bar", 1, release.StatusFailed, "b"),
+				newListTestRelease("baz", 1, release.StatusDeployed, "a"),
+			} {
+				err := cfg.Releases.Create(rel)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			releases, err := listReleasesFrom(cfg, tc.options)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			var names []string
+			var revisions []int
+			for _, rel := range releases {
+				names = append(names, rel.Name)
+				revisions = append(revisions, rel.Revision)
+			}
+			if diff := cmp.Diff(tc.expectedReleases, names); diff != "" {
+				t.Fatalf("want matching releases \n %s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedRevisions, revisions); diff != "" {
+				t.Fatalf("want matching revisions \n %s", diff)
+			}
+		})
+	}
+}
+
+func newListTestRelease(name string, version int, status release.Status, chartName string) *release.Release {
+	return &release.Release{
+		Name:      name,
+		Namespace: "default",
+		Version:   version,
+		Info:      &release.Info{Status: status},
+		Chart: &chart.Chart{
+			Metadata: &chart.Metadata{
+				Name:    chartName,
+				Version: "1.0.0",
+			},
+		},
+	}
+}
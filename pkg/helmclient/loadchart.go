@@ -4,7 +4,8 @@ import (
 	"context"
 
 	"github.com/giantswarm/microerror"
-	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
 )
@@ -13,12 +14,19 @@ import (
 func (c *Client) LoadChart(ctx context.Context, chartPath string) (Chart, error) {
 	eventName := "load_chart"
 
-	t := prometheus.NewTimer(histogram.WithLabelValues(eventName))
-	defer t.ObserveDuration()
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeChartPath, chartPath),
+	))
+	defer span.End()
+
+	m := c.metrics.observe(eventName, "")
+	defer m.stop()
 
 	chart, err := c.loadChart(ctx, chartPath)
+	err = translateHelmError(err, "", "")
 	if err != nil {
-		errorGauge.WithLabelValues(eventName).Inc()
+		m.fail()
+		recordSpanError(span, err)
 		return Chart{}, microerror.Mask(err)
 	}
 
@@ -26,7 +34,7 @@ func (c *Client) LoadChart(ctx context.Context, chartPath string) (Chart, error)
 }
 
 func (c *Client) loadChart(ctx context.Context, chartPath string) (Chart, error) {
-	chartRequested, err := loader.Load(chartPath)
+	chartRequested, err := c.loadHelmChart(ctx, chartPath)
 	if err != nil {
 		return Chart{}, microerror.Mask(err)
 	}
@@ -34,6 +42,22 @@ func (c *Client) loadChart(ctx context.Context, chartPath string) (Chart, error)
 	return newChart(chartRequested)
 }
 
+// loadHelmChart loads the Helm Chart at the given path within its own span.
+func (c *Client) loadHelmChart(ctx context.Context, chartPath string) (*chart.Chart, error) {
+	_, span := c.tracer.Start(ctx, spanLoadChart, trace.WithAttributes(
+		attribute.String(attributeChartPath, chartPath),
+	))
+	defer span.End()
+
+	chartRequested, err := loader.Load(chartPath)
+	if err != nil {
+		recordSpanError(span, err)
+		return nil, microerror.Mask(err)
+	}
+
+	return chartRequested, nil
+}
+
 func newChart(helmChart *chart.Chart) (Chart, error) {
 	if helmChart == nil || helmChart.Metadata == nil {
 		return Chart{}, microerror.Maskf(executionFailedError, "expected non nil argument but got %#v", helmChart)
@@ -0,0 +1,362 @@
+package helmclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// releaseLeasePrefix is prepended to the release name to build the name of
+	// the coordination.k8s.io Lease guarding the release.
+	releaseLeasePrefix = "helmclient-"
+	// releaseLeaseRetryInterval is the interval in which a Lease held by
+	// another process is polled while waiting for it.
+	releaseLeaseRetryInterval = 2 * time.Second
+)
+
+// releaseLocker serializes operations on the same release within the process.
+// Locks are created on demand and dropped again once nobody holds or waits
+// for them.
+type releaseLocker struct {
+	mutex sync.Mutex
+	locks map[string]*releaseLock
+}
+
+type releaseLock struct {
+	// ch is a semaphore of size one. Using a channel instead of a mutex allows
+	// waiting for the lock to be cancelled via the context.
+	ch   chan struct{}
+	refs int
+}
+
+func newReleaseLocker() *releaseLocker {
+	return &releaseLocker{
+		locks: map[string]*releaseLock{},
+	}
+}
+
+// lock acquires the lock for the given key. It either waits until the lock is
+// free or the context is done, or fails immediately when failFast is true.
+func (r *releaseLocker) lock(ctx context.Context, key string, failFast bool) (func(), error) {
+	r.mutex.Lock()
+	l, ok := r.locks[key]
+	if !ok {
+		l = &releaseLock{ch: make(chan struct{}, 1)}
+		r.locks[key] = l
+	}
+	l.refs++
+	r.mutex.Unlock()
+
+	if failFast {
+		select {
+		case l.ch <- struct{}{}:
+		default:
+			r.release(key, l)
+			return nil, microerror.Maskf(releaseLockedError, "release %#q is locked by another operation in this process", key)
+		}
+	} else {
+		select {
+		case l.ch <- struct{}{}:
+		case <-ctx.Done():
+			r.release(key, l)
+			return nil, microerror.Maskf(releaseLockedError, "waiting for lock of release %#q: %s", key, ctx.Err())
+		}
+	}
+
+	var once sync.Once
+	unlock := func() {
+		once.Do(func() {
+			<-l.ch
+			r.release(key, l)
+		})
+	}
+
+	return unlock, nil
+}
+
+func (r *releaseLocker) release(key string, l *releaseLock) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	l.refs--
+	if l.refs == 0 {
+		delete(r.locks, key)
+	}
+}
+
+// lockRelease guards a mutating operation on the given release. Operations
+// on the same release from within this process are serialized. When release
+// leases are enabled a coordination.k8s.io Lease is acquired in addition so
+// that other processes using this library are excluded as well. The operation
+// must use the returned context. It is cancelled with a releaseLockedError as
+// cause once the Lease cannot be renewed anymore. The returned function must
+// be called once the operation finished.
+func (c *Client) lockRelease(ctx context.Context, namespace, releaseName string) (context.Context, func(), error) {
+	key := fmt.Sprintf("%s/%s", namespace, releaseName)
+
+	_, span := c.tracer.Start(ctx, spanLockRelease, trace.WithAttributes(
+		attribute.String(attributeReleaseNamespace, namespace),
+		attribute.String(attributeReleaseName, releaseName),
+	))
+	defer span.End()
+
+	unlock, err := c.releaseLocker.lock(ctx, key, c.releaseLockFailFast)
+	if err != nil {
+		recordSpanError(span, err)
+		return nil, nil, microerror.Mask(err)
+	}
+
+	if !c.releaseLease {
+		return ctx, unlock, nil
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	unlease, err := c.acquireReleaseLease(ctx, namespace, releaseName, cancel)
+	if err != nil {
+		cancel(nil)
+		unlock()
+		recordSpanError(span, err)
+		return nil, nil, microerror.Mask(err)
+	}
+
+	return ctx, func() {
+		unlease()
+		cancel(nil)
+		unlock()
+	}, nil
+}
+
+// cancellationCause returns the cause the given operation context was
+// cancelled with, e.g. the releaseLockedError of a lost Lease, in place of the
+// error of the cancelled operation. Other errors are returned as is.
+func cancellationCause(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+
+	cause := context.Cause(ctx)
+	if errors.Is(cause, ctx.Err()) {
+		return err
+	}
+
+	return cause
+}
+
+// acquireReleaseLease acquires the Lease of the given release and keeps
+// renewing it until the returned function is called. When the Lease is lost,
+// either because another holder took it over or because it could not be
+// renewed before it expired, the operation is cancelled using the given
+// function.
+func (c *Client) acquireReleaseLease(ctx context.Context, namespace, releaseName string, cancelOperation context.CancelCauseFunc) (func(), error) {
+	name := releaseLeasePrefix + releaseName
+
+	var lease *coordinationv1.Lease
+	o := func(ctx context.Context) (bool, error) {
+		l, err := c.tryAcquireReleaseLease(ctx, namespace, name)
+		if IsReleaseLocked(err) && !c.releaseLockFailFast {
+			c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waiting for lease %#q in namespace %#q", name, namespace))
+			return false, nil
+		} else if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) {
+			// Somebody else modified the lease in the meantime. Try again.
+			return false, nil
+		} else if err != nil {
+			return false, microerror.Mask(err)
+		}
+
+		lease = l
+
+		return true, nil
+	}
+
+	err := wait.PollUntilContextCancel(ctx, releaseLeaseRetryInterval, true, o)
+	if wait.Interrupted(err) {
+		return nil, microerror.Maskf(releaseLockedError, "waiting for lease %#q in namespace %#q: %s", name, namespace, err)
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	// Renew the lease in the background for as long as the operation runs.
+	// The operation context is not used here since the lease must be renewed
+	// and released even when the operation is cancelled.
+	renewCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	done := make(chan struct{})
+	lost := false
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(c.releaseLeaseDuration / 3)
+		defer ticker.Stop()
+
+		renewed := time.Now()
+
+		for {
+			select {
+			case <-renewCtx.Done():
+				return
+			case <-ticker.C:
+				updated, err := c.renewReleaseLease(renewCtx, lease)
+				if err == nil {
+					lease = updated
+					renewed = time.Now()
+					continue
+				}
+
+				if IsReleaseLocked(err) || time.Since(renewed) >= c.releaseLeaseDuration {
+					c.logger.LogCtx(renewCtx, "level", "error", "message", fmt.Sprintf("lost lease %#q in namespace %#q", name, namespace), "stack", fmt.Sprintf("%#v", err))
+					lost = true
+					cancelOperation(microerror.Maskf(releaseLockedError, "lost lease %#q in namespace %#q: %s", name, namespace, err))
+					return
+				}
+
+				c.logger.LogCtx(renewCtx, "level", "warning", "message", fmt.Sprintf("failed to renew lease %#q in namespace %#q", name, namespace), "stack", fmt.Sprintf("%#v", err))
+			}
+		}
+	}()
+
+	var once sync.Once
+	unlease := func() {
+		once.Do(func() {
+			cancel()
+			<-done
+
+			// A lost lease may already be held by another process.
+			if lost {
+				return
+			}
+
+			// Only delete the lease when we still hold it. The precondition
+			// protects against deleting a lease another process took over
+			// after ours expired.
+			err := c.k8sClient.CoordinationV1().Leases(namespace).Delete(context.WithoutCancel(ctx), name, metav1.DeleteOptions{
+				Preconditions: &metav1.Preconditions{
+					ResourceVersion: &lease.ResourceVersion,
+				},
+			})
+			if err != nil && !apierrors.IsNotFound(err) {
+				c.logger.LogCtx(ctx, "level", "warning", "message", fmt.Sprintf("failed to release lease %#q in namespace %#q", name, namespace), "stack", fmt.Sprintf("%#v", err))
+			}
+		})
+	}
+
+	return unlease, nil
+}
+
+// renewReleaseLease updates the renew time of the given Lease. When the
+// update conflicts the current Lease is fetched again and renewed if it is
+// still held by this client. Otherwise a releaseLockedError is returned.
+func (c *Client) renewReleaseLease(ctx context.Context, lease *coordinationv1.Lease) (*coordinationv1.Lease, error) {
+	leases := c.k8sClient.CoordinationV1().Leases(lease.Namespace)
+
+	now := metav1.NewMicroTime(time.Now())
+
+	renewed := lease.DeepCopy()
+	renewed.Spec.RenewTime = &now
+
+	updated, err := leases.Update(ctx, renewed, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		current, err := leases.Get(ctx, lease.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		if current.Spec.HolderIdentity == nil || *current.Spec.HolderIdentity != c.releaseLeaseIdentity {
+			return nil, microerror.Maskf(releaseLockedError, "lease %#q in namespace %#q was taken over", lease.Name, lease.Namespace)
+		}
+
+		current.Spec.RenewTime = &now
+
+		updated, err = leases.Update(ctx, current, metav1.UpdateOptions{})
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return updated, nil
+}
+
+// tryAcquireReleaseLease creates or takes over the given Lease. It returns a
+// releaseLockedError when the Lease is held by another holder and has not
+// expired yet.
+func (c *Client) tryAcquireReleaseLease(ctx context.Context, namespace, name string) (*coordinationv1.Lease, error) {
+	leases := c.k8sClient.CoordinationV1().Leases(namespace)
+
+	now := metav1.NewMicroTime(time.Now())
+	duration := int32(c.releaseLeaseDuration / time.Second)
+
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
+			Spec: coordinationv1.LeaseSpec{
+				AcquireTime:          &now,
+				HolderIdentity:       &c.releaseLeaseIdentity,
+				LeaseDurationSeconds: &duration,
+				RenewTime:            &now,
+			},
+		}
+
+		lease, err = leases.Create(ctx, lease, metav1.CreateOptions{})
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		return lease, nil
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	if isLeaseHeld(lease, c.releaseLeaseIdentity, now.Time) {
+		return nil, microerror.Maskf(releaseLockedError, "lease %#q in namespace %#q is held by %#q", name, namespace, *lease.Spec.HolderIdentity)
+	}
+
+	transitions := int32(1)
+	if lease.Spec.LeaseTransitions != nil {
+		transitions = *lease.Spec.LeaseTransitions + 1
+	}
+
+	lease.Spec.AcquireTime = &now
+	lease.Spec.HolderIdentity = &c.releaseLeaseIdentity
+	lease.Spec.LeaseDurationSeconds = &duration
+	lease.Spec.LeaseTransitions = &transitions
+	lease.Spec.RenewTime = &now
+
+	lease, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return lease, nil
+}
+
+// isLeaseHeld returns true when the lease is held by a holder other than the
+// given identity and has not expired yet.
+func isLeaseHeld(lease *coordinationv1.Lease, identity string, now time.Time) bool {
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" || *lease.Spec.HolderIdentity == identity {
+		return false
+	}
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return false
+	}
+
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+
+	return now.Before(expiry)
+}
@@ -0,0 +1,288 @@
+package helmclient
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	"go.opentelemetry.io/otel/trace/noop"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func Test_releaseLocker(t *testing.T) {
+	ctx := context.Background()
+	l := newReleaseLocker()
+
+	unlock, err := l.lock(ctx, "default/foo", false)
+	if err != nil {
+		t.Fatalf("expected nil error got %#v", err)
+	}
+
+	// A different release must not be blocked.
+	unlockBar, err := l.lock(ctx, "default/bar", true)
+	if err != nil {
+		t.Fatalf("expected nil error got %#v", err)
+	}
+	unlockBar()
+
+	_, err = l.lock(ctx, "default/foo", true)
+	if !IsReleaseLocked(err) {
+		t.Fatalf("expected releaseLockedError got %#v", err)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	_, err = l.lock(timeoutCtx, "default/foo", false)
+	if !IsReleaseLocked(err) {
+		t.Fatalf("expected releaseLockedError got %#v", err)
+	}
+
+	unlock()
+	// Calling unlock twice must not release a lock acquired by someone else.
+	unlock()
+
+	unlock, err = l.lock(ctx, "default/foo", true)
+	if err != nil {
+		t.Fatalf("expected nil error got %#v", err)
+	}
+	unlock()
+
+	if len(l.locks) != 0 {
+		t.Fatalf("expected no locks left got %d", len(l.locks))
+	}
+}
+
+func Test_Client_renewReleaseLease(t *testing.T) {
+	testCases := []struct {
+		name           string
+		conflict       bool
+		holder         string
+		expectedErr    func(error) bool
+		expectedHolder string
+	}{
+		{
+			name:           "case 0: lease is renewed",
+			holder:         "helmclient",
+			expectedHolder: "helmclient",
+		},
+		{
+			name:           "case 1: lease is fetched again and renewed on conflict",
+			conflict:       true,
+			holder:         "helmclient",
+			expectedHolder: "helmclient",
+		},
+		{
+			name:        "case 2: lease taken over by another holder is lost",
+			conflict:    true,
+			holder:      "other",
+			expectedErr: IsReleaseLocked,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			ctx := context.Background()
+			renewTime := metav1.NewMicroTime(time.Now().Add(-time.Minute))
+
+			k8sClient := fake.NewSimpleClientset(&coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "helmclient-foo",
+					Namespace:       "default",
+					ResourceVersion: "2",
+				},
+				Spec: coordinationv1.LeaseSpec{
+					HolderIdentity: &tc.holder,
+					RenewTime:      &renewTime,
+				},
+			})
+
+			conflicts := 0
+			if tc.conflict {
+				k8sClient.PrependReactor("update", "leases", func(action clienttesting.Action) (bool, runtime.Object, error) {
+					lease := action.(clienttesting.UpdateAction).GetObject().(*coordinationv1.Lease)
+					if lease.ResourceVersion != "1" {
+						return false, nil, nil
+					}
+					conflicts++
+					return true, nil, apierrors.NewConflict(coordinationv1.Resource("leases"), lease.Name, errors.New("object has been modified"))
+				})
+			}
+
+			c := &Client{
+				k8sClient:            k8sClient,
+				releaseLeaseIdentity: "helmclient",
+			}
+
+			// The lease held in memory is outdated when the update conflicts.
+			held := &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "helmclient-foo",
+					Namespace:       "default",
+					ResourceVersion: "2",
+				},
+				Spec: coordinationv1.LeaseSpec{
+					HolderIdentity: &c.releaseLeaseIdentity,
+					RenewTime:      &renewTime,
+				},
+			}
+			if tc.conflict {
+				held.ResourceVersion = "1"
+			}
+
+			lease, err := c.renewReleaseLease(ctx, held)
+			switch {
+			case err == nil && tc.expectedErr == nil:
+				// correct; carry on
+			case err != nil && tc.expectedErr == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.expectedErr != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.expectedErr(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if tc.conflict && conflicts != 1 {
+				t.Fatalf("expected 1 conflict got %d", conflicts)
+			}
+			if tc.expectedErr != nil {
+				return
+			}
+
+			if *lease.Spec.HolderIdentity != tc.expectedHolder {
+				t.Fatalf("expected holder %#q got %#q", tc.expectedHolder, *lease.Spec.HolderIdentity)
+			}
+			if !lease.Spec.RenewTime.After(renewTime.Time) {
+				t.Fatalf("expected renew time after %s got %s", renewTime, lease.Spec.RenewTime)
+			}
+		})
+	}
+}
+
+func Test_Client_lockRelease_leaseLost(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+
+	c := &Client{
+		k8sClient:            k8sClient,
+		logger:               microloggertest.New(),
+		releaseLease:         true,
+		releaseLeaseDuration: 30 * time.Millisecond,
+		releaseLeaseIdentity: "helmclient",
+		releaseLocker:        newReleaseLocker(),
+		tracer:               noop.NewTracerProvider().Tracer("test"),
+	}
+
+	// The fake clientset does not implement optimistic concurrency. Reject
+	// updates of outdated leases like the API server does.
+	leasesResource := coordinationv1.SchemeGroupVersion.WithResource("leases")
+	k8sClient.PrependReactor("update", "leases", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		lease := action.(clienttesting.UpdateAction).GetObject().(*coordinationv1.Lease)
+		current, err := k8sClient.Tracker().Get(leasesResource, lease.Namespace, lease.Name)
+		if err != nil {
+			return false, nil, nil
+		}
+		if current.(*coordinationv1.Lease).ResourceVersion != lease.ResourceVersion {
+			return true, nil, apierrors.NewConflict(leasesResource.GroupResource(), lease.Name, errors.New("object has been modified"))
+		}
+		return false, nil, nil
+	})
+
+	ctx, unlock, err := c.lockRelease(context.Background(), "default", "foo")
+	if err != nil {
+		t.Fatalf("expected nil error got %#v", err)
+	}
+	defer unlock()
+
+	// Another process takes over the lease.
+	lease, err := k8sClient.CoordinationV1().Leases("default").Get(context.Background(), "helmclient-foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := "other"
+	lease.Spec.HolderIdentity = &other
+	lease.ResourceVersion = "2"
+	err = k8sClient.Tracker().Update(leasesResource, lease, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("expected operation context to be cancelled")
+	}
+
+	if !IsReleaseLocked(context.Cause(ctx)) {
+		t.Fatalf("expected releaseLockedError got %#v", context.Cause(ctx))
+	}
+}
+
+func Test_cancellationCause(t *testing.T) {
+	lost := errors.New("lost lease")
+	failed := errors.New("failed")
+
+	testCases := []struct {
+		name          string
+		ctx           func() context.Context
+		err           error
+		expectedError error
+	}{
+		{
+			name:          "case 0: operation not cancelled",
+			ctx:           context.Background,
+			err:           failed,
+			expectedError: failed,
+		},
+		{
+			name: "case 1: operation cancelled with cause",
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancelCause(context.Background())
+				cancel(lost)
+				return ctx
+			},
+			err:           context.Canceled,
+			expectedError: lost,
+		},
+		{
+			name: "case 2: operation cancelled without cause",
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			},
+			err:           context.Canceled,
+			expectedError: context.Canceled,
+		},
+		{
+			name: "case 3: no error",
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancelCause(context.Background())
+				cancel(lost)
+				return ctx
+			},
+			err:           nil,
+			expectedError: nil,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			err := cancellationCause(tc.ctx(), tc.err)
+			if err != tc.expectedError {
+				t.Fatalf("error == %#v, want %#v", err, tc.expectedError)
+			}
+		})
+	}
+}
@@ -1,7 +1,18 @@
 package helmclient
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
 	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/metadata"
 )
 
 const (
@@ -9,38 +20,252 @@ const (
 	PrometheusSubsystem = "library"
 )
 
+const (
+	// releaseMetricsTimeout is the maximum time listing the release storage
+	// may take when the releases gauge is collected.
+	releaseMetricsTimeout = 10 * time.Second
+)
+
+// Values of the result label.
+const (
+	resultError   = "error"
+	resultSuccess = "success"
+)
+
+// Values of the source label of pull metrics.
+const (
+	pullSourceHTTP = "http"
+	pullSourceOCI  = "oci"
+)
+
 var (
-	errorGauge = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: PrometheusNamespace,
-			Subsystem: PrometheusSubsystem,
-			Name:      "error_total",
-			Help:      "Number of helmclient errors.",
-		},
-		[]string{"event"},
-	)
-	eventCounter = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Namespace: PrometheusNamespace,
-			Subsystem: PrometheusSubsystem,
-			Name:      "event_total",
-			Help:      "Number of helmclient events.",
-		},
-		[]string{"event", "release"},
-	)
-	histogram = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Namespace: PrometheusNamespace,
-			Subsystem: PrometheusSubsystem,
-			Name:      "event",
-			Help:      "Histogram for events within the helmclient library.",
-		},
-		[]string{"event"},
+	releasesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(PrometheusNamespace, PrometheusSubsystem, "releases"),
+		"Number of Helm releases by the status of their latest revision.",
+		[]string{"namespace", "status"},
+		nil,
 	)
 )
 
-func init() {
-	prometheus.MustRegister(errorGauge)
-	prometheus.MustRegister(eventCounter)
-	prometheus.MustRegister(histogram)
+// metrics are the Prometheus metrics of a Client. Clients registering on the
+// same prometheus.Registerer share their metrics.
+type metrics struct {
+	duration  *prometheus.HistogramVec
+	events    *prometheus.CounterVec
+	pullBytes *prometheus.HistogramVec
+	pulls     *prometheus.CounterVec
+}
+
+// metricsConfig configures the metrics of a Client.
+type metricsConfig struct {
+	Logger         micrologger.Logger
+	MetadataClient metadata.Interface
+	Registerer     prometheus.Registerer
+	// ReleaseNamespaces enables the releases gauge for the given namespaces.
+	// It is not registered if this is empty.
+	ReleaseNamespaces []string
+}
+
+func newMetrics(config metricsConfig) (*metrics, error) {
+	registerer := config.Registerer
+
+	m := &metrics{
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: PrometheusNamespace,
+				Subsystem: PrometheusSubsystem,
+				Name:      "event",
+				Help:      "Histogram for events within the helmclient library.",
+			},
+			[]string{"event"},
+		),
+		events: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: PrometheusNamespace,
+				Subsystem: PrometheusSubsystem,
+				Name:      "event_total",
+				Help:      "Number of helmclient events by release namespace and result.",
+			},
+			[]string{"event", "namespace", "result"},
+		),
+		pullBytes: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: PrometheusNamespace,
+				Subsystem: PrometheusSubsystem,
+				Name:      "pull_bytes",
+				Help:      "Size of pulled chart tarballs in bytes.",
+				Buckets:   prometheus.ExponentialBuckets(1024, 4, 10),
+			},
+			[]string{"source"},
+		),
+		pulls: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: PrometheusNamespace,
+				Subsystem: PrometheusSubsystem,
+				Name:      "pull_total",
+				Help:      "Number of chart tarball pulls by source and result.",
+			},
+			[]string{"source", "result"},
+		),
+	}
+
+	var err error
+
+	m.duration, err = register(registerer, m.duration)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	m.events, err = register(registerer, m.events)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	m.pullBytes, err = register(registerer, m.pullBytes)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	m.pulls, err = register(registerer, m.pulls)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	if len(config.ReleaseNamespaces) > 0 {
+		// The releases gauge reports the state of a single cluster. It
+		// must not be shared so conflicting registrations are rejected.
+		err = registerer.Register(&releasesCollector{
+			logger:         config.Logger,
+			metadataClient: config.MetadataClient,
+			namespaces:     config.ReleaseNamespaces,
+		})
+		if err != nil {
+			return nil, microerror.Maskf(invalidConfigError, "releases gauge cannot be registered, use a separate prometheus.Registerer per Client: %s", err)
+		}
+	}
+
+	return m, nil
+}
+
+// register registers the collector. If an equal collector is registered
+// already, e.g. by another Client, the existing one is returned. Only
+// collectors aggregating events of all clients may be shared this way.
+func register[T prometheus.Collector](registerer prometheus.Registerer, collector T) (T, error) {
+	err := registerer.Register(collector)
+
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) {
+		existing, ok := alreadyRegistered.ExistingCollector.(T)
+		if !ok {
+			return collector, microerror.Maskf(invalidConfigError, "metric collector registered with unexpected type %T", alreadyRegistered.ExistingCollector)
+		}
+		return existing, nil
+	} else if err != nil {
+		return collector, microerror.Mask(err)
+	}
+
+	return collector, nil
+}
+
+// observe starts observing an event on a release in the given namespace. The
+// returned eventObserver must be stopped once the event finished.
+func (m *metrics) observe(event, namespace string) *eventObserver {
+	return &eventObserver{
+		metrics:   m,
+		event:     event,
+		namespace: namespace,
+		result:    resultSuccess,
+		timer:     prometheus.NewTimer(m.duration.WithLabelValues(event)),
+	}
+}
+
+// observePull counts a pull from the given source and records the size of the
+// pulled tarball if the pull succeeded.
+func (m *metrics) observePull(source string, size int64, err error) {
+	if err != nil {
+		m.pulls.WithLabelValues(source, resultError).Inc()
+		return
+	}
+
+	m.pulls.WithLabelValues(source, resultSuccess).Inc()
+	m.pullBytes.WithLabelValues(source).Observe(float64(size))
+}
+
+// eventObserver records the duration and result of a single event.
+type eventObserver struct {
+	metrics   *metrics
+	event     string
+	namespace string
+	result    string
+	timer     *prometheus.Timer
+}
+
+// fail marks the event as failed.
+func (o *eventObserver) fail() {
+	o.result = resultError
+}
+
+// stop records the duration and counts the event with its result.
+func (o *eventObserver) stop() {
+	o.timer.ObserveDuration()
+	o.metrics.events.WithLabelValues(o.event, o.namespace, o.result).Inc()
+}
+
+// releasesCollector reports the number of releases per namespace and status
+// of their latest revision. The release storage of the configured namespaces
+// is listed on every collection. Only the metadata of Helm's storage secrets
+// is fetched so that no release payload is transferred. Namespaces which
+// cannot be listed, e.g. due to missing RBAC permissions, are logged and
+// skipped so that they do not fail the whole collection.
+type releasesCollector struct {
+	logger         micrologger.Logger
+	metadataClient metadata.Interface
+	namespaces     []string
+}
+
+func (c *releasesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- releasesDesc
+}
+
+func (c *releasesCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseMetricsTimeout)
+	defer cancel()
+
+	var secrets []metav1.PartialObjectMetadata
+	for _, namespace := range c.namespaces {
+		list, err := c.metadataClient.Resource(corev1.SchemeGroupVersion.WithResource("secrets")).Namespace(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: releaseStorageOwnerSelector,
+		})
+		if err != nil {
+			c.logger.LogCtx(ctx, "level", "warning", "message", fmt.Sprintf("failed to list release storage in namespace %#q for releases gauge", namespace), "stack", fmt.Sprintf("%#v", err))
+			continue
+		}
+		secrets = append(secrets, list.Items...)
+	}
+
+	type latest struct {
+		status  string
+		version int
+	}
+
+	// Only the latest revision of every release counts.
+	releases := map[[2]string]latest{}
+	for _, secret := range secrets {
+		version, err := strconv.Atoi(secret.Labels["version"])
+		if err != nil {
+			continue
+		}
+
+		key := [2]string{secret.Namespace, secret.Labels["name"]}
+		if l, ok := releases[key]; ok && l.version > version {
+			continue
+		}
+		releases[key] = latest{status: secret.Labels["status"], version: version}
+	}
+
+	counts := map[[2]string]int{}
+	for key, l := range releases {
+		counts[[2]string{key[0], l.status}]++
+	}
+
+	for key, count := range counts {
+		ch <- prometheus.MustNewConstMetric(releasesDesc, prometheus.GaugeValue, float64(count), key[0], key[1])
+	}
 }
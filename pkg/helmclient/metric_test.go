@@ -0,0 +1,167 @@
+package helmclient
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func Test_newMetrics_sharedRegisterer(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	first, err := newMetrics(metricsConfig{Registerer: registry})
+	if err != nil {
+		t.Fatalf("expected nil error got %#v", err)
+	}
+	second, err := newMetrics(metricsConfig{Registerer: registry})
+	if err != nil {
+		t.Fatalf("expected nil error got %#v", err)
+	}
+
+	m := first.observe("install_release_from_tarball", "default")
+	m.stop()
+	m = second.observe("install_release_from_tarball", "default")
+	m.fail()
+	m.stop()
+
+	expected := `
+# HELP helmclient_library_event_total Number of helmclient events by release namespace and result.
+# TYPE helmclient_library_event_total counter
+helmclient_library_event_total{event="install_release_from_tarball",namespace="default",result="error"} 1
+helmclient_library_event_total{event="install_release_from_tarball",namespace="default",result="success"} 1
+`
+	err = testutil.GatherAndCompare(registry, strings.NewReader(expected), "helmclient_library_event_total")
+	if err != nil {
+		t.Fatalf("expected nil error got %s", err)
+	}
+}
+
+func Test_metrics_observePull(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	m, err := newMetrics(metricsConfig{Registerer: registry})
+	if err != nil {
+		t.Fatalf("expected nil error got %#v", err)
+	}
+
+	m.observePull(pullSourceHTTP, 2048, nil)
+	m.observePull(pullSourceOCI, 0, errors.New("pull failed"))
+
+	expected := `
+# HELP helmclient_library_pull_bytes Size of pulled chart tarballs in bytes.
+# TYPE helmclient_library_pull_bytes histogram
+helmclient_library_pull_bytes_bucket{source="http",le="1024"} 0
+helmclient_library_pull_bytes_bucket{source="http",le="4096"} 1
+helmclient_library_pull_bytes_bucket{source="http",le="16384"} 1
+helmclient_library_pull_bytes_bucket{source="http",le="65536"} 1
+helmclient_library_pull_bytes_bucket{source="http",le="262144"} 1
+helmclient_library_pull_bytes_bucket{source="http",le="1.048576e+06"} 1
+helmclient_library_pull_bytes_bucket{source="http",le="4.194304e+06"} 1
+helmclient_library_pull_bytes_bucket{source="http",le="1.6777216e+07"} 1
+helmclient_library_pull_bytes_bucket{source="http",le="6.7108864e+07"} 1
+helmclient_library_pull_bytes_bucket{source="http",le="2.68435456e+08"} 1
+helmclient_library_pull_bytes_bucket{source="http",le="+Inf"} 1
+helmclient_library_pull_bytes_sum{source="http"} 2048
+helmclient_library_pull_bytes_count{source="http"} 1
+# HELP helmclient_library_pull_total Number of chart tarball pulls by source and result.
+# TYPE helmclient_library_pull_total counter
+helmclient_library_pull_total{result="error",source="oci"} 1
+helmclient_library_pull_total{result="success",source="http"} 1
+`
+	err = testutil.GatherAndCompare(registry, strings.NewReader(expected), "helmclient_library_pull_total", "helmclient_library_pull_bytes")
+	if err != nil {
+		t.Fatalf("expected nil error got %s", err)
+	}
+}
+
+func Test_newMetrics_releasesGaugeConflict(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	config := metricsConfig{
+		Logger:            microloggertest.New(),
+		MetadataClient:    metadatafake.NewSimpleMetadataClient(newMetadataTestScheme()),
+		Registerer:        registry,
+		ReleaseNamespaces: []string{"default"},
+	}
+
+	_, err := newMetrics(config)
+	if err != nil {
+		t.Fatalf("expected nil error got %#v", err)
+	}
+	_, err = newMetrics(config)
+	if !IsInvalidConfig(err) {
+		t.Fatalf("expected invalid config error got %#v", err)
+	}
+}
+
+func Test_releasesCollector(t *testing.T) {
+	metadataClient := metadatafake.NewSimpleMetadataClient(
+		newMetadataTestScheme(),
+		newReleaseStorageSecret("default", "a", 1, "superseded"),
+		newReleaseStorageSecret("default", "a", 2, "deployed"),
+		newReleaseStorageSecret("default", "b", 1, "deployed"),
+		newReleaseStorageSecret("default", "c", 1, "deployed"),
+		newReleaseStorageSecret("default", "c", 2, "failed"),
+		newReleaseStorageSecret("giantswarm", "a", 1, "pending-upgrade"),
+		newReleaseStorageSecret("ignored", "a", 1, "deployed"),
+	)
+	metadataClient.PrependReactor("list", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() != "forbidden" {
+			return false, nil, nil
+		}
+		return true, nil, apierrors.NewForbidden(corev1.Resource("secrets"), "", errors.New("missing permissions"))
+	})
+
+	collector := &releasesCollector{
+		logger:         microloggertest.New(),
+		metadataClient: metadataClient,
+		namespaces:     []string{"default", "forbidden", "giantswarm"},
+	}
+
+	expected := `
+# HELP helmclient_library_releases Number of Helm releases by the status of their latest revision.
+# TYPE helmclient_library_releases gauge
+helmclient_library_releases{namespace="default",status="deployed"} 2
+helmclient_library_releases{namespace="default",status="failed"} 1
+helmclient_library_releases{namespace="giantswarm",status="pending-upgrade"} 1
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected))
+	if err != nil {
+		t.Fatalf("expected nil error got %s", err)
+	}
+}
+
+func newMetadataTestScheme() *runtime.Scheme {
+	scheme := metadatafake.NewTestScheme()
+	_ = metav1.AddMetaToScheme(scheme)
+	return scheme
+}
+
+func newReleaseStorageSecret(namespace, name string, version int, status string) runtime.Object {
+	return &metav1.PartialObjectMetadata{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "sh.helm.release.v1." + name + ".v" + strconv.Itoa(version),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"name":    name,
+				"owner":   "helm",
+				"status":  status,
+				"version": strconv.Itoa(version),
+			},
+		},
+	}
+}
@@ -0,0 +1,361 @@
+package helmclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// manifestSeparatorRegexp matches the lines separating the documents of a
+// manifest.
+var manifestSeparatorRegexp = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// MigrateRelease moves a Helm Release to another storage namespace and/or
+// renames it without touching the running workloads. All revisions are
+// rewritten into the target storage so that the history including rollbacks
+// keeps working. The ownership annotations of the objects managed by the
+// release are updated to point to the migrated release.
+//
+// Namespaced objects rendered without an explicit namespace keep running in
+// the original namespace. Their namespace is pinned in the stored manifests so
+// that the next upgrade in the target namespace replaces them.
+func (c *Client) MigrateRelease(ctx context.Context, namespace, releaseName string, options MigrateOptions) error {
+	eventName := "migrate_release"
+
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeReleaseNamespace, namespace),
+		attribute.String(attributeReleaseName, releaseName),
+	))
+	defer span.End()
+
+	m := c.metrics.observe(eventName, namespace)
+	defer m.stop()
+
+	audit := c.newAudit(AuditOperationMigrate, namespace, releaseName, nil)
+	err := c.migrateRelease(ctx, audit, namespace, releaseName, options)
+	err = translateHelmError(err, namespace, releaseName)
+	audit.finish(ctx, err)
+	if err != nil {
+		m.fail()
+		recordSpanError(span, err)
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (c *Client) migrateRelease(ctx context.Context, audit *auditTrail, namespace, releaseName string, options MigrateOptions) error {
+	if options.Namespace == "" {
+		options.Namespace = namespace
+	}
+	if options.ReleaseName == "" {
+		options.ReleaseName = releaseName
+	}
+	if options.Namespace == namespace && options.ReleaseName == releaseName {
+		return microerror.Maskf(invalidConfigError, "migration target must differ from release %#q in namespace %#q", releaseName, namespace)
+	}
+
+	// Both releases are locked in a stable order so that concurrent
+	// migrations in opposite directions cannot deadlock.
+	locks := [][2]string{
+		{namespace, releaseName},
+		{options.Namespace, options.ReleaseName},
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		if locks[i][0] != locks[j][0] {
+			return locks[i][0] < locks[j][0]
+		}
+		return locks[i][1] < locks[j][1]
+	})
+	for _, l := range locks {
+		lockCtx, unlock, err := c.lockRelease(ctx, l[0], l[1])
+		if err != nil {
+			return microerror.Mask(err)
+		}
+		defer unlock()
+		ctx = lockCtx
+	}
+
+	audit.start(ctx)
+
+	cfg, err := c.newActionConfig(ctx, namespace)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	targetCfg, err := c.newActionConfig(ctx, options.Namespace)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = c.moveRelease(ctx, cfg.Releases, targetCfg.Releases, namespace, releaseName, options)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// moveRelease writes all revisions of the given release into the target
+// storage and deletes them from the source storage. When this fails after
+// the migrated revisions were written, the migration is undone so that the
+// original release keeps working.
+func (c *Client) moveRelease(ctx context.Context, source, target *storage.Storage, namespace, releaseName string, options MigrateOptions) error {
+	history, err := source.History(releaseName)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	var latest *release.Release
+	for _, rel := range history {
+		if latest == nil || rel.Version > latest.Version {
+			latest = rel
+		}
+	}
+	if latest == nil {
+		return microerror.Maskf(releaseNotFoundError, "release %#q not found in namespace %#q", releaseName, namespace)
+	}
+
+	status := release.StatusUnknown
+	if latest.Info != nil {
+		status = latest.Info.Status
+	}
+	if status.IsPending() {
+		return microerror.Maskf(executionFailedError, "release %#q in namespace %#q has pending status %#q", releaseName, namespace, status)
+	}
+
+	existing, err := target.History(options.ReleaseName)
+	if err != nil && !IsReleaseNotFound(err) {
+		return microerror.Mask(err)
+	} else if len(existing) > 0 {
+		return microerror.Maskf(releaseAlreadyExistsError, "release %#q already exists in namespace %#q", options.ReleaseName, options.Namespace)
+	}
+
+	// Write the migrated revisions first. The original revisions are only
+	// deleted once the migrated release is complete.
+	var migrated []*release.Release
+	for _, rel := range history {
+		r, err := c.migrateRevision(rel, options)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+		migrated = append(migrated, r)
+	}
+
+	err = c.createRevisions(ctx, target, migrated)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	if status != release.StatusUninstalled {
+		err = c.updateOwnership(ctx, latest, options)
+		if err != nil {
+			c.undoMigration(ctx, source, target, latest, migrated, nil)
+			return microerror.Mask(err)
+		}
+	}
+
+	for i, rel := range history {
+		_, err = source.Delete(rel.Name, rel.Version)
+		if err != nil && !IsReleaseNotFound(err) {
+			c.undoMigration(ctx, source, target, latest, migrated, history[:i])
+			return microerror.Mask(err)
+		}
+	}
+
+	return nil
+}
+
+// undoMigration restores the ownership of the objects of the latest original
+// revision and the original revisions deleted so far and deletes the migrated
+// revisions. Failures are only logged as undoing runs after the migration
+// failed already.
+func (c *Client) undoMigration(ctx context.Context, source, target *storage.Storage, latest *release.Release, migrated, deleted []*release.Release) {
+	if latest.Info == nil || latest.Info.Status != release.StatusUninstalled {
+		err := c.updateOwnership(ctx, latest, MigrateOptions{Namespace: latest.Namespace, ReleaseName: latest.Name})
+		if err != nil {
+			c.logger.LogCtx(ctx, "level", "warning", "message", fmt.Sprintf("failed to restore ownership of release %#q in namespace %#q", latest.Name, latest.Namespace), "stack", fmt.Sprintf("%#v", err))
+		}
+	}
+
+	for _, rel := range deleted {
+		err := source.Create(rel)
+		if err != nil {
+			c.logger.LogCtx(ctx, "level", "warning", "message", fmt.Sprintf("failed to restore revision %d of release %#q in namespace %#q", rel.Version, rel.Name, rel.Namespace), "stack", fmt.Sprintf("%#v", err))
+		}
+	}
+
+	c.deleteRevisions(ctx, target, migrated)
+}
+
+// migrateRevision returns a copy of the given revision renamed and moved to
+// the target of the migration.
+func (c *Client) migrateRevision(rel *release.Release, options MigrateOptions) (*release.Release, error) {
+	migrated := *rel
+	migrated.Name = options.ReleaseName
+	migrated.Namespace = options.Namespace
+
+	if options.Namespace != rel.Namespace {
+		manifest, err := c.pinManifestNamespace(rel.Manifest, rel.Namespace)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+		migrated.Manifest = manifest
+
+		// Hooks are copied so that the original revision is not changed.
+		migrated.Hooks = nil
+		for _, hook := range rel.Hooks {
+			h := *hook
+			h.Manifest, err = c.pinManifestNamespace(hook.Manifest, rel.Namespace)
+			if err != nil {
+				return nil, microerror.Mask(err)
+			}
+			migrated.Hooks = append(migrated.Hooks, &h)
+		}
+	}
+
+	return &migrated, nil
+}
+
+// pinManifestNamespace sets the given namespace on all namespaced objects of
+// the manifest which do not specify one.
+func (c *Client) pinManifestNamespace(manifest, namespace string) (string, error) {
+	return rewriteManifest(manifest, func(o *unstructured.Unstructured) error {
+		if o.GetNamespace() != "" {
+			return nil
+		}
+
+		gvk := o.GroupVersionKind()
+
+		mapping, err := c.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			o.SetNamespace(namespace)
+		}
+
+		return nil
+	})
+}
+
+// rewriteManifest applies the given function to every object of the manifest
+// and returns the resulting manifest. Only documents whose objects changed
+// are rewritten. The comments preceding them, e.g. the "# Source:" comments
+// naming the templates the objects were rendered from, are kept.
+func rewriteManifest(manifest string, rewrite func(o *unstructured.Unstructured) error) (string, error) {
+	separators := manifestSeparatorRegexp.FindAllStringIndex(manifest, -1)
+	separators = append(separators, []int{len(manifest), len(manifest)})
+
+	var b strings.Builder
+	var start int
+	for _, separator := range separators {
+		doc, err := rewriteDocument(manifest[start:separator[0]], rewrite)
+		if err != nil {
+			return "", microerror.Mask(err)
+		}
+
+		b.WriteString(doc)
+		b.WriteString(manifest[separator[0]:separator[1]])
+		start = separator[1]
+	}
+
+	return b.String(), nil
+}
+
+// rewriteDocument applies the given function to the objects of a single
+// document of a manifest and returns the resulting document.
+func rewriteDocument(doc string, rewrite func(o *unstructured.Unstructured) error) (string, error) {
+	objects, err := parseManifest(doc)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	var changed bool
+	var bodies []string
+	for _, o := range objects {
+		original := o.DeepCopy()
+
+		err = rewrite(o)
+		if err != nil {
+			return "", microerror.Mask(err)
+		}
+		changed = changed || !reflect.DeepEqual(original.Object, o.Object)
+
+		b, err := yaml.Marshal(o.Object)
+		if err != nil {
+			return "", microerror.Mask(err)
+		}
+
+		bodies = append(bodies, string(b))
+	}
+
+	if !changed {
+		return doc, nil
+	}
+
+	var comments strings.Builder
+	for _, line := range strings.SplitAfter(doc, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+		comments.WriteString(line)
+	}
+
+	return comments.String() + strings.Join(bodies, "---\n"), nil
+}
+
+// updateOwnership points the ownership annotations of the objects managed by
+// the given revision to the migration target.
+func (c *Client) updateOwnership(ctx context.Context, rel *release.Release, options MigrateOptions) error {
+	objects, err := parseManifest(rel.Manifest)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				helmReleaseNameAnnotation:      options.ReleaseName,
+				helmReleaseNamespaceAnnotation: options.Namespace,
+			},
+		},
+	})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	for _, o := range objects {
+		resource, err := c.objectResource(o, rel.Namespace)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		_, err = resource.Patch(ctx, o.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,467 @@
+package helmclient
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/google/go-cmp/cmp"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+const migrateTestManifest = `---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+---
+# Source: app/templates/clusterrole.yaml
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: viewer
+`
+
+const migrateTestPinnedManifest = `---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+---
+# Source: app/templates/clusterrole.yaml
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: viewer
+`
+
+func Test_rewriteManifest(t *testing.T) {
+	setLabel := func(o *unstructured.Unstructured) error {
+		if o.GetKind() == "Deployment" {
+			o.SetLabels(map[string]string{"app": "foo"})
+		}
+		return nil
+	}
+
+	testCases := []struct {
+		name             string
+		manifest         string
+		rewrite          func(o *unstructured.Unstructured) error
+		expectedManifest string
+		errorMatcher     func(error) bool
+	}{
+		{
+			name:     "case 0: changed document keeps its source comment",
+			manifest: migrateTestManifest,
+			rewrite:  setLabel,
+			expectedManifest: `---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  labels:
+    app: foo
+  name: app
+---
+# Source: app/templates/clusterrole.yaml
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: viewer
+`,
+		},
+		{
+			name: "case 1: unchanged documents are kept as they are",
+			manifest: `---
+# Source: app/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: config}
+data:
+  key: "value" # comment
+`,
+			rewrite: setLabel,
+			expectedManifest: `---
+# Source: app/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: config}
+data:
+  key: "value" # comment
+`,
+		},
+		{
+			name:             "case 2: empty manifest",
+			manifest:         "",
+			rewrite:          setLabel,
+			expectedManifest: "",
+		},
+		{
+			name:     "case 3: rewrite fails",
+			manifest: migrateTestManifest,
+			rewrite: func(o *unstructured.Unstructured) error {
+				return invalidConfigError
+			},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "case 4: invalid manifest",
+			manifest:     "---\nkind: [",
+			rewrite:      setLabel,
+			errorMatcher: IsInvalidManifest,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			manifest, err := rewriteManifest(tc.manifest, tc.rewrite)
+
+			switch {
+			case err == nil && tc.errorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if diff := cmp.Diff(tc.expectedManifest, manifest); diff != "" {
+				t.Fatalf("want matching manifest \n %s", diff)
+			}
+		})
+	}
+}
+
+func Test_Client_pinManifestNamespace(t *testing.T) {
+	testCases := []struct {
+		name             string
+		manifest         string
+		expectedManifest string
+		errorMatcher     func(error) bool
+	}{
+		{
+			name:             "case 0: namespaced object is pinned",
+			manifest:         migrateTestManifest,
+			expectedManifest: migrateTestPinnedManifest,
+		},
+		{
+			name: "case 1: explicit namespace is kept",
+			manifest: `---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: monitoring
+`,
+			expectedManifest: `---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: monitoring
+`,
+		},
+		{
+			name: "case 2: unknown kind",
+			manifest: `---
+apiVersion: example.com/v1
+kind: App
+metadata:
+  name: app
+`,
+			errorMatcher: meta.IsNoMatchError,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			c := &Client{
+				restMapper: newMigrateTestRESTMapper(),
+			}
+
+			manifest, err := c.pinManifestNamespace(tc.manifest, "default")
+
+			switch {
+			case err == nil && tc.errorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if diff := cmp.Diff(tc.expectedManifest, manifest); diff != "" {
+				t.Fatalf("want matching manifest \n %s", diff)
+			}
+		})
+	}
+}
+
+func Test_Client_migrateRevision(t *testing.T) {
+	hookManifest := `---
+# Source: app/templates/job.yaml
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+`
+	pinnedHookManifest := `---
+# Source: app/templates/job.yaml
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  namespace: default
+`
+
+	testCases := []struct {
+		name                 string
+		options              MigrateOptions
+		expectedName         string
+		expectedNamespace    string
+		expectedManifest     string
+		expectedHookManifest string
+	}{
+		{
+			name:                 "case 0: moved to another namespace",
+			options:              MigrateOptions{Namespace: "apps", ReleaseName: "foo"},
+			expectedName:         "foo",
+			expectedNamespace:    "apps",
+			expectedManifest:     migrateTestPinnedManifest,
+			expectedHookManifest: pinnedHookManifest,
+		},
+		{
+			name:                 "case 1: renamed within the namespace",
+			options:              MigrateOptions{Namespace: "default", ReleaseName: "bar"},
+			expectedName:         "bar",
+			expectedNamespace:    "default",
+			expectedManifest:     migrateTestManifest,
+			expectedHookManifest: hookManifest,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			c := &Client{
+				restMapper: newMigrateTestRESTMapper(),
+			}
+
+			rel := &release.Release{
+				Name:      "foo",
+				Namespace: "default",
+				Version:   1,
+				Manifest:  migrateTestManifest,
+				Hooks: []*release.Hook{
+					{Name: "migrate", Kind: "Job", Manifest: hookManifest},
+				},
+			}
+
+			migrated, err := c.migrateRevision(rel, tc.options)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			if migrated.Name != tc.expectedName || migrated.Namespace != tc.expectedNamespace {
+				t.Fatalf("expected release %#q in namespace %#q got %#q in namespace %#q", tc.expectedName, tc.expectedNamespace, migrated.Name, migrated.Namespace)
+			}
+			if diff := cmp.Diff(tc.expectedManifest, migrated.Manifest); diff != "" {
+				t.Fatalf("want matching manifest \n %s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedHookManifest, migrated.Hooks[0].Manifest); diff != "" {
+				t.Fatalf("want matching hook manifest \n %s", diff)
+			}
+
+			// The original revision must not be changed.
+			if rel.Name != "foo" || rel.Namespace != "default" || rel.Manifest != migrateTestManifest || rel.Hooks[0].Manifest != hookManifest {
+				t.Fatalf("expected original revision to be unchanged got %#v", rel)
+			}
+		})
+	}
+}
+
+func Test_Client_moveRelease(t *testing.T) {
+	deploymentResource := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+	testCases := []struct {
+		name                   string
+		failPatch              bool
+		failDelete             bool
+		expectedSource         []int
+		expectedTarget         []int
+		expectedOwnerNamespace string
+		errorMatcher           func(error) bool
+	}{
+		{
+			name:                   "case 0: release is moved",
+			expectedSource:         nil,
+			expectedTarget:         []int{1, 2},
+			expectedOwnerNamespace: "apps",
+		},
+		{
+			name:                   "case 1: updating the ownership fails",
+			failPatch:              true,
+			expectedSource:         []int{1, 2},
+			expectedTarget:         nil,
+			expectedOwnerNamespace: "default",
+			errorMatcher:           IsExecutionFailed,
+		},
+		{
+			name:                   "case 2: deleting the original revisions fails midway",
+			failDelete:             true,
+			expectedSource:         []int{1, 2},
+			expectedTarget:         nil,
+			expectedOwnerNamespace: "default",
+			errorMatcher:           IsExecutionFailed,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			deployment := &unstructured.Unstructured{}
+			deployment.SetAPIVersion("apps/v1")
+			deployment.SetKind("Deployment")
+			deployment.SetName("app")
+			deployment.SetNamespace("default")
+			deployment.SetAnnotations(map[string]string{
+				helmReleaseNameAnnotation:      "foo",
+				helmReleaseNamespaceAnnotation: "default",
+			})
+
+			dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{deploymentResource: "DeploymentList"}, deployment)
+			if tc.failPatch {
+				// Only the patch of the migration fails. Restoring the
+				// ownership succeeds.
+				var patched bool
+				dynamicClient.PrependReactor("patch", "deployments", func(action clienttesting.Action) (bool, runtime.Object, error) {
+					if patched {
+						return false, nil, nil
+					}
+					patched = true
+					return true, nil, executionFailedError
+				})
+			}
+
+			k8sClient := fake.NewSimpleClientset()
+			if tc.failDelete {
+				k8sClient.PrependReactor("delete", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+					if action.GetNamespace() == "default" && action.(clienttesting.DeleteAction).GetName() == "sh.helm.release.v1.foo.v2" {
+						return true, nil, executionFailedError
+					}
+					return false, nil, nil
+				})
+			}
+
+			c := &Client{
+				dynamicClient: dynamicClient,
+				logger:        microloggertest.New(),
+				restMapper:    newMigrateTestRESTMapper(),
+			}
+
+			source := storage.Init(driver.NewSecrets(k8sClient.CoreV1().Secrets("default")))
+			target := storage.Init(driver.NewSecrets(k8sClient.CoreV1().Secrets("apps")))
+
+			for _, rel := range []*release.Release{newMigrateTestRelease(1, release.StatusSuperseded), newMigrateTestRelease(2, release.StatusDeployed)} {
+				err := source.Create(rel)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := c.moveRelease(context.Background(), source, target, "default", "foo", MigrateOptions{Namespace: "apps", ReleaseName: "foo"})
+
+			switch {
+			case err == nil && tc.errorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if diff := cmp.Diff(tc.expectedSource, migrateTestVersions(t, source)); diff != "" {
+				t.Fatalf("want matching source revisions \n %s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedTarget, migrateTestVersions(t, target)); diff != "" {
+				t.Fatalf("want matching target revisions \n %s", diff)
+			}
+
+			current, err := dynamicClient.Resource(deploymentResource).Namespace("default").Get(context.Background(), "app", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if namespace := current.GetAnnotations()[helmReleaseNamespaceAnnotation]; namespace != tc.expectedOwnerNamespace {
+				t.Fatalf("expected owner namespace %#q got %#q", tc.expectedOwnerNamespace, namespace)
+			}
+		})
+	}
+}
+
+func newMigrateTestRelease(version int, status release.Status) *release.Release {
+	return &release.Release{
+		Name:      "foo",
+		Namespace: "default",
+		Version:   version,
+		Info:      &release.Info{Status: status},
+		Manifest:  "---\n# Source: app/templates/deployment.yaml\napiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\n",
+	}
+}
+
+func newMigrateTestRESTMapper() meta.RESTMapper {
+	restMapper := meta.NewDefaultRESTMapper(nil)
+	restMapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	restMapper.Add(schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}, meta.RESTScopeNamespace)
+	restMapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+
+	return restMapper
+}
+
+// migrateTestVersions returns the sorted revisions of release foo in the given
+// storage.
+func migrateTestVersions(t *testing.T, releases *storage.Storage) []int {
+	history, err := releases.History("foo")
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	var versions []int
+	for _, rel := range history {
+		versions = append(versions, rel.Version)
+	}
+	sort.Ints(versions)
+
+	return versions
+}
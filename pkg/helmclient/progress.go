@@ -0,0 +1,305 @@
+package helmclient
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"helm.sh/helm/v3/pkg/kube"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+const (
+	// progressPollInterval is the interval in which the readiness of
+	// resources is polled to report ProgressPhaseResourceReady updates while
+	// Helm waits for them.
+	progressPollInterval = 2 * time.Second
+)
+
+// Phases reported to a ProgressFunc.
+const (
+	// ProgressPhaseChartLoaded is reported once the chart was loaded.
+	ProgressPhaseChartLoaded = "ChartLoaded"
+	// ProgressPhaseCRDsApplied is reported once the CRDs of the crds/
+	// directory were applied when managing CRDs.
+	ProgressPhaseCRDsApplied = "CRDsApplied"
+	// ProgressPhaseRendered is reported once the chart templates were
+	// rendered.
+	ProgressPhaseRendered = "Rendered"
+	// ProgressPhasePreHooks is reported for every hook created before the
+	// resources of the release are applied.
+	ProgressPhasePreHooks = "PreHooks"
+	// ProgressPhaseResourcesApplied is reported once the resources of the
+	// release were created or updated.
+	ProgressPhaseResourcesApplied = "ResourcesApplied"
+	// ProgressPhaseWaiting is reported when waiting for resources of the
+	// release to become ready starts.
+	ProgressPhaseWaiting = "Waiting"
+	// ProgressPhaseResourceReady is reported for every resource which
+	// became ready while waiting.
+	ProgressPhaseResourceReady = "ResourceReady"
+	// ProgressPhasePostHooks is reported for every hook created after the
+	// resources of the release were applied.
+	ProgressPhasePostHooks = "PostHooks"
+)
+
+// ProgressFunc receives progress updates of a long-running operation. It is
+// never called concurrently and must not block as the operation does not
+// continue until it returns.
+type ProgressFunc func(progress Progress)
+
+// progressReporter passes progress updates of a single operation to a
+// ProgressFunc. A nil progressReporter discards all updates.
+type progressReporter struct {
+	f ProgressFunc
+
+	mutex   sync.Mutex
+	applied bool
+}
+
+func newProgressReporter(f ProgressFunc) *progressReporter {
+	if f == nil {
+		return nil
+	}
+
+	return &progressReporter{
+		f: f,
+	}
+}
+
+func (r *progressReporter) report(progress Progress) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.f(progress)
+}
+
+// created reports the creation of hooks or of the resources of the release.
+// Hooks created before the resources of the release are applied are pre
+// hooks, all others post hooks. CRDs of the crds/ directory are created
+// before any hook and are not reported.
+func (r *progressReporter) created(resources kube.ResourceList) {
+	if r == nil {
+		return
+	}
+
+	if !isHook(resources) {
+		if !isCRDs(resources) {
+			r.updated(resources)
+		}
+		return
+	}
+
+	r.mutex.Lock()
+	phase := ProgressPhasePreHooks
+	if r.applied {
+		phase = ProgressPhasePostHooks
+	}
+	r.mutex.Unlock()
+
+	for _, info := range resources {
+		object := infoReference(info)
+		r.report(Progress{Phase: phase, Object: &object})
+	}
+}
+
+// updated reports that the resources of the release were applied.
+func (r *progressReporter) updated(resources kube.ResourceList) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	r.applied = true
+	r.mutex.Unlock()
+
+	r.report(Progress{Phase: ProgressPhaseResourcesApplied, Resources: len(resources)})
+}
+
+// waiting reports that Helm started waiting for the given number of resources
+// and polls the given resources in the background to report every resource
+// becoming ready. Resources with a custom readiness checker are reported by
+// the checker instead. The returned function stops polling and must be called
+// once waiting finished.
+func (r *progressReporter) waiting(ctx context.Context, factory kube.Factory, count int, resources kube.ResourceList, checkJobs bool) func() {
+	if r == nil {
+		return func() {}
+	}
+
+	r.report(Progress{Phase: ProgressPhaseWaiting, Resources: count})
+
+	if len(resources) == 0 {
+		return func() {}
+	}
+
+	clientSet, err := factory.KubernetesClientSet()
+	if err != nil {
+		return func() {}
+	}
+	checker := kube.NewReadyChecker(clientSet, func(string, ...interface{}) {}, kube.PausedAsReady(true), kube.CheckJobs(checkJobs))
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		pending := append(kube.ResourceList{}, resources...)
+		for len(pending) > 0 {
+			var notReady kube.ResourceList
+			for _, info := range pending {
+				ready, err := checker.IsReady(ctx, info)
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil || !ready {
+					notReady = append(notReady, info)
+					continue
+				}
+
+				object := infoReference(info)
+				r.report(Progress{Phase: ProgressPhaseResourceReady, Object: &object})
+			}
+			pending = notReady
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(progressPollInterval):
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// progressKubeClient is a Helm kube client reporting the progress of the
+// operations Helm executes against the cluster.
+type progressKubeClient struct {
+	kubeClient
+
+	ctx      context.Context
+	factory  kube.Factory
+	progress *progressReporter
+
+	readinessCheckers map[schema.GroupVersionKind]ReadinessChecker
+
+	mutex     sync.Mutex
+	rendering bool
+}
+
+func newProgressKubeClient(ctx context.Context, client kubeClient, factory kube.Factory, progress *progressReporter, readinessCheckers map[schema.GroupVersionKind]ReadinessChecker) *progressKubeClient {
+	return &progressKubeClient{
+		kubeClient: client,
+
+		ctx:      ctx,
+		factory:  factory,
+		progress: progress,
+
+		readinessCheckers: readinessCheckers,
+	}
+}
+
+// startRender records the start of rendering a chart. Rendering is reported
+// once Helm builds the rendered resources for the first time.
+func (c *progressKubeClient) startRender() {
+	c.mutex.Lock()
+	c.rendering = true
+	c.mutex.Unlock()
+}
+
+func (c *progressKubeClient) Build(reader io.Reader, validate bool) (kube.ResourceList, error) {
+	c.mutex.Lock()
+	rendered := c.rendering
+	c.rendering = false
+	c.mutex.Unlock()
+
+	if rendered {
+		c.progress.report(Progress{Phase: ProgressPhaseRendered})
+	}
+
+	return c.kubeClient.Build(reader, validate)
+}
+
+func (c *progressKubeClient) Create(resources kube.ResourceList) (*kube.Result, error) {
+	result, err := c.kubeClient.Create(resources)
+	if err == nil {
+		c.progress.created(resources)
+	}
+
+	return result, err
+}
+
+func (c *progressKubeClient) Update(original, target kube.ResourceList, force bool) (*kube.Result, error) {
+	result, err := c.kubeClient.Update(original, target, force)
+	if err == nil {
+		c.progress.updated(target)
+	}
+
+	return result, err
+}
+
+func (c *progressKubeClient) UpdateThreeWayMerge(original, target kube.ResourceList, force bool) (*kube.Result, error) {
+	result, err := c.kubeClient.UpdateThreeWayMerge(original, target, force)
+	if err == nil {
+		c.progress.updated(target)
+	}
+
+	return result, err
+}
+
+func (c *progressKubeClient) Wait(resources kube.ResourceList, timeout time.Duration) error {
+	stop := c.waiting(resources, false)
+	defer stop()
+
+	return c.kubeClient.Wait(resources, timeout)
+}
+
+func (c *progressKubeClient) WaitWithJobs(resources kube.ResourceList, timeout time.Duration) error {
+	stop := c.waiting(resources, true)
+	defer stop()
+
+	return c.kubeClient.WaitWithJobs(resources, timeout)
+}
+
+// waiting reports waiting for the given resources. Resources with a custom
+// readiness checker are reported by the readinessKubeClient instead.
+func (c *progressKubeClient) waiting(resources kube.ResourceList, checkJobs bool) func() {
+	_, builtin := splitReadiness(c.readinessCheckers, resources)
+
+	return c.progress.waiting(c.ctx, c.factory, len(resources), builtin, checkJobs)
+}
+
+// isCRDs returns true if all given resources are CRDs.
+func isCRDs(resources kube.ResourceList) bool {
+	for _, info := range resources {
+		if info.Mapping == nil || info.Mapping.GroupVersionKind.Kind != "CustomResourceDefinition" {
+			return false
+		}
+	}
+
+	return len(resources) > 0
+}
+
+// infoReference returns a reference to the object of the given resource.
+func infoReference(info *resource.Info) ObjectReference {
+	object := ObjectReference{
+		Name:      info.Name,
+		Namespace: info.Namespace,
+	}
+	if info.Mapping != nil {
+		object.APIVersion = info.Mapping.GroupVersionKind.GroupVersion().String()
+		object.Kind = info.Mapping.GroupVersionKind.Kind
+	}
+
+	return object
+}
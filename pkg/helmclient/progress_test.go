@@ -0,0 +1,68 @@
+package helmclient
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+func Test_progressReporter(t *testing.T) {
+	var updates []Progress
+	progress := newProgressReporter(func(p Progress) {
+		updates = append(updates, p)
+	})
+
+	crd := newProgressInfo("apiextensions.k8s.io/v1", "CustomResourceDefinition", "apps.application.giantswarm.io", false)
+	preHook := newProgressInfo("batch/v1", "Job", "pre", true)
+	deployment := newProgressInfo("apps/v1", "Deployment", "app", false)
+	postHook := newProgressInfo("batch/v1", "Job", "post", true)
+
+	progress.created(kube.ResourceList{crd})
+	progress.created(kube.ResourceList{preHook})
+	progress.created(kube.ResourceList{deployment})
+	progress.created(kube.ResourceList{postHook})
+
+	expected := []Progress{
+		{Phase: ProgressPhasePreHooks, Object: &ObjectReference{APIVersion: "batch/v1", Kind: "Job", Name: "pre", Namespace: "default"}},
+		{Phase: ProgressPhaseResourcesApplied, Resources: 1},
+		{Phase: ProgressPhasePostHooks, Object: &ObjectReference{APIVersion: "batch/v1", Kind: "Job", Name: "post", Namespace: "default"}},
+	}
+	if !cmp.Equal(updates, expected) {
+		t.Fatalf("want matching updates \n %s", cmp.Diff(expected, updates))
+	}
+}
+
+func Test_progressReporter_nil(t *testing.T) {
+	progress := newProgressReporter(nil)
+
+	// A nil reporter must discard all updates.
+	progress.report(Progress{Phase: ProgressPhaseChartLoaded})
+	progress.created(kube.ResourceList{newProgressInfo("apps/v1", "Deployment", "app", false)})
+	progress.waiting(context.Background(), nil, 0, nil, false)()
+}
+
+func newProgressInfo(apiVersion, kind, name string, hook bool) *resource.Info {
+	o := &unstructured.Unstructured{}
+	o.SetAPIVersion(apiVersion)
+	o.SetKind(kind)
+	o.SetName(name)
+	if hook {
+		o.SetAnnotations(map[string]string{release.HookAnnotation: "pre-install"})
+	}
+
+	gvk := schema.FromAPIVersionAndKind(apiVersion, kind)
+
+	return &resource.Info{
+		Mapping:   &meta.RESTMapping{GroupVersionKind: gvk},
+		Name:      name,
+		Namespace: "default",
+		Object:    o,
+	}
+}
@@ -0,0 +1,243 @@
+package helmclient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PruneReleases deletes release storage objects which are no longer needed.
+// Depending on the options these are all revisions of releases uninstalled
+// with KeepHistory or failed on their first install before a cutoff, revisions
+// exceeding a per-release history limit and all revisions of releases none of
+// whose managed objects exist anymore. Releases with a pending operation are
+// never pruned. With options.DryRun nothing is deleted and the result reports
+// what would be pruned.
+func (c *Client) PruneReleases(ctx context.Context, namespace string, options PruneOptions) (*PruneResult, error) {
+	eventName := "prune_releases"
+
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeReleaseNamespace, namespace),
+	))
+	defer span.End()
+
+	m := c.metrics.observe(eventName, namespace)
+	defer m.stop()
+
+	result, err := c.pruneReleases(ctx, namespace, options)
+	err = translateHelmError(err, namespace, "")
+	if err != nil {
+		m.fail()
+		recordSpanError(span, err)
+		return nil, microerror.Mask(err)
+	}
+
+	return result, nil
+}
+
+func (c *Client) pruneReleases(ctx context.Context, namespace string, options PruneOptions) (*PruneResult, error) {
+	if options.MaxHistory < 0 || options.OlderThan < 0 {
+		return nil, microerror.Maskf(invalidConfigError, "max history and older than must not be negative")
+	}
+
+	if options.AllNamespaces {
+		namespace = metav1.NamespaceAll
+	} else if namespace == "" {
+		return nil, microerror.Maskf(invalidConfigError, "namespace must not be empty")
+	}
+
+	all, err := storage.Init(driver.NewSecrets(c.k8sClient.CoreV1().Secrets(namespace))).ListReleases()
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	// Group the revisions by release.
+	histories := map[string][]*release.Release{}
+	var keys []string
+	for _, rel := range all {
+		key := fmt.Sprintf("%s/%s", rel.Namespace, rel.Name)
+		if _, ok := histories[key]; !ok {
+			keys = append(keys, key)
+		}
+		histories[key] = append(histories[key], rel)
+	}
+	sort.Strings(keys)
+
+	result := &PruneResult{}
+	for _, key := range keys {
+		history := histories[key]
+		sort.Slice(history, func(i, j int) bool {
+			return history[i].Version < history[j].Version
+		})
+
+		pruned, err := c.pruneRelease(ctx, history, options)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		result.Pruned = append(result.Pruned, pruned...)
+	}
+
+	return result, nil
+}
+
+// pruneRelease prunes the given history of a single release sorted by
+// revision.
+func (c *Client) pruneRelease(ctx context.Context, history []*release.Release, options PruneOptions) ([]PrunedRevision, error) {
+	latest := history[len(history)-1]
+	if latest.Info == nil || latest.Info.Status.IsPending() {
+		return nil, nil
+	}
+
+	reason, err := c.pruneReason(ctx, history, options)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var prune []*release.Release
+	if reason != "" {
+		prune = history
+	} else if options.MaxHistory > 0 && len(history) > options.MaxHistory {
+		reason = PruneReasonHistory
+
+		// Like Helm, always keep the last deployed revision so that the
+		// release can still be rolled back to it.
+		lastDeployed := lastDeployedBefore(history, latest.Version+1)
+		for _, rel := range history[:len(history)-options.MaxHistory] {
+			if lastDeployed != nil && rel.Version == lastDeployed.Version {
+				continue
+			}
+			prune = append(prune, rel)
+		}
+	}
+
+	if len(prune) == 0 {
+		return nil, nil
+	}
+
+	var pruned []PrunedRevision
+	for _, rel := range prune {
+		pruned = append(pruned, PrunedRevision{
+			Namespace:   rel.Namespace,
+			Reason:      reason,
+			ReleaseName: rel.Name,
+			Revision:    rel.Version,
+		})
+	}
+
+	if options.DryRun {
+		return pruned, nil
+	}
+
+	ctx, unlock, err := c.lockRelease(ctx, latest.Namespace, latest.Name)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	defer unlock()
+
+	store := storage.Init(driver.NewSecrets(c.k8sClient.CoreV1().Secrets(latest.Namespace)))
+
+	// The release may have changed since it was listed.
+	current, err := store.Last(latest.Name)
+	if IsReleaseNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	if current.Version != latest.Version {
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("skipping pruning of release %#q in namespace %#q as it changed", latest.Name, latest.Namespace))
+		return nil, nil
+	}
+
+	for _, rel := range prune {
+		_, err = store.Delete(rel.Name, rel.Version)
+		if err != nil && !IsReleaseNotFound(err) {
+			return nil, microerror.Mask(err)
+		}
+	}
+
+	return pruned, nil
+}
+
+// pruneReason returns the reason for pruning all revisions of the release or
+// an empty string if the release must be kept.
+func (c *Client) pruneReason(ctx context.Context, history []*release.Release, options PruneOptions) (string, error) {
+	latest := history[len(history)-1]
+
+	if options.OlderThan > 0 {
+		switch {
+		case latest.Info.Status == release.StatusUninstalled && time.Since(latest.Info.Deleted.Time) > options.OlderThan:
+			return PruneReasonUninstalled, nil
+		case neverDeployed(history) && time.Since(latest.Info.LastDeployed.Time) > options.OlderThan:
+			return PruneReasonFailedInstall, nil
+		}
+	}
+
+	if options.Orphaned && latest.Info.Status != release.StatusUninstalled {
+		orphaned, err := c.isOrphaned(ctx, latest)
+		if err != nil {
+			return "", microerror.Mask(err)
+		}
+		if orphaned {
+			return PruneReasonOrphaned, nil
+		}
+	}
+
+	return "", nil
+}
+
+// neverDeployed returns true if every revision of the release failed.
+func neverDeployed(history []*release.Release) bool {
+	for _, rel := range history {
+		if rel.Info == nil || rel.Info.Status != release.StatusFailed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isOrphaned returns true if none of the objects of the given revision exist
+// anymore. Revisions without objects are never orphaned.
+func (c *Client) isOrphaned(ctx context.Context, rel *release.Release) (bool, error) {
+	objects, err := parseManifest(rel.Manifest)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+	if len(objects) == 0 {
+		return false, nil
+	}
+
+	for _, o := range objects {
+		resource, err := c.objectResource(o, rel.Namespace)
+		if meta.IsNoMatchError(microerror.Cause(err)) {
+			// The kind is not served anymore, e.g. because its CRD was
+			// deleted, so the object cannot exist.
+			continue
+		} else if err != nil {
+			return false, microerror.Mask(err)
+		}
+
+		_, err = resource.Get(ctx, o.GetName(), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return false, microerror.Mask(err)
+		}
+
+		return false, nil
+	}
+
+	return true, nil
+}
@@ -0,0 +1,265 @@
+package helmclient
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/trace/noop"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	helmtime "helm.sh/helm/v3/pkg/time"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_neverDeployed(t *testing.T) {
+	testCases := []struct {
+		name                  string
+		history               []*release.Release
+		expectedNeverDeployed bool
+	}{
+		{
+			name: "case 0: all revisions failed",
+			history: []*release.Release{
+				newPruneTestRelease(1, release.StatusFailed, time.Time{}),
+				newPruneTestRelease(2, release.StatusFailed, time.Time{}),
+			},
+			expectedNeverDeployed: true,
+		},
+		{
+			name: "case 1: earlier revision deployed",
+			history: []*release.Release{
+				newPruneTestRelease(1, release.StatusSuperseded, time.Time{}),
+				newPruneTestRelease(2, release.StatusFailed, time.Time{}),
+			},
+			expectedNeverDeployed: false,
+		},
+		{
+			name: "case 2: revision without info",
+			history: []*release.Release{
+				{Name: "foo", Namespace: "default", Version: 1},
+			},
+			expectedNeverDeployed: false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			never := neverDeployed(tc.history)
+			if never != tc.expectedNeverDeployed {
+				t.Fatalf("expected never deployed %t got %t", tc.expectedNeverDeployed, never)
+			}
+		})
+	}
+}
+
+func Test_lastDeployedBefore(t *testing.T) {
+	testCases := []struct {
+		name            string
+		history         []*release.Release
+		version         int
+		expectedVersion int
+	}{
+		{
+			name: "case 0: latest deployed revision before the given one",
+			history: []*release.Release{
+				newPruneTestRelease(1, release.StatusSuperseded, time.Time{}),
+				newPruneTestRelease(2, release.StatusSuperseded, time.Time{}),
+				newPruneTestRelease(3, release.StatusFailed, time.Time{}),
+				newPruneTestRelease(4, release.StatusPendingUpgrade, time.Time{}),
+			},
+			version:         4,
+			expectedVersion: 2,
+		},
+		{
+			name: "case 1: given revision is excluded",
+			history: []*release.Release{
+				newPruneTestRelease(1, release.StatusSuperseded, time.Time{}),
+				newPruneTestRelease(2, release.StatusDeployed, time.Time{}),
+			},
+			version:         2,
+			expectedVersion: 1,
+		},
+		{
+			name: "case 2: no deployed revision",
+			history: []*release.Release{
+				newPruneTestRelease(1, release.StatusFailed, time.Time{}),
+				newPruneTestRelease(2, release.StatusUninstalled, time.Time{}),
+			},
+			version:         3,
+			expectedVersion: 0,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			var version int
+			if last := lastDeployedBefore(tc.history, tc.version); last != nil {
+				version = last.Version
+			}
+			if version != tc.expectedVersion {
+				t.Fatalf("expected revision %d got %d", tc.expectedVersion, version)
+			}
+		})
+	}
+}
+
+func Test_Client_pruneRelease(t *testing.T) {
+	old := time.Now().Add(-2 * time.Hour)
+	recent := time.Now().Add(-time.Minute)
+
+	testCases := []struct {
+		name              string
+		history           []*release.Release
+		options           PruneOptions
+		expectedPruned    []PrunedRevision
+		expectedRemaining []int
+	}{
+		{
+			name: "case 0: uninstalled before the cutoff",
+			history: []*release.Release{
+				newPruneTestRelease(1, release.StatusSuperseded, old),
+				newPruneTestRelease(2, release.StatusUninstalled, old),
+			},
+			options: PruneOptions{OlderThan: time.Hour},
+			expectedPruned: []PrunedRevision{
+				{Namespace: "default", Reason: PruneReasonUninstalled, ReleaseName: "foo", Revision: 1},
+				{Namespace: "default", Reason: PruneReasonUninstalled, ReleaseName: "foo", Revision: 2},
+			},
+			expectedRemaining: nil,
+		},
+		{
+			name: "case 1: uninstalled after the cutoff",
+			history: []*release.Release{
+				newPruneTestRelease(1, release.StatusSuperseded, old),
+				newPruneTestRelease(2, release.StatusUninstalled, recent),
+			},
+			options:           PruneOptions{OlderThan: time.Hour},
+			expectedPruned:    nil,
+			expectedRemaining: []int{1, 2},
+		},
+		{
+			name: "case 2: failed install before the cutoff",
+			history: []*release.Release{
+				newPruneTestRelease(1, release.StatusFailed, old),
+			},
+			options: PruneOptions{OlderThan: time.Hour},
+			expectedPruned: []PrunedRevision{
+				{Namespace: "default", Reason: PruneReasonFailedInstall, ReleaseName: "foo", Revision: 1},
+			},
+			expectedRemaining: nil,
+		},
+		{
+			name: "case 3: history trimmed keeping the last deployed revision",
+			history: []*release.Release{
+				newPruneTestRelease(1, release.StatusSuperseded, old),
+				newPruneTestRelease(2, release.StatusDeployed, old),
+				newPruneTestRelease(3, release.StatusFailed, old),
+				newPruneTestRelease(4, release.StatusFailed, old),
+			},
+			options: PruneOptions{MaxHistory: 2},
+			expectedPruned: []PrunedRevision{
+				{Namespace: "default", Reason: PruneReasonHistory, ReleaseName: "foo", Revision: 1},
+			},
+			expectedRemaining: []int{2, 3, 4},
+		},
+		{
+			name: "case 4: dry run reports without deleting",
+			history: []*release.Release{
+				newPruneTestRelease(1, release.StatusSuperseded, old),
+				newPruneTestRelease(2, release.StatusUninstalled, old),
+			},
+			options: PruneOptions{DryRun: true, OlderThan: time.Hour},
+			expectedPruned: []PrunedRevision{
+				{Namespace: "default", Reason: PruneReasonUninstalled, ReleaseName: "foo", Revision: 1},
+				{Namespace: "default", Reason: PruneReasonUninstalled, ReleaseName: "foo", Revision: 2},
+			},
+			expectedRemaining: []int{1, 2},
+		},
+		{
+			name: "case 5: pending release is kept",
+			history: []*release.Release{
+				newPruneTestRelease(1, release.StatusFailed, old),
+				newPruneTestRelease(2, release.StatusPendingInstall, old),
+			},
+			options:           PruneOptions{MaxHistory: 1, OlderThan: time.Hour},
+			expectedPruned:    nil,
+			expectedRemaining: []int{1, 2},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			k8sClient := fake.NewSimpleClientset()
+
+			c := &Client{
+				k8sClient:     k8sClient,
+				logger:        microloggertest.New(),
+				releaseLocker: newReleaseLocker(),
+				tracer:        noop.NewTracerProvider().Tracer("test"),
+			}
+
+			store := storage.Init(driver.NewSecrets(k8sClient.CoreV1().Secrets("default")))
+			for _, rel := range tc.history {
+				err := store.Create(rel)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			pruned, err := c.pruneRelease(context.Background(), tc.history, tc.options)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			if diff := cmp.Diff(tc.expectedPruned, pruned); diff != "" {
+				t.Fatalf("want matching pruned revisions \n %s", diff)
+			}
+
+			remaining, err := store.History("foo")
+			if IsReleaseNotFound(err) {
+				remaining = nil
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			var versions []int
+			for _, rel := range remaining {
+				versions = append(versions, rel.Version)
+			}
+			sort.Ints(versions)
+			if diff := cmp.Diff(tc.expectedRemaining, versions); diff != "" {
+				t.Fatalf("want matching remaining revisions \n %s", diff)
+			}
+		})
+	}
+}
+
+// newPruneTestRelease returns a revision last deployed at the given time.
+// Uninstalled revisions are deleted at that time.
+func newPruneTestRelease(version int, status release.Status, at time.Time) *release.Release {
+	rel := &release.Release{
+		Name:      "foo",
+		Namespace: "default",
+		Version:   version,
+		Info: &release.Info{
+			LastDeployed: helmtime.Time{Time: at},
+			Status:       status,
+		},
+	}
+	if status == release.StatusUninstalled {
+		rel.Info.Deleted = helmtime.Time{Time: at}
+	}
+
+	return rel
+}
@@ -12,8 +12,9 @@ import (
 	"github.com/giantswarm/backoff"
 	"github.com/giantswarm/microerror"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/afero"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	helmregistry "helm.sh/helm/v3/pkg/registry"
 	"oras.land/oras-go/pkg/content"
 	"oras.land/oras-go/pkg/oras"
@@ -25,12 +26,19 @@ import (
 func (c *Client) PullChartTarball(ctx context.Context, tarballURL string) (string, error) {
 	eventName := "pull_chart_tarball"
 
-	t := prometheus.NewTimer(histogram.WithLabelValues(eventName))
-	defer t.ObserveDuration()
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeChartURL, tarballURL),
+	))
+	defer span.End()
+
+	m := c.metrics.observe(eventName, "")
+	defer m.stop()
 
 	chartTarballPath, err := c.pullChartTarball(ctx, tarballURL)
+	err = translateHelmError(err, "", "")
 	if err != nil {
-		errorGauge.WithLabelValues(eventName).Inc()
+		m.fail()
+		recordSpanError(span, err)
 		return "", microerror.Mask(err)
 	}
 
@@ -44,14 +52,17 @@ func (c *Client) pullChartTarball(ctx context.Context, tarballURL string) (strin
 	}
 
 	var chartTarballPath string
+	var source string
 
 	if u.Scheme == helmregistry.OCIScheme {
+		source = pullSourceOCI
+
 		chartTarballPath, err = c.doFileOCI(ctx, tarballURL)
-		if err != nil {
-			return "", microerror.Mask(err)
-		}
 	} else {
-		req, err := c.newRequest("GET", tarballURL)
+		source = pullSourceHTTP
+
+		var req *http.Request
+		req, err = c.newRequest("GET", tarballURL)
 		if err != nil {
 			return "", microerror.Mask(err)
 		}
@@ -60,18 +71,28 @@ func (c *Client) pullChartTarball(ctx context.Context, tarballURL string) (strin
 		req.Host = u.Host
 
 		chartTarballPath, err = c.doFileHTTP(ctx, req)
-		if err != nil {
-			return "", microerror.Mask(err)
-		}
 	}
 
+	if err != nil {
+		c.metrics.observePull(source, 0, err)
+		return "", microerror.Mask(err)
+	}
+
+	info, err := c.fs.Stat(chartTarballPath)
+	if err != nil {
+		c.metrics.observePull(source, 0, err)
+		return "", microerror.Mask(err)
+	}
+
+	c.metrics.observePull(source, info.Size(), nil)
+
 	return chartTarballPath, nil
 }
 
 func (c *Client) doFileOCI(ctx context.Context, url string) (string, error) {
 	var tmpFileName string
 
-	o := func() error {
+	o := func(ctx context.Context) error {
 		// We utilize 'oci://' scheme to recognize OCI registries, but
 		// registry.ParseReference has a strict regex. Let's get rid of
 		// protocol prefix.
@@ -170,7 +191,7 @@ func (c *Client) doFileOCI(ctx context.Context, url string) (string, error) {
 	b := backoff.NewMaxRetries(3, 5*time.Second)
 	n := backoff.NewNotifier(c.logger, ctx)
 
-	err := backoff.RetryNotify(o, b, n)
+	err := backoff.RetryNotify(c.tracedRetry(ctx, spanPullAttempt, o), b, n)
 	if err != nil {
 		return "", microerror.Mask(err)
 	}
@@ -181,10 +202,8 @@ func (c *Client) doFileOCI(ctx context.Context, url string) (string, error) {
 func (c *Client) doFileHTTP(ctx context.Context, req *http.Request) (string, error) {
 	var tmpFileName string
 
-	req = req.WithContext(ctx)
-
-	o := func() error {
-		resp, err := c.httpClient.Do(req)
+	o := func(ctx context.Context) error {
+		resp, err := c.httpClient.Do(req.WithContext(ctx))
 		if isNoSuchHostError(err) {
 			return backoff.Permanent(microerror.Maskf(pullChartFailedError, "no such host %#q", req.Host))
 		} else if IsPullChartTimeout(err) {
@@ -233,7 +252,7 @@ func (c *Client) doFileHTTP(ctx context.Context, req *http.Request) (string, err
 	b := backoff.NewMaxRetries(3, 5*time.Second)
 	n := backoff.NewNotifier(c.logger, ctx)
 
-	err := backoff.RetryNotify(o, b, n)
+	err := backoff.RetryNotify(c.tracedRetry(ctx, spanPullAttempt, o), b, n)
 	if err != nil {
 		return "", microerror.Mask(err)
 	}
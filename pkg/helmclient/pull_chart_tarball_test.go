@@ -0,0 +1,117 @@
+package helmclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/afero"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// statFailingFs is an in-memory filesystem whose Stat always fails.
+type statFailingFs struct {
+	afero.Fs
+}
+
+func (fs statFailingFs) Stat(name string) (os.FileInfo, error) {
+	return nil, errors.New("stat failed")
+}
+
+func Test_Client_pullChartTarball_metrics(t *testing.T) {
+	testCases := []struct {
+		name         string
+		statusCode   int
+		failStat     bool
+		expected     string
+		errorMatcher func(error) bool
+	}{
+		{
+			name:       "case 0: successful pull is counted",
+			statusCode: http.StatusOK,
+			expected: `
+# HELP helmclient_library_pull_total Number of chart tarball pulls by source and result.
+# TYPE helmclient_library_pull_total counter
+helmclient_library_pull_total{result="success",source="http"} 1
+`,
+		},
+		{
+			name:       "case 1: failed download is counted",
+			statusCode: http.StatusNotFound,
+			expected: `
+# HELP helmclient_library_pull_total Number of chart tarball pulls by source and result.
+# TYPE helmclient_library_pull_total counter
+helmclient_library_pull_total{result="error",source="http"} 1
+`,
+			errorMatcher: IsPullChartNotFound,
+		},
+		{
+			name:       "case 2: unreadable pulled tarball is counted as failed",
+			statusCode: http.StatusOK,
+			failStat:   true,
+			expected: `
+# HELP helmclient_library_pull_total Number of chart tarball pulls by source and result.
+# TYPE helmclient_library_pull_total counter
+helmclient_library_pull_total{result="error",source="http"} 1
+`,
+			errorMatcher: func(err error) bool { return err != nil },
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.statusCode)
+				_, _ = w.Write([]byte("chart"))
+			}))
+			defer server.Close()
+
+			registry := prometheus.NewRegistry()
+			m, err := newMetrics(metricsConfig{Registerer: registry})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var fs afero.Fs = afero.NewMemMapFs()
+			if tc.failStat {
+				fs = statFailingFs{Fs: fs}
+			}
+
+			c := &Client{
+				fs:         fs,
+				httpClient: server.Client(),
+				logger:     microloggertest.New(),
+				metrics:    m,
+				tracer:     noop.NewTracerProvider().Tracer("test"),
+			}
+
+			_, err = c.pullChartTarball(context.Background(), server.URL+"/chart.tgz")
+
+			switch {
+			case err == nil && tc.errorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			err = testutil.GatherAndCompare(registry, strings.NewReader(tc.expected), "helmclient_library_pull_total")
+			if err != nil {
+				t.Fatalf("expected nil error got %s", err)
+			}
+		})
+	}
+}
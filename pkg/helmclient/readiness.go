@@ -0,0 +1,221 @@
+package helmclient
+
+import (
+	"context"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"helm.sh/helm/v3/pkg/kube"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// readinessPollInterval is the interval in which objects with a custom
+	// readiness checker are polled while waiting for them to become ready.
+	readinessPollInterval = 2 * time.Second
+)
+
+// ReadinessChecker determines whether an object deployed by a Helm Release is
+// ready. Checkers are registered per GroupVersionKind using
+// Config.ReadinessCheckers and are consulted after Helm's built-in readiness
+// checks whenever Helm waits for the resources of a release, e.g. during
+// installs, upgrades and rollbacks.
+type ReadinessChecker interface {
+	// IsReady returns true when the given object, as currently stored in the
+	// cluster, is ready.
+	IsReady(ctx context.Context, object *unstructured.Unstructured) (bool, error)
+}
+
+// ReadinessCheckerFunc allows using ordinary functions as ReadinessChecker.
+type ReadinessCheckerFunc func(ctx context.Context, object *unstructured.Unstructured) (bool, error)
+
+// IsReady calls f(ctx, object).
+func (f ReadinessCheckerFunc) IsReady(ctx context.Context, object *unstructured.Unstructured) (bool, error) {
+	return f(ctx, object)
+}
+
+// NewConditionReadinessChecker returns a ReadinessChecker considering objects
+// ready once the status condition of the given type is True. When the
+// condition carries an observedGeneration it must match the generation of the
+// object so that conditions of a previous generation are not mistaken for
+// readiness. This matches the conventions used by most controllers, e.g. the
+// Ready condition of cert-manager Certificates.
+func NewConditionReadinessChecker(conditionType string) ReadinessChecker {
+	return ReadinessCheckerFunc(func(ctx context.Context, object *unstructured.Unstructured) (bool, error) {
+		conditions, _, err := unstructured.NestedSlice(object.Object, "status", "conditions")
+		if err != nil {
+			return false, microerror.Mask(err)
+		}
+
+		for _, c := range conditions {
+			condition, ok := c.(map[string]interface{})
+			if !ok || condition["type"] != conditionType {
+				continue
+			}
+
+			observedGeneration, ok, _ := unstructured.NestedInt64(condition, "observedGeneration")
+			if ok && observedGeneration != object.GetGeneration() {
+				return false, nil
+			}
+
+			return condition["status"] == string(metav1.ConditionTrue), nil
+		}
+
+		return false, nil
+	})
+}
+
+// readinessKubeClient is a Helm kube client waiting for the resources with a
+// custom readiness checker once Helm's built-in readiness checks passed.
+type readinessKubeClient struct {
+	kubeClient
+
+	ctx      context.Context
+	log      func(string, ...interface{})
+	progress *progressReporter
+	tracer   trace.Tracer
+
+	dynamicClient     dynamic.Interface
+	readinessCheckers map[schema.GroupVersionKind]ReadinessChecker
+}
+
+func newReadinessKubeClient(ctx context.Context, tracer trace.Tracer, client kubeClient, log func(string, ...interface{}), progress *progressReporter, dynamicClient dynamic.Interface, readinessCheckers map[schema.GroupVersionKind]ReadinessChecker) *readinessKubeClient {
+	return &readinessKubeClient{
+		kubeClient: client,
+
+		ctx:      ctx,
+		log:      log,
+		progress: progress,
+		tracer:   tracer,
+
+		dynamicClient:     dynamicClient,
+		readinessCheckers: readinessCheckers,
+	}
+}
+
+// Wait waits for the resources using Helm's built-in readiness checks and
+// then for the resources with a custom readiness checker. Failing either
+// fails Helm's wait so that Helm marks the release as failed and does not run
+// post hooks.
+func (c *readinessKubeClient) Wait(resources kube.ResourceList, timeout time.Duration) error {
+	return c.wait(resources, timeout, c.kubeClient.Wait)
+}
+
+func (c *readinessKubeClient) WaitWithJobs(resources kube.ResourceList, timeout time.Duration) error {
+	return c.wait(resources, timeout, c.kubeClient.WaitWithJobs)
+}
+
+func (c *readinessKubeClient) wait(resources kube.ResourceList, timeout time.Duration, wait func(kube.ResourceList, time.Duration) error) error {
+	custom, _ := splitReadiness(c.readinessCheckers, resources)
+
+	deadline := time.Now().Add(timeout)
+
+	err := wait(resources, timeout)
+	if err != nil {
+		return err
+	}
+
+	return c.waitForReadiness(custom, deadline)
+}
+
+// splitReadiness splits the resources into those with a custom readiness
+// checker registered and all others.
+func splitReadiness(readinessCheckers map[schema.GroupVersionKind]ReadinessChecker, resources kube.ResourceList) (kube.ResourceList, kube.ResourceList) {
+	if len(readinessCheckers) == 0 {
+		return nil, resources
+	}
+
+	var custom, builtin kube.ResourceList
+	for _, info := range resources {
+		if info.Mapping != nil {
+			if _, ok := readinessCheckers[info.Mapping.GroupVersionKind]; ok {
+				custom = append(custom, info)
+				continue
+			}
+		}
+		builtin = append(builtin, info)
+	}
+
+	return custom, builtin
+}
+
+// waitForReadiness waits until all given resources are ready according to
+// their custom readiness checker. It runs within Helm's wait so that Helm
+// marks the release as failed and skips post hooks if a resource does not
+// become ready before the deadline or its checker fails.
+func (c *readinessKubeClient) waitForReadiness(resources kube.ResourceList, deadline time.Time) error {
+	if len(resources) == 0 {
+		return nil
+	}
+
+	ctx, span := c.tracer.Start(c.ctx, spanWaitForReady, trace.WithAttributes(attribute.Int(attributeResources, len(resources))))
+	defer span.End()
+
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	for _, info := range resources {
+		checker := c.readinessCheckers[info.Mapping.GroupVersionKind]
+
+		err := c.waitForObjectReadiness(ctx, checker, info)
+		if wait.Interrupted(err) && c.ctx.Err() != nil {
+			// The operation was cancelled, e.g. because the lease of the
+			// release was lost.
+			err = cancellationCause(c.ctx, err)
+			recordSpanError(span, err)
+			return microerror.Mask(err)
+		} else if wait.Interrupted(err) {
+			err = microerror.Maskf(notReadyError, "%s %#q did not become ready", info.Mapping.GroupVersionKind.Kind, info.Name)
+			recordSpanError(span, err)
+			return err
+		} else if err != nil {
+			recordSpanError(span, err)
+			return microerror.Mask(err)
+		}
+
+		object := infoReference(info)
+		c.progress.report(Progress{Phase: ProgressPhaseResourceReady, Object: &object})
+	}
+
+	return nil
+}
+
+func (c *readinessKubeClient) waitForObjectReadiness(ctx context.Context, checker ReadinessChecker, info *resource.Info) error {
+	var client dynamic.ResourceInterface = c.dynamicClient.Resource(info.Mapping.Resource)
+	if info.Mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		client = c.dynamicClient.Resource(info.Mapping.Resource).Namespace(info.Namespace)
+	}
+
+	kind := info.Mapping.GroupVersionKind.Kind
+	c.log("waiting for %s %q to become ready", kind, info.Name)
+
+	err := wait.PollUntilContextCancel(ctx, readinessPollInterval, true, func(ctx context.Context) (bool, error) {
+		current, err := client.Get(ctx, info.Name, metav1.GetOptions{})
+		if err != nil {
+			// The object may not be visible yet, e.g. while a CRD is being
+			// established. Keep polling until the deadline.
+			c.log("failed to get %s %q: %s", kind, info.Name, err)
+			return false, nil
+		}
+
+		ready, err := checker.IsReady(ctx, current)
+		if err != nil {
+			return false, microerror.Mask(err)
+		}
+
+		return ready, nil
+	})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
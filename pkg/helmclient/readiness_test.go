@@ -0,0 +1,206 @@
+package helmclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/trace/noop"
+	"helm.sh/helm/v3/pkg/kube"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func Test_NewConditionReadinessChecker(t *testing.T) {
+	testCases := []struct {
+		name          string
+		object        map[string]interface{}
+		expectedReady bool
+	}{
+		{
+			name: "case 0: no status",
+			object: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "foo"},
+			},
+			expectedReady: false,
+		},
+		{
+			name: "case 1: ready condition true",
+			object: map[string]interface{}{
+				"status": map[string]interface{}{
+					"conditions": []interface{}{
+						map[string]interface{}{"type": "Issuing", "status": "False"},
+						map[string]interface{}{"type": "Ready", "status": "True"},
+					},
+				},
+			},
+			expectedReady: true,
+		},
+		{
+			name: "case 2: ready condition false",
+			object: map[string]interface{}{
+				"status": map[string]interface{}{
+					"conditions": []interface{}{
+						map[string]interface{}{"type": "Ready", "status": "False"},
+					},
+				},
+			},
+			expectedReady: false,
+		},
+		{
+			name: "case 3: ready condition of previous generation",
+			object: map[string]interface{}{
+				"metadata": map[string]interface{}{"generation": int64(2)},
+				"status": map[string]interface{}{
+					"conditions": []interface{}{
+						map[string]interface{}{"type": "Ready", "status": "True", "observedGeneration": int64(1)},
+					},
+				},
+			},
+			expectedReady: false,
+		},
+		{
+			name: "case 4: ready condition of current generation",
+			object: map[string]interface{}{
+				"metadata": map[string]interface{}{"generation": int64(2)},
+				"status": map[string]interface{}{
+					"conditions": []interface{}{
+						map[string]interface{}{"type": "Ready", "status": "True", "observedGeneration": int64(2)},
+					},
+				},
+			},
+			expectedReady: true,
+		},
+	}
+
+	checker := NewConditionReadinessChecker("Ready")
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			ready, err := checker.IsReady(context.Background(), &unstructured.Unstructured{Object: tc.object})
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			if ready != tc.expectedReady {
+				t.Fatalf("ready == %t, want %t", ready, tc.expectedReady)
+			}
+		})
+	}
+}
+
+func Test_readinessKubeClient_Wait(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+	gvr := schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "certificates"}
+
+	testCases := []struct {
+		name             string
+		waitError        error
+		checker          ReadinessCheckerFunc
+		expectedErr      func(error) bool
+		expectedProgress []Progress
+	}{
+		{
+			name: "case 0: ready",
+			checker: func(ctx context.Context, object *unstructured.Unstructured) (bool, error) {
+				return true, nil
+			},
+			expectedProgress: []Progress{
+				{Phase: ProgressPhaseWaiting, Resources: 1},
+				{Phase: ProgressPhaseResourceReady, Object: &ObjectReference{APIVersion: "cert-manager.io/v1", Kind: "Certificate", Name: "foo", Namespace: "default"}},
+			},
+		},
+		{
+			name: "case 1: not ready before the deadline",
+			checker: func(ctx context.Context, object *unstructured.Unstructured) (bool, error) {
+				return false, nil
+			},
+			expectedErr: IsNotReady,
+			expectedProgress: []Progress{
+				{Phase: ProgressPhaseWaiting, Resources: 1},
+			},
+		},
+		{
+			name: "case 2: checker fails",
+			checker: func(ctx context.Context, object *unstructured.Unstructured) (bool, error) {
+				return false, microerror.Maskf(executionFailedError, "invalid status")
+			},
+			expectedErr: IsExecutionFailed,
+			expectedProgress: []Progress{
+				{Phase: ProgressPhaseWaiting, Resources: 1},
+			},
+		},
+		{
+			name:      "case 3: Helm's wait fails",
+			waitError: microerror.Maskf(executionFailedError, "timed out"),
+			checker: func(ctx context.Context, object *unstructured.Unstructured) (bool, error) {
+				return false, errors.New("checker must not be called")
+			},
+			expectedErr: IsExecutionFailed,
+			expectedProgress: []Progress{
+				{Phase: ProgressPhaseWaiting, Resources: 1},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			object := &unstructured.Unstructured{}
+			object.SetGroupVersionKind(gvk)
+			object.SetName("foo")
+			object.SetNamespace("default")
+
+			dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "CertificateList"}, object)
+
+			var progress []Progress
+			readinessCheckers := map[schema.GroupVersionKind]ReadinessChecker{gvk: tc.checker}
+			reporter := newProgressReporter(func(p Progress) { progress = append(progress, p) })
+
+			next := &kubefake.FailingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}, WaitError: tc.waitError}
+			readiness := newReadinessKubeClient(context.Background(), noop.NewTracerProvider().Tracer(""), next, func(string, ...interface{}) {}, reporter, dynamicClient, readinessCheckers)
+			c := newProgressKubeClient(context.Background(), readiness, nil, reporter, readinessCheckers)
+
+			resources := kube.ResourceList{
+				{
+					Name:      "foo",
+					Namespace: "default",
+					Mapping: &meta.RESTMapping{
+						GroupVersionKind: gvk,
+						Resource:         gvr,
+						Scope:            meta.RESTScopeNamespace,
+					},
+					Object: object,
+				},
+			}
+
+			err := c.Wait(resources, 50*time.Millisecond)
+			switch {
+			case err == nil && tc.expectedErr == nil:
+				// correct; carry on
+			case err != nil && tc.expectedErr == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.expectedErr != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.expectedErr(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if !cmp.Equal(progress, tc.expectedProgress) {
+				t.Fatalf("want matching progress \n %s", cmp.Diff(tc.expectedProgress, progress))
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package helmclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// RecoverStuckRelease recovers a Helm Release whose latest revision is stuck
+// in a pending status. This happens when the process running an install,
+// upgrade or rollback is killed before Helm could record the outcome, after
+// which every further operation fails with "another operation is in
+// progress". The pending revision is only touched once it has not been
+// deployed for longer than the configured staleness threshold.
+func (c *Client) RecoverStuckRelease(ctx context.Context, namespace, releaseName string, options RecoverOptions) error {
+	eventName := "recover_stuck_release"
+
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeReleaseNamespace, namespace),
+		attribute.String(attributeReleaseName, releaseName),
+	))
+	defer span.End()
+
+	m := c.metrics.observe(eventName, namespace)
+	defer m.stop()
+
+	ctx, debugLog := withDebugLog(ctx)
+
+	audit := c.newAudit(AuditOperationRecover, namespace, releaseName, nil)
+	err := c.recoverStuckRelease(ctx, audit, namespace, releaseName, options)
+	err = translateHelmError(err, namespace, releaseName)
+	audit.finish(ctx, err)
+	if err != nil {
+		m.fail()
+		recordSpanError(span, err)
+		return microerror.Mask(debugLog.attach(err))
+	}
+
+	return nil
+}
+
+func (c *Client) recoverStuckRelease(ctx context.Context, audit *auditTrail, namespace, releaseName string, options RecoverOptions) error {
+	if options.StaleAfter == 0 {
+		options.StaleAfter = time.Second * defaultRecoverStaleAfter
+	}
+	if options.Strategy == "" {
+		options.Strategy = RecoverStrategyMarkFailed
+	}
+	if options.Strategy != RecoverStrategyMarkFailed && options.Strategy != RecoverStrategyRollback {
+		return microerror.Maskf(invalidConfigError, "unknown recover strategy %#q", options.Strategy)
+	}
+
+	ctx, unlock, err := c.lockRelease(ctx, namespace, releaseName)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	defer unlock()
+
+	audit.start(ctx)
+
+	cfg, err := c.newActionConfig(ctx, namespace)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = c.recoverRelease(ctx, cfg, namespace, releaseName, options)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// recoverRelease recovers the stuck release using the given action
+// configuration. The release must be locked by the caller.
+func (c *Client) recoverRelease(ctx context.Context, cfg *action.Configuration, namespace, releaseName string, options RecoverOptions) error {
+	stuck, err := cfg.Releases.Last(releaseName)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = checkStuckRelease(stuck, options.StaleAfter)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	// Find the revision to roll back to before changing anything so that we
+	// do not leave a failed revision behind when there is nothing to roll
+	// back to.
+	var target *release.Release
+	if options.Strategy == RecoverStrategyRollback {
+		history, err := cfg.Releases.History(releaseName)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		target = lastDeployedBefore(history, stuck.Version)
+		if target == nil {
+			return microerror.Maskf(releaseNotDeployedError, "release %#q has no deployed revision before %d", releaseName, stuck.Version)
+		}
+	}
+
+	// Read the pending revision again right before writing it. If another
+	// process picked the release up in the meantime its status or deploy
+	// time will have changed and we must not interfere. The write is
+	// conditional on the resource version of the storage secret read here so
+	// that changes made after the check are not overwritten either.
+	store := storage.Init(driver.NewSecrets(newPreconditionSecrets(c.k8sClient.CoreV1().Secrets(namespace))))
+
+	current, err := store.Get(releaseName, stuck.Version)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if current.Info.Status != stuck.Info.Status || !current.Info.LastDeployed.Equal(stuck.Info.LastDeployed) {
+		return microerror.Maskf(releaseNotStaleError, "release %#q revision %d changed while recovering", releaseName, stuck.Version)
+	}
+
+	c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("marking release %#q revision %d in status %#q as failed", releaseName, current.Version, current.Info.Status))
+
+	current.SetStatus(release.StatusFailed, fmt.Sprintf("Recovered from stuck status %q", current.Info.Status))
+
+	err = store.Update(current)
+	if apierrors.IsConflict(err) {
+		return microerror.Maskf(releaseNotStaleError, "release %#q revision %d changed while recovering", releaseName, stuck.Version)
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	if target == nil {
+		return nil
+	}
+
+	c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("rolling back release %#q to revision %d", releaseName, target.Version))
+
+	rollback := action.NewRollback(cfg)
+
+	// Configure action with supported rollback options.
+	RollbackOptions{MaxHistory: c.maxHistory, Timeout: options.Timeout, Wait: options.Wait}.configure(rollback, namespace, target.Version)
+
+	err = rollback.Run(releaseName)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// checkStuckRelease ensures the given revision is pending and that it has not
+// been deployed for at least staleAfter.
+func checkStuckRelease(rel *release.Release, staleAfter time.Duration) error {
+	if rel.Info == nil || !rel.Info.Status.IsPending() {
+		return microerror.Maskf(releaseNotStuckError, "release %#q revision %d is not pending", rel.Name, rel.Version)
+	}
+
+	age := time.Since(rel.Info.LastDeployed.Time)
+	if age < staleAfter {
+		return microerror.Maskf(releaseNotStaleError, "release %#q revision %d is pending for %s which is less than %s", rel.Name, rel.Version, age.Round(time.Second), staleAfter)
+	}
+
+	return nil
+}
+
+// lastDeployedBefore returns the most recent revision before the given one
+// that was successfully deployed, or nil if there is none.
+func lastDeployedBefore(history []*release.Release, version int) *release.Release {
+	var last *release.Release
+
+	for _, rel := range history {
+		if rel.Version >= version || rel.Info == nil {
+			continue
+		}
+		if rel.Info.Status != release.StatusDeployed && rel.Info.Status != release.StatusSuperseded {
+			continue
+		}
+		if last == nil || rel.Version > last.Version {
+			last = rel
+		}
+	}
+
+	return last
+}
@@ -0,0 +1,218 @@
+package helmclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	helmtime "helm.sh/helm/v3/pkg/time"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func Test_Client_recoverRelease(t *testing.T) {
+	stale := time.Now().Add(-time.Hour)
+
+	testCases := []struct {
+		name             string
+		history          []*release.Release
+		strategy         string
+		changeOnRead     bool
+		expectedStatuses []release.Status
+		errorMatcher     func(error) bool
+	}{
+		{
+			name: "case 0: deployed release is not stuck",
+			history: []*release.Release{
+				newRecoverTestRelease(1, release.StatusDeployed, stale),
+			},
+			strategy:         RecoverStrategyMarkFailed,
+			expectedStatuses: []release.Status{release.StatusDeployed},
+			errorMatcher:     IsReleaseNotStuck,
+		},
+		{
+			name: "case 1: recently pending release is not stale",
+			history: []*release.Release{
+				newRecoverTestRelease(1, release.StatusDeployed, stale),
+				newRecoverTestRelease(2, release.StatusPendingUpgrade, time.Now()),
+			},
+			strategy:         RecoverStrategyMarkFailed,
+			expectedStatuses: []release.Status{release.StatusDeployed, release.StatusPendingUpgrade},
+			errorMatcher:     IsReleaseNotStale,
+		},
+		{
+			name: "case 2: stuck release is marked as failed",
+			history: []*release.Release{
+				newRecoverTestRelease(1, release.StatusDeployed, stale),
+				newRecoverTestRelease(2, release.StatusPendingUpgrade, stale),
+			},
+			strategy:         RecoverStrategyMarkFailed,
+			expectedStatuses: []release.Status{release.StatusDeployed, release.StatusFailed},
+		},
+		{
+			name: "case 3: stuck release is rolled back",
+			history: []*release.Release{
+				newRecoverTestRelease(1, release.StatusSuperseded, stale),
+				newRecoverTestRelease(2, release.StatusDeployed, stale),
+				newRecoverTestRelease(3, release.StatusPendingUpgrade, stale),
+			},
+			strategy:         RecoverStrategyRollback,
+			expectedStatuses: []release.Status{release.StatusSuperseded, release.StatusSuperseded, release.StatusFailed, release.StatusDeployed},
+		},
+		{
+			name: "case 4: stuck release without deployed revision is not changed",
+			history: []*release.Release{
+				newRecoverTestRelease(1, release.StatusPendingInstall, stale),
+			},
+			strategy:         RecoverStrategyRollback,
+			expectedStatuses: []release.Status{release.StatusPendingInstall},
+			errorMatcher:     IsReleaseNotDeployed,
+		},
+		{
+			name: "case 5: release changed after it was read is not overwritten",
+			history: []*release.Release{
+				newRecoverTestRelease(1, release.StatusDeployed, stale),
+				newRecoverTestRelease(2, release.StatusPendingUpgrade, stale),
+			},
+			strategy:         RecoverStrategyMarkFailed,
+			changeOnRead:     true,
+			expectedStatuses: []release.Status{release.StatusDeployed, release.StatusDeployed},
+			errorMatcher:     IsReleaseNotStale,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			k8sClient := fake.NewSimpleClientset()
+
+			c := &Client{
+				k8sClient: k8sClient,
+				logger:    microloggertest.New(),
+			}
+
+			cfg := &action.Configuration{
+				Releases:     storage.Init(driver.NewSecrets(k8sClient.CoreV1().Secrets("default"))),
+				KubeClient:   &kubefake.PrintingKubeClient{Out: io.Discard},
+				Capabilities: chartutil.DefaultCapabilities,
+				Log:          func(string, ...interface{}) {},
+			}
+
+			for _, rel := range tc.history {
+				err := cfg.Releases.Create(rel)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// The fake clientset does not implement optimistic concurrency.
+			// Reject updates of outdated secrets like the API server does.
+			secretsResource := corev1.SchemeGroupVersion.WithResource("secrets")
+			k8sClient.PrependReactor("update", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				secret := action.(clienttesting.UpdateAction).GetObject().(*corev1.Secret)
+				current, err := k8sClient.Tracker().Get(secretsResource, action.GetNamespace(), secret.Name)
+				if err != nil {
+					return false, nil, nil
+				}
+				if secret.ResourceVersion != "" && current.(*corev1.Secret).ResourceVersion != secret.ResourceVersion {
+					return true, nil, apierrors.NewConflict(secretsResource.GroupResource(), secret.Name, errors.New("object has been modified"))
+				}
+				return false, nil, nil
+			})
+
+			if tc.changeOnRead {
+				// Another process deploys the pending revision right after it
+				// was read for the last time.
+				var changed bool
+				k8sClient.PrependReactor("get", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+					name := action.(clienttesting.GetAction).GetName()
+					if changed || name != "sh.helm.release.v1.foo.v2" {
+						return false, nil, nil
+					}
+					changed = true
+
+					obj, err := k8sClient.Tracker().Get(secretsResource, "default", name)
+					if err != nil {
+						return true, nil, err
+					}
+					read := obj.(*corev1.Secret).DeepCopy()
+					read.ResourceVersion = "1"
+
+					deployed := newWatchTestSecret(t, newRecoverTestRelease(2, release.StatusDeployed, stale))
+					deployed.Name = name
+					deployed.ResourceVersion = "2"
+					err = k8sClient.Tracker().Update(secretsResource, deployed, "default")
+					if err != nil {
+						return true, nil, err
+					}
+
+					return true, read, nil
+				})
+			}
+
+			err := c.recoverRelease(context.Background(), cfg, "default", "foo", RecoverOptions{StaleAfter: time.Minute, Strategy: tc.strategy})
+
+			switch {
+			case err == nil && tc.errorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			history, err := cfg.Releases.History("foo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			statuses := make([]release.Status, len(history))
+			for _, rel := range history {
+				statuses[rel.Version-1] = rel.Info.Status
+			}
+			if len(statuses) != len(tc.expectedStatuses) {
+				t.Fatalf("expected statuses %v got %v", tc.expectedStatuses, statuses)
+			}
+			for i := range statuses {
+				if statuses[i] != tc.expectedStatuses[i] {
+					t.Fatalf("expected statuses %v got %v", tc.expectedStatuses, statuses)
+				}
+			}
+		})
+	}
+}
+
+func newRecoverTestRelease(version int, status release.Status, lastDeployed time.Time) *release.Release {
+	return &release.Release{
+		Name:      "foo",
+		Namespace: "default",
+		Version:   version,
+		Info: &release.Info{
+			LastDeployed: helmtime.Time{Time: lastDeployed},
+			Status:       status,
+		},
+		Chart: &chart.Chart{
+			Metadata: &chart.Metadata{
+				APIVersion: chart.APIVersionV2,
+				Name:       "foo",
+				Version:    "1.0.0",
+			},
+		},
+	}
+}
@@ -0,0 +1,105 @@
+package helmclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+
+	"github.com/giantswarm/microerror"
+	"helm.sh/helm/v3/pkg/release"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// Helm stores every revision of a release in a secret of type
+// helm.sh/release.v1 labeled with owner=helm. The release itself is stored as
+// base64 encoded and gzipped JSON. This needs to be kept in sync with
+// upstream.
+//
+// See: https://github.com/helm/helm/blob/main/pkg/storage/driver/secrets.go
+const (
+	releaseStorageDataKey       = "release"
+	releaseStorageOwnerSelector = "owner=helm"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b, 0x08}
+
+// decodeReleaseSecret decodes the release stored in the given Helm storage
+// secret.
+func decodeReleaseSecret(secret *corev1.Secret) (*release.Release, error) {
+	data, ok := secret.Data[releaseStorageDataKey]
+	if !ok {
+		return nil, microerror.Maskf(executionFailedError, "secret %#q has no %#q key", secret.Name, releaseStorageDataKey)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	// Releases stored before compression was introduced in Helm are plain
+	// JSON.
+	if len(b) > 3 && bytes.Equal(b[0:3], gzipMagic) {
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+		defer func() { _ = r.Close() }()
+
+		b, err = io.ReadAll(r)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+	}
+
+	var rel release.Release
+	err = json.Unmarshal(b, &rel)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return &rel, nil
+}
+
+// preconditionSecrets makes updates of Helm storage secrets conditional on
+// the resource version the secret had when it was last read through it. The
+// Helm secrets driver replaces storage secrets unconditionally which would
+// overwrite changes made by other processes in the meantime. It must not be
+// used concurrently.
+type preconditionSecrets struct {
+	typedcorev1.SecretInterface
+
+	resourceVersions map[string]string
+}
+
+func newPreconditionSecrets(secrets typedcorev1.SecretInterface) *preconditionSecrets {
+	return &preconditionSecrets{
+		SecretInterface: secrets,
+
+		resourceVersions: map[string]string{},
+	}
+}
+
+// Get gets the secret and records its resource version.
+func (s *preconditionSecrets) Get(ctx context.Context, name string, options metav1.GetOptions) (*corev1.Secret, error) {
+	secret, err := s.SecretInterface.Get(ctx, name, options)
+	if err != nil {
+		return nil, err
+	}
+
+	s.resourceVersions[name] = secret.ResourceVersion
+
+	return secret, nil
+}
+
+// Update updates the secret if it was not changed since it was read. Secrets
+// which were not read are updated unconditionally.
+func (s *preconditionSecrets) Update(ctx context.Context, secret *corev1.Secret, options metav1.UpdateOptions) (*corev1.Secret, error) {
+	secret.ResourceVersion = s.resourceVersions[secret.Name]
+
+	return s.SecretInterface.Update(ctx, secret, options)
+}
@@ -2,52 +2,199 @@ package helmclient
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/giantswarm/microerror"
-	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/release"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// maxTestLogBytes is the maximum number of bytes of logs fetched per test
+	// pod.
+	maxTestLogBytes = 64 * 1024
 )
 
 // RunReleaseTest runs the tests for a Helm Release. The releaseName is the
 // name of the Helm Release that is set when the Helm Chart is installed. This
-// is the same action as running the helm test command.
-func (c *Client) RunReleaseTest(ctx context.Context, namespace, releaseName string) error {
+// is the same action as running the helm test command. The returned result
+// lists every executed test with the logs of its pod. It is also returned
+// together with a testReleaseFailureError or testReleaseTimeoutError so that
+// failing tests can be inspected.
+func (c *Client) RunReleaseTest(ctx context.Context, namespace, releaseName string, options ReleaseTestOptions) (*ReleaseTestResult, error) {
 	eventName := "run_release_test"
 
-	t := prometheus.NewTimer(histogram.WithLabelValues(eventName))
-	defer t.ObserveDuration()
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeReleaseNamespace, namespace),
+		attribute.String(attributeReleaseName, releaseName),
+	))
+	defer span.End()
+
+	m := c.metrics.observe(eventName, namespace)
+	defer m.stop()
+
+	ctx, debugLog := withDebugLog(ctx)
 
-	err := c.runReleaseTest(ctx, namespace, releaseName)
+	result, err := c.runReleaseTest(ctx, namespace, releaseName, options)
+	err = translateHelmError(err, namespace, releaseName)
+	c.recordEvent(options.EventObject, testOperation, namespace, releaseName, err)
 	if err != nil {
-		errorGauge.WithLabelValues(eventName).Inc()
-		return microerror.Mask(err)
+		m.fail()
+		recordSpanError(span, err)
+		return result, microerror.Mask(debugLog.attach(err))
 	}
 
-	return nil
+	return result, nil
 }
 
-func (c *Client) runReleaseTest(ctx context.Context, namespace, releaseName string) error {
+func (c *Client) runReleaseTest(ctx context.Context, namespace, releaseName string, options ReleaseTestOptions) (*ReleaseTestResult, error) {
+	ctx, unlock, err := c.lockRelease(ctx, namespace, releaseName)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	defer unlock()
+
 	cfg, err := c.newActionConfig(ctx, namespace)
 	if err != nil {
-		return microerror.Mask(err)
+		return nil, microerror.Mask(err)
 	}
 
+	result, err := c.testRelease(ctx, cfg, namespace, releaseName, options)
+	if err != nil {
+		return result, microerror.Mask(err)
+	}
+
+	return result, nil
+}
+
+// testRelease runs the tests of the release using the given action
+// configuration. The result is also returned together with errors of failing
+// tests.
+func (c *Client) testRelease(ctx context.Context, cfg *action.Configuration, namespace, releaseName string, options ReleaseTestOptions) (*ReleaseTestResult, error) {
 	releaseTesting := action.NewReleaseTesting(cfg)
-	releaseTesting.Namespace = namespace
 
-	res, err := releaseTesting.Run(releaseName)
-	if err != nil {
-		for _, hook := range res.Hooks {
-			lastRun := hook.LastRun
+	// Configure action with supported release testing options.
+	options.configure(releaseTesting, namespace)
+
+	res, runErr := releaseTesting.Run(releaseName)
+	if res == nil {
+		return nil, microerror.Mask(runErr)
+	}
+
+	result := &ReleaseTestResult{}
+	failed := false
+
+	for _, hook := range res.Hooks {
+		if !isTestHook(hook) || !options.matches(hook.Name) {
+			continue
+		}
+
+		test := ReleaseTest{
+			CompletedAt: hook.LastRun.CompletedAt.Time,
+			Kind:        hook.Kind,
+			Name:        hook.Name,
+			Phase:       hook.LastRun.Phase.String(),
+			StartedAt:   hook.LastRun.StartedAt.Time,
+		}
+
+		// Tests not run because an earlier test failed have no phase.
+		if hook.Kind == "Pod" && hook.LastRun.Phase != "" && hook.LastRun.Phase != release.HookPhaseUnknown {
+			test.Logs = c.getTestPodLogs(ctx, namespace, hook.Name)
+		}
+		if hook.LastRun.Phase == release.HookPhaseFailed {
+			failed = true
+		}
+
+		result.Tests = append(result.Tests, test)
+	}
+
+	if runErr != nil {
+		if wait.Interrupted(runErr) {
+			return result, microerror.Maskf(testReleaseTimeoutError, "tests for %#q timed out: %s", releaseName, runErr)
+		}
+		if failed {
+			return result, microerror.Maskf(testReleaseFailureError, "tests for %#q failed", releaseName)
+		}
 
-			if lastRun.Phase == release.HookPhaseFailed {
-				return microerror.Maskf(testReleaseFailureError, "tests for %#q failed", releaseName)
+		return result, microerror.Mask(runErr)
+	}
+
+	if options.CleanupOnSuccess {
+		for _, test := range result.Tests {
+			if test.Kind != "Pod" {
+				continue
+			}
+
+			err := c.k8sClient.CoreV1().Pods(namespace).Delete(ctx, test.Name, metav1.DeleteOptions{})
+			if apierrors.IsNotFound(err) {
+				// The hook delete policy may have removed the pod already.
+			} else if err != nil {
+				return result, microerror.Mask(err)
 			}
 		}
+	}
+
+	return result, nil
+}
+
+// getTestPodLogs returns the logs of the given test pod. Failing to fetch logs
+// must not hide the test result so errors are only logged.
+func (c *Client) getTestPodLogs(ctx context.Context, namespace, podName string) string {
+	limitBytes := int64(maxTestLogBytes)
+
+	logs, err := c.k8sClient.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{LimitBytes: &limitBytes}).Do(ctx).Raw()
+	if err != nil {
+		c.logger.LogCtx(ctx, "level", "warning", "message", fmt.Sprintf("failed to get logs of test pod %#q in namespace %#q", podName, namespace), "stack", fmt.Sprintf("%#v", err))
+		return ""
+	}
+
+	return string(logs)
+}
+
+func (options ReleaseTestOptions) configure(action *action.ReleaseTesting, namespace string) {
+	if options.Timeout == 0 {
+		options.Timeout = time.Second * defaultK8sClientTimeout
+	}
+
+	action.Namespace = namespace
+	action.Timeout = options.Timeout
+
+	if len(options.Filter) > 0 {
+		action.Filters = map[string][]string{
+			"name": options.Filter,
+		}
+	}
+}
+
+// matches returns true if the test with the given name was selected by the
+// filter.
+func (options ReleaseTestOptions) matches(name string) bool {
+	if len(options.Filter) == 0 {
+		return true
+	}
+
+	for _, f := range options.Filter {
+		if f == name {
+			return true
+		}
+	}
 
-		return microerror.Mask(err)
+	return false
+}
+
+func isTestHook(hook *release.Hook) bool {
+	for _, event := range hook.Events {
+		if event == release.HookTest {
+			return true
+		}
 	}
 
-	return nil
+	return false
 }
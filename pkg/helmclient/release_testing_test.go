@@ -0,0 +1,277 @@
+package helmclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/google/go-cmp/cmp"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_ReleaseTestOptions_matches(t *testing.T) {
+	testCases := []struct {
+		name            string
+		filter          []string
+		testName        string
+		expectedMatches bool
+	}{
+		{
+			name:            "case 0: no filter matches all tests",
+			filter:          nil,
+			testName:        "foo-test",
+			expectedMatches: true,
+		},
+		{
+			name:            "case 1: filtered test",
+			filter:          []string{"foo-test", "bar-test"},
+			testName:        "bar-test",
+			expectedMatches: true,
+		},
+		{
+			name:            "case 2: test not filtered",
+			filter:          []string{"foo-test"},
+			testName:        "bar-test",
+			expectedMatches: false,
+		},
+		{
+			name:            "case 3: names must match exactly",
+			filter:          []string{"foo"},
+			testName:        "foo-test",
+			expectedMatches: false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			matches := ReleaseTestOptions{Filter: tc.filter}.matches(tc.testName)
+			if matches != tc.expectedMatches {
+				t.Fatalf("expected matches %t got %t", tc.expectedMatches, matches)
+			}
+		})
+	}
+}
+
+func Test_isTestHook(t *testing.T) {
+	testCases := []struct {
+		name           string
+		events         []release.HookEvent
+		expectedIsTest bool
+	}{
+		{
+			name:           "case 0: test hook",
+			events:         []release.HookEvent{release.HookTest},
+			expectedIsTest: true,
+		},
+		{
+			name:           "case 1: test hook among other events",
+			events:         []release.HookEvent{release.HookPostInstall, release.HookTest},
+			expectedIsTest: true,
+		},
+		{
+			name:           "case 2: other hook",
+			events:         []release.HookEvent{release.HookPreInstall},
+			expectedIsTest: false,
+		},
+		{
+			name:           "case 3: hook without events",
+			events:         nil,
+			expectedIsTest: false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			isTest := isTestHook(&release.Hook{Events: tc.events})
+			if isTest != tc.expectedIsTest {
+				t.Fatalf("expected test hook %t got %t", tc.expectedIsTest, isTest)
+			}
+		})
+	}
+}
+
+func Test_Client_testRelease(t *testing.T) {
+	testCases := []struct {
+		name                string
+		options             ReleaseTestOptions
+		watchError          error
+		expectedTests       []ReleaseTest
+		expectedPodsDeleted bool
+		errorMatcher        func(error) bool
+	}{
+		{
+			name:    "case 0: all tests succeed",
+			options: ReleaseTestOptions{},
+			expectedTests: []ReleaseTest{
+				{Kind: "Pod", Logs: "fake logs", Name: "foo-test", Phase: "Succeeded"},
+				{Kind: "Job", Name: "foo-job-test", Phase: "Succeeded"},
+				{Kind: "Pod", Logs: "fake logs", Name: "foo-last-test", Phase: "Succeeded"},
+			},
+		},
+		{
+			name:    "case 1: filtered tests",
+			options: ReleaseTestOptions{Filter: []string{"foo-job-test"}},
+			expectedTests: []ReleaseTest{
+				{Kind: "Job", Name: "foo-job-test", Phase: "Succeeded"},
+			},
+		},
+		{
+			name:       "case 2: failing test",
+			options:    ReleaseTestOptions{},
+			watchError: errors.New("pod failed"),
+			expectedTests: []ReleaseTest{
+				{Kind: "Pod", Logs: "fake logs", Name: "foo-test", Phase: "Failed"},
+				{Kind: "Job", Name: "foo-job-test"},
+				{Kind: "Pod", Name: "foo-last-test"},
+			},
+			errorMatcher: IsTestReleaseFailure,
+		},
+		{
+			name:       "case 3: timeout",
+			options:    ReleaseTestOptions{},
+			watchError: context.DeadlineExceeded,
+			expectedTests: []ReleaseTest{
+				{Kind: "Pod", Logs: "fake logs", Name: "foo-test", Phase: "Failed"},
+				{Kind: "Job", Name: "foo-job-test"},
+				{Kind: "Pod", Name: "foo-last-test"},
+			},
+			errorMatcher: IsTestReleaseTimeout,
+		},
+		{
+			name:    "case 4: test pods are cleaned up on success",
+			options: ReleaseTestOptions{CleanupOnSuccess: true},
+			expectedTests: []ReleaseTest{
+				{Kind: "Pod", Logs: "fake logs", Name: "foo-test", Phase: "Succeeded"},
+				{Kind: "Job", Name: "foo-job-test", Phase: "Succeeded"},
+				{Kind: "Pod", Logs: "fake logs", Name: "foo-last-test", Phase: "Succeeded"},
+			},
+			expectedPodsDeleted: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			k8sClient := fake.NewSimpleClientset(&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo-test", Namespace: "default"},
+			})
+			c := &Client{
+				k8sClient: k8sClient,
+				logger:    microloggertest.New(),
+			}
+
+			cfg := &action.Configuration{
+				Capabilities: chartutil.DefaultCapabilities,
+				KubeClient: &kubefake.FailingKubeClient{
+					PrintingKubeClient:   kubefake.PrintingKubeClient{Out: io.Discard},
+					WatchUntilReadyError: tc.watchError,
+				},
+				Log:      func(string, ...interface{}) {},
+				Releases: storage.Init(driver.NewMemory()),
+			}
+			err := cfg.Releases.Create(newReleaseTestingTestRelease())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := c.testRelease(context.Background(), cfg, "default", "foo", tc.options)
+
+			switch {
+			case err == nil && tc.errorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			// Times of the test runs are only checked for being set.
+			var tests []ReleaseTest
+			for _, test := range result.Tests {
+				ran := test.Phase == "Succeeded" || test.Phase == "Failed"
+				if ran && (test.StartedAt.IsZero() || test.CompletedAt.IsZero()) {
+					t.Fatalf("expected start and completion time of test %#q", test.Name)
+				}
+
+				test.CompletedAt = time.Time{}
+				test.StartedAt = time.Time{}
+				tests = append(tests, test)
+			}
+			if diff := cmp.Diff(tc.expectedTests, tests); diff != "" {
+				t.Fatalf("want matching tests \n %s", diff)
+			}
+
+			_, err = k8sClient.CoreV1().Pods("default").Get(context.Background(), "foo-test", metav1.GetOptions{})
+			if apierrors.IsNotFound(err) != tc.expectedPodsDeleted {
+				t.Fatalf("expected test pod deleted %t got error %#v", tc.expectedPodsDeleted, err)
+			}
+		})
+	}
+}
+
+// newReleaseTestingTestRelease returns a deployed release with test pods run
+// before and after a test job and a hook which is not a test.
+func newReleaseTestingTestRelease() *release.Release {
+	return &release.Release{
+		Name:      "foo",
+		Namespace: "default",
+		Version:   1,
+		Info:      &release.Info{Status: release.StatusDeployed},
+		Chart: &chart.Chart{
+			Metadata: &chart.Metadata{
+				APIVersion: chart.APIVersionV2,
+				Name:       "foo",
+				Version:    "1.0.0",
+			},
+		},
+		Hooks: []*release.Hook{
+			{
+				Name:     "foo-migrate",
+				Kind:     "Job",
+				Manifest: "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: foo-migrate\n",
+				Events:   []release.HookEvent{release.HookPreInstall},
+			},
+			{
+				Name:     "foo-test",
+				Kind:     "Pod",
+				Manifest: "apiVersion: v1\nkind: Pod\nmetadata:\n  name: foo-test\n",
+				Events:   []release.HookEvent{release.HookTest},
+			},
+			{
+				Name:     "foo-job-test",
+				Kind:     "Job",
+				Manifest: "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: foo-job-test\n",
+				Events:   []release.HookEvent{release.HookTest},
+				Weight:   1,
+			},
+			{
+				Name:     "foo-last-test",
+				Kind:     "Pod",
+				Manifest: "apiVersion: v1\nkind: Pod\nmetadata:\n  name: foo-last-test\n",
+				Events:   []release.HookEvent{release.HookTest},
+				Weight:   2,
+			},
+		},
+	}
+}
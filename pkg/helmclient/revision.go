@@ -0,0 +1,246 @@
+package helmclient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+	"github.com/pmezard/go-difflib/difflib"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// diffContext is the number of unchanged lines shown around each change of a
+// unified diff.
+const diffContext = 3
+
+// GetReleaseRevision gets the given revision of the Helm Release. The options
+// control which additional parts of the release like the rendered manifest
+// are included.
+func (c *Client) GetReleaseRevision(ctx context.Context, namespace, releaseName string, revision int, options GetOptions) (*ReleaseContent, error) {
+	eventName := "get_release_revision"
+
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeReleaseNamespace, namespace),
+		attribute.String(attributeReleaseName, releaseName),
+	))
+	defer span.End()
+
+	m := c.metrics.observe(eventName, namespace)
+	defer m.stop()
+
+	releaseContent, err := c.getReleaseRevision(ctx, namespace, releaseName, revision, options)
+	err = translateHelmError(err, namespace, releaseName)
+	if err != nil {
+		m.fail()
+		recordSpanError(span, err)
+		return nil, microerror.Mask(err)
+	}
+
+	return releaseContent, nil
+}
+
+func (c *Client) getReleaseRevision(ctx context.Context, namespace, releaseName string, revision int, options GetOptions) (*ReleaseContent, error) {
+	if revision <= 0 {
+		return nil, microerror.Maskf(invalidConfigError, "revision must be greater than 0")
+	}
+
+	releaseContent, err := c.getReleaseContent(ctx, namespace, releaseName, revision, options)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return releaseContent, nil
+}
+
+// CompareRevisions compares two revisions of the Helm Release and returns the
+// differences of their values and rendered manifests.
+func (c *Client) CompareRevisions(ctx context.Context, namespace, releaseName string, fromRevision, toRevision int) (*RevisionDiff, error) {
+	eventName := "compare_revisions"
+
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeReleaseNamespace, namespace),
+		attribute.String(attributeReleaseName, releaseName),
+	))
+	defer span.End()
+
+	m := c.metrics.observe(eventName, namespace)
+	defer m.stop()
+
+	diff, err := c.compareRevisions(ctx, namespace, releaseName, fromRevision, toRevision)
+	err = translateHelmError(err, namespace, releaseName)
+	if err != nil {
+		m.fail()
+		recordSpanError(span, err)
+		return nil, microerror.Mask(err)
+	}
+
+	return diff, nil
+}
+
+func (c *Client) compareRevisions(ctx context.Context, namespace, releaseName string, fromRevision, toRevision int) (*RevisionDiff, error) {
+	if fromRevision <= 0 || toRevision <= 0 {
+		return nil, microerror.Maskf(invalidConfigError, "revisions must be greater than 0")
+	}
+
+	options := GetOptions{
+		IncludeManifest: true,
+	}
+
+	from, err := c.getReleaseContent(ctx, namespace, releaseName, fromRevision, options)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	to, err := c.getReleaseContent(ctx, namespace, releaseName, toRevision, options)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	fromName := fmt.Sprintf("revision %d", fromRevision)
+	toName := fmt.Sprintf("revision %d", toRevision)
+
+	valuesDiff, err := unifiedDiff(fromName, toName, from.Values, to.Values)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	objects, err := diffObjects(fromName, toName, from.Objects, to.Objects)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	diff := &RevisionDiff{
+		FromRevision: fromRevision,
+		ToRevision:   toRevision,
+		ValuesDiff:   valuesDiff,
+		Objects:      objects,
+	}
+
+	return diff, nil
+}
+
+// diffObjects returns the objects that were added, removed or changed between
+// the given manifests, sorted by their key.
+func diffObjects(fromName, toName string, from, to []*unstructured.Unstructured) ([]ObjectDiff, error) {
+	fromObjects := map[string]*unstructured.Unstructured{}
+	for _, o := range from {
+		fromObjects[objectKey(o)] = o
+	}
+	toObjects := map[string]*unstructured.Unstructured{}
+	for _, o := range to {
+		toObjects[objectKey(o)] = o
+	}
+
+	var diffs []ObjectDiff
+
+	for key, o := range fromObjects {
+		if _, ok := toObjects[key]; !ok {
+			d, err := unifiedDiff(fromName, toName, o.Object, nil)
+			if err != nil {
+				return nil, microerror.Mask(err)
+			}
+			diffs = append(diffs, newObjectDiff(ObjectRemoved, o, d))
+		}
+	}
+	for key, o := range toObjects {
+		var fromObject map[string]interface{}
+		f, ok := fromObjects[key]
+		if ok {
+			fromObject = f.Object
+		}
+
+		d, err := unifiedDiff(fromName, toName, fromObject, o.Object)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		if !ok {
+			diffs = append(diffs, newObjectDiff(ObjectAdded, o, d))
+		} else if d != "" {
+			diffs = append(diffs, newObjectDiff(ObjectChanged, o, d))
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].key() < diffs[j].key()
+	})
+
+	return diffs, nil
+}
+
+// unifiedDiff returns the unified line diff of the YAML representation of
+// the given values. Nil values are treated as empty documents. The diff is
+// empty if both are equal.
+func unifiedDiff(fromName, toName string, from, to map[string]interface{}) (string, error) {
+	fromYAML, err := toDiffYAML(from)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+	toYAML, err := toDiffYAML(to)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(fromYAML),
+		B:        splitLines(toYAML),
+		FromFile: fromName,
+		ToFile:   toName,
+		Context:  diffContext,
+	})
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return diff, nil
+}
+
+func toDiffYAML(v map[string]interface{}) (string, error) {
+	if len(v) == 0 {
+		return "", nil
+	}
+
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return string(b), nil
+}
+
+func newObjectDiff(change string, o *unstructured.Unstructured, diff string) ObjectDiff {
+	return ObjectDiff{
+		APIVersion: o.GetAPIVersion(),
+		Change:     change,
+		Diff:       diff,
+		Kind:       o.GetKind(),
+		Name:       o.GetName(),
+		Namespace:  o.GetNamespace(),
+	}
+}
+
+// objectKey identifies an object in a manifest by its group, kind, namespace
+// and name. The version is left out so that objects moving to a new API
+// version are reported as changed rather than removed and added.
+func objectKey(o *unstructured.Unstructured) string {
+	gvk := o.GroupVersionKind()
+	return fmt.Sprintf("%s/%s/%s/%s", gvk.Group, gvk.Kind, o.GetNamespace(), o.GetName())
+}
+
+func (d ObjectDiff) key() string {
+	return fmt.Sprintf("%s/%s/%s/%s", d.APIVersion, d.Kind, d.Namespace, d.Name)
+}
+
+// splitLines splits the text into lines keeping their line breaks. Unlike
+// difflib.SplitLines it does not add an empty line after the trailing line
+// break.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,250 @@
+package helmclient
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace/noop"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func Test_Client_GetReleaseRevision_invalidRevision(t *testing.T) {
+	m, err := newMetrics(metricsConfig{Registerer: prometheus.NewRegistry()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Client{
+		metrics: m,
+		tracer:  noop.NewTracerProvider().Tracer("test"),
+	}
+
+	for _, revision := range []int{0, -1} {
+		_, err := c.GetReleaseRevision(context.Background(), "default", "foo", revision, GetOptions{})
+		if !IsInvalidConfig(err) {
+			t.Fatalf("error == %#v, want invalid config error", err)
+		}
+	}
+}
+
+func Test_diffObjects(t *testing.T) {
+	testCases := []struct {
+		name          string
+		from          []*unstructured.Unstructured
+		to            []*unstructured.Unstructured
+		expectedDiffs []ObjectDiff
+	}{
+		{
+			name: "case 0: equal objects are not reported",
+			from: []*unstructured.Unstructured{
+				newDiffTestConfigMap("v1", "foo", "bar"),
+			},
+			to: []*unstructured.Unstructured{
+				newDiffTestConfigMap("v1", "foo", "bar"),
+			},
+			expectedDiffs: nil,
+		},
+		{
+			name: "case 1: changed object",
+			from: []*unstructured.Unstructured{
+				newDiffTestConfigMap("v1", "foo", "bar"),
+			},
+			to: []*unstructured.Unstructured{
+				newDiffTestConfigMap("v1", "foo", "baz"),
+			},
+			expectedDiffs: []ObjectDiff{
+				{
+					APIVersion: "v1",
+					Change:     ObjectChanged,
+					Diff: `--- revision 1
++++ revision 2
+@@ -1,6 +1,6 @@
+ apiVersion: v1
+ data:
+-  key: bar
++  key: baz
+ kind: ConfigMap
+ metadata:
+   name: foo
+`,
+					Kind:      "ConfigMap",
+					Name:      "foo",
+					Namespace: "default",
+				},
+			},
+		},
+		{
+			name: "case 2: added and removed objects sorted by key",
+			from: []*unstructured.Unstructured{
+				newDiffTestConfigMap("v1", "foo", "bar"),
+			},
+			to: []*unstructured.Unstructured{
+				newDiffTestConfigMap("v1", "bar", "bar"),
+			},
+			expectedDiffs: []ObjectDiff{
+				{
+					APIVersion: "v1",
+					Change:     ObjectAdded,
+					Diff: `--- revision 1
++++ revision 2
+@@ -0,0 +1,7 @@
++apiVersion: v1
++data:
++  key: bar
++kind: ConfigMap
++metadata:
++  name: bar
++  namespace: default
+`,
+					Kind:      "ConfigMap",
+					Name:      "bar",
+					Namespace: "default",
+				},
+				{
+					APIVersion: "v1",
+					Change:     ObjectRemoved,
+					Diff: `--- revision 1
++++ revision 2
+@@ -1,7 +0,0 @@
+-apiVersion: v1
+-data:
+-  key: bar
+-kind: ConfigMap
+-metadata:
+-  name: foo
+-  namespace: default
+`,
+					Kind:      "ConfigMap",
+					Name:      "foo",
+					Namespace: "default",
+				},
+			},
+		},
+		{
+			name: "case 3: object moving to a new API version is changed",
+			from: []*unstructured.Unstructured{
+				newDiffTestObject("autoscaling/v1", "HorizontalPodAutoscaler", "foo"),
+			},
+			to: []*unstructured.Unstructured{
+				newDiffTestObject("autoscaling/v2", "HorizontalPodAutoscaler", "foo"),
+			},
+			expectedDiffs: []ObjectDiff{
+				{
+					APIVersion: "autoscaling/v2",
+					Change:     ObjectChanged,
+					Diff: `--- revision 1
++++ revision 2
+@@ -1,4 +1,4 @@
+-apiVersion: autoscaling/v1
++apiVersion: autoscaling/v2
+ kind: HorizontalPodAutoscaler
+ metadata:
+   name: foo
+`,
+					Kind:      "HorizontalPodAutoscaler",
+					Name:      "foo",
+					Namespace: "default",
+				},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			diffs, err := diffObjects("revision 1", "revision 2", tc.from, tc.to)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			if diff := cmp.Diff(tc.expectedDiffs, diffs); diff != "" {
+				t.Fatalf("want matching diffs \n %s", diff)
+			}
+		})
+	}
+}
+
+func Test_unifiedDiff(t *testing.T) {
+	testCases := []struct {
+		name         string
+		from         map[string]interface{}
+		to           map[string]interface{}
+		expectedDiff string
+	}{
+		{
+			name:         "case 0: equal values",
+			from:         map[string]interface{}{"replicas": 2},
+			to:           map[string]interface{}{"replicas": 2},
+			expectedDiff: "",
+		},
+		{
+			name:         "case 1: nil and empty values are equal",
+			from:         nil,
+			to:           map[string]interface{}{},
+			expectedDiff: "",
+		},
+		{
+			name: "case 2: changed nested value",
+			from: map[string]interface{}{
+				"image": map[string]interface{}{
+					"tag": "1.0.0",
+				},
+				"replicas": 2,
+			},
+			to: map[string]interface{}{
+				"image": map[string]interface{}{
+					"tag": "1.1.0",
+				},
+				"replicas": 2,
+			},
+			expectedDiff: `--- revision 1
++++ revision 2
+@@ -1,3 +1,3 @@
+ image:
+-  tag: 1.0.0
++  tag: 1.1.0
+ replicas: 2
+`,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			diff, err := unifiedDiff("revision 1", "revision 2", tc.from, tc.to)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			if diff != tc.expectedDiff {
+				t.Fatalf("expected diff %q got %q", tc.expectedDiff, diff)
+			}
+		})
+	}
+}
+
+func newDiffTestConfigMap(apiVersion, name, value string) *unstructured.Unstructured {
+	o := newDiffTestObject(apiVersion, "ConfigMap", name)
+	o.Object["data"] = map[string]interface{}{
+		"key": value,
+	}
+	return o
+}
+
+func newDiffTestObject(apiVersion, kind, name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": "default",
+			},
+		},
+	}
+}
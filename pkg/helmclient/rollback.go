@@ -5,7 +5,8 @@ import (
 	"time"
 
 	"github.com/giantswarm/microerror"
-	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"helm.sh/helm/v3/pkg/action"
 )
 
@@ -13,35 +14,61 @@ import (
 func (c *Client) Rollback(ctx context.Context, namespace, releaseName string, revision int, options RollbackOptions) error {
 	eventName := "rollback"
 
-	t := prometheus.NewTimer(histogram.WithLabelValues(eventName))
-	defer func() {
-		eventCounter.WithLabelValues(eventName, releaseName).Inc()
-		t.ObserveDuration()
-	}()
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeReleaseNamespace, namespace),
+		attribute.String(attributeReleaseName, releaseName),
+	))
+	defer span.End()
 
-	err := c.rollback(ctx, namespace, releaseName, revision, options)
+	m := c.metrics.observe(eventName, namespace)
+	defer m.stop()
+
+	ctx, debugLog := withDebugLog(ctx)
+
+	audit := c.newAudit(AuditOperationRollback, namespace, releaseName, nil)
+	err := c.rollback(ctx, audit, namespace, releaseName, revision, options)
+	err = translateHelmError(err, namespace, releaseName)
+	audit.finish(ctx, err)
+	c.recordEvent(options.EventObject, rollbackOperation, namespace, releaseName, err)
 	if err != nil {
-		errorGauge.WithLabelValues(eventName).Inc()
-		return microerror.Mask(err)
+		m.fail()
+		recordSpanError(span, err)
+		return microerror.Mask(debugLog.attach(err))
 	}
 
 	return nil
 }
 
-func (c *Client) rollback(ctx context.Context, namespace, releaseName string, revision int, options RollbackOptions) error {
-	cfg, err := c.newActionConfig(ctx, namespace)
+func (c *Client) rollback(ctx context.Context, audit *auditTrail, namespace, releaseName string, revision int, options RollbackOptions) error {
+	ctx, unlock, err := c.lockRelease(ctx, namespace, releaseName)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	defer unlock()
+
+	audit.start(ctx)
+
+	cfg, _, err := c.newActionConfigWithKubeClients(ctx, namespace, kubeClientOptions{
+		Progress: newProgressReporter(options.Progress),
+	})
 	if err != nil {
 		return microerror.Mask(err)
 	}
 
 	rollback := action.NewRollback(cfg)
 
+	if options.MaxHistory == 0 {
+		options.MaxHistory = c.maxHistory
+	}
+
 	// Configure action with supported rollback options.
 	options.configure(rollback, namespace, revision)
 
+	start := time.Now()
+
 	err = rollback.Run(releaseName)
 	if err != nil {
-		return microerror.Mask(err)
+		return microerror.Mask(c.lastHookFailure(ctx, cfg, namespace, releaseName, start, err))
 	}
 
 	return nil
@@ -52,7 +79,14 @@ func (options RollbackOptions) configure(action *action.Rollback, namespace stri
 		options.Timeout = time.Second * defaultK8sClientTimeout
 	}
 
+	action.DisableHooks = options.DisableHooks
 	action.Force = options.Force
+	// A negative MaxHistory keeps all revisions which is expressed as 0 in
+	// Helm.
+	if options.MaxHistory < 0 {
+		options.MaxHistory = 0
+	}
+	action.MaxHistory = options.MaxHistory
 	action.Timeout = options.Timeout
 	action.Version = revision
 	action.Wait = options.Wait
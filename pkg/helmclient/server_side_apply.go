@@ -0,0 +1,267 @@
+package helmclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+	"helm.sh/helm/v3/pkg/kube"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+const (
+	// defaultFieldManager is the field manager used for server-side apply
+	// when none is configured.
+	defaultFieldManager = "helmclient"
+)
+
+var (
+	// applyConflictManagerRegexp extracts the quoted manager name from the
+	// message of a field manager conflict cause returned by the API server,
+	// e.g. `conflict with "kubectl-edit" using apps/v1`.
+	applyConflictManagerRegexp = regexp.MustCompile(`^conflict with ("(?:[^"\\]|\\.)*")`)
+)
+
+// ApplyConflict describes a field of an object that is owned by another field
+// manager.
+type ApplyConflict struct {
+	// Field is the path of the conflicting field, e.g. .spec.replicas.
+	Field string
+	// Manager is the field manager owning the field.
+	Manager string
+	// Object is the object the conflict occurred on.
+	Object ObjectReference
+}
+
+// ApplyConflictError is returned when applying manifests using server-side
+// apply failed because fields are owned by other field managers. It wraps
+// the error returned by the API server.
+type ApplyConflictError struct {
+	// Conflicts are the conflicting fields.
+	Conflicts []ApplyConflict
+
+	err error
+}
+
+func (e *ApplyConflictError) Error() string {
+	var conflicts []string
+	for _, c := range e.Conflicts {
+		conflicts = append(conflicts, fmt.Sprintf("%s %#q field %s owned by %#q", c.Object.Kind, c.Object.Name, c.Field, c.Manager))
+	}
+
+	return fmt.Sprintf("server-side apply conflicts: %s", strings.Join(conflicts, ", "))
+}
+
+func (e *ApplyConflictError) Unwrap() error {
+	return e.err
+}
+
+// IsApplyConflict asserts ApplyConflictError.
+func IsApplyConflict(err error) bool {
+	var applyConflictError *ApplyConflictError
+	return errors.As(err, &applyConflictError)
+}
+
+// serverSideApplyClient is a Helm kube client creating and updating resources
+// using Kubernetes server-side apply instead of Helm's three-way strategic
+// merge patch. All other operations are delegated to the Helm kube client.
+type serverSideApplyClient struct {
+	*kube.Client
+
+	fieldManager   string
+	forceConflicts bool
+}
+
+func newServerSideApplyClient(client *kube.Client, fieldManager string, forceConflicts bool) *serverSideApplyClient {
+	if fieldManager == "" {
+		fieldManager = defaultFieldManager
+	}
+
+	return &serverSideApplyClient{
+		Client: client,
+
+		fieldManager:   fieldManager,
+		forceConflicts: forceConflicts,
+	}
+}
+
+// Create applies the given resources.
+func (c *serverSideApplyClient) Create(resources kube.ResourceList) (*kube.Result, error) {
+	res := &kube.Result{}
+
+	err := resources.Visit(func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+
+		err = c.apply(info)
+		if err != nil {
+			return err
+		}
+
+		res.Created = append(res.Created, info)
+
+		return nil
+	})
+	if err != nil {
+		return res, err
+	}
+
+	return res, nil
+}
+
+// Update applies the target resources and deletes resources of the original
+// release which are not part of the target anymore, unless they are
+// annotated with helm.sh/resource-policy: keep. This mirrors the behaviour
+// of the Helm kube client. Replacing resources with force is not supported
+// as server-side apply resolves conflicts using forceConflicts instead.
+func (c *serverSideApplyClient) Update(original, target kube.ResourceList, force bool) (*kube.Result, error) {
+	res := &kube.Result{}
+
+	if force {
+		return res, microerror.Maskf(invalidConfigError, "force must not be used with server-side apply, use force conflicts instead")
+	}
+
+	err := target.Visit(func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+
+		helper := resource.NewHelper(info.Client, info.Mapping)
+
+		_, err = helper.Get(info.Namespace, info.Name)
+		if apierrors.IsNotFound(err) {
+			res.Created = append(res.Created, info)
+		} else if err != nil {
+			return err
+		} else {
+			res.Updated = append(res.Updated, info)
+		}
+
+		return c.apply(info)
+	})
+	if err != nil {
+		return res, err
+	}
+
+	for _, info := range original.Difference(target) {
+		err := info.Get()
+		if err != nil {
+			c.Log("unable to get %s %q: %s", info.Mapping.GroupVersionKind.Kind, info.Name, err)
+			continue
+		}
+
+		annotations, err := annotationsOf(info)
+		if err != nil {
+			c.Log("unable to get annotations of %q: %s", info.Name, err)
+		}
+		if hasKeepPolicy(annotations) {
+			c.Log("skipping delete of %q due to annotation [%s=%s]", info.Name, kube.ResourcePolicyAnno, kube.KeepPolicy)
+			continue
+		}
+
+		policy := metav1.DeletePropagationBackground
+		_, err = resource.NewHelper(info.Client, info.Mapping).DeleteWithOptions(info.Namespace, info.Name, &metav1.DeleteOptions{PropagationPolicy: &policy})
+		if err != nil && !apierrors.IsNotFound(err) {
+			c.Log("failed to delete %q: %s", info.ObjectName(), err)
+			continue
+		}
+
+		res.Deleted = append(res.Deleted, info)
+	}
+
+	return res, nil
+}
+
+// UpdateThreeWayMerge is used by Helm when adopting existing resources. It
+// behaves like Update as server-side apply merges on the server.
+func (c *serverSideApplyClient) UpdateThreeWayMerge(original, target kube.ResourceList, force bool) (*kube.Result, error) {
+	return c.Update(original, target, force)
+}
+
+func (c *serverSideApplyClient) apply(info *resource.Info) error {
+	data, err := json.Marshal(info.Object)
+	if err != nil {
+		return err
+	}
+
+	helper := resource.NewHelper(info.Client, info.Mapping).WithFieldManager(c.fieldManager)
+
+	obj, err := helper.Patch(info.Namespace, info.Name, types.ApplyPatchType, data, &metav1.PatchOptions{
+		Force: &c.forceConflicts,
+	})
+	if apierrors.IsConflict(err) {
+		return newApplyConflictError(info, err)
+	} else if err != nil {
+		return err
+	}
+
+	return info.Refresh(obj, true)
+}
+
+// newApplyConflictError converts the field manager conflict causes of the
+// given API error into an ApplyConflictError. Other errors are returned as
+// is.
+func newApplyConflictError(info *resource.Info, err error) error {
+	var statusError apierrors.APIStatus
+	if !errors.As(err, &statusError) || statusError.Status().Details == nil {
+		return err
+	}
+
+	object := ObjectReference{
+		APIVersion: info.Mapping.GroupVersionKind.GroupVersion().String(),
+		Kind:       info.Mapping.GroupVersionKind.Kind,
+		Name:       info.Name,
+		Namespace:  info.Namespace,
+	}
+
+	applyConflictError := &ApplyConflictError{err: err}
+	for _, cause := range statusError.Status().Details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+
+		manager := cause.Message
+		if m := applyConflictManagerRegexp.FindStringSubmatch(cause.Message); m != nil {
+			unquoted, err := strconv.Unquote(m[1])
+			if err == nil {
+				manager = unquoted
+			}
+		}
+
+		applyConflictError.Conflicts = append(applyConflictError.Conflicts, ApplyConflict{
+			Field:   cause.Field,
+			Manager: manager,
+			Object:  object,
+		})
+	}
+
+	if len(applyConflictError.Conflicts) == 0 {
+		return err
+	}
+
+	return applyConflictError
+}
+
+func annotationsOf(info *resource.Info) (map[string]string, error) {
+	accessor, err := apimeta.Accessor(info.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	return accessor.GetAnnotations(), nil
+}
+
+// hasKeepPolicy returns true if the given annotations keep the object when it
+// is removed from the release. Like Helm the policy is case insensitive.
+func hasKeepPolicy(annotations map[string]string) bool {
+	return strings.ToLower(strings.TrimSpace(annotations[kube.ResourcePolicyAnno])) == kube.KeepPolicy
+}
@@ -0,0 +1,389 @@
+package helmclient
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"helm.sh/helm/v3/pkg/kube"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes/scheme"
+	restfake "k8s.io/client-go/rest/fake"
+)
+
+func Test_newApplyConflictError(t *testing.T) {
+	info := &resource.Info{
+		Mapping: &meta.RESTMapping{
+			GroupVersionKind: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+		},
+		Name:      "foo",
+		Namespace: "default",
+	}
+	object := ObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "foo", Namespace: "default"}
+
+	testCases := []struct {
+		name              string
+		err               error
+		expectedConflicts []ApplyConflict
+	}{
+		{
+			name: "case 0: conflicts with managers",
+			err: &apierrors.StatusError{ErrStatus: metav1.Status{
+				Reason: metav1.StatusReasonConflict,
+				Code:   409,
+				Details: &metav1.StatusDetails{
+					Causes: []metav1.StatusCause{
+						{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "kubectl-edit" using apps/v1`, Field: ".spec.replicas"},
+						{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "hpa"`, Field: ".spec.template.spec.containers[name=\"foo\"].image"},
+					},
+				},
+			}},
+			expectedConflicts: []ApplyConflict{
+				{Field: ".spec.replicas", Manager: "kubectl-edit", Object: object},
+				{Field: ".spec.template.spec.containers[name=\"foo\"].image", Manager: "hpa", Object: object},
+			},
+		},
+		{
+			name: "case 1: conflict without field manager causes",
+			err: &apierrors.StatusError{ErrStatus: metav1.Status{
+				Reason: metav1.StatusReasonConflict,
+				Code:   409,
+			}},
+			expectedConflicts: nil,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			err := newApplyConflictError(info, tc.err)
+
+			var applyConflictError *ApplyConflictError
+			if !errors.As(err, &applyConflictError) {
+				if tc.expectedConflicts != nil {
+					t.Fatalf("expected ApplyConflictError, got %#v", err)
+				}
+				if err != tc.err {
+					t.Fatalf("expected original error, got %#v", err)
+				}
+				return
+			}
+
+			if diff := cmp.Diff(tc.expectedConflicts, applyConflictError.Conflicts); diff != "" {
+				t.Fatalf("conflicts mismatch (-want +got):\n%s", diff)
+			}
+			if !apierrors.IsConflict(err) {
+				t.Fatalf("expected wrapped error to be a conflict")
+			}
+		})
+	}
+}
+
+func Test_hasKeepPolicy(t *testing.T) {
+	testCases := []struct {
+		name         string
+		annotations  map[string]string
+		expectedKeep bool
+	}{
+		{
+			name:         "case 0: no annotations",
+			annotations:  nil,
+			expectedKeep: false,
+		},
+		{
+			name:         "case 1: keep policy",
+			annotations:  map[string]string{kube.ResourcePolicyAnno: "keep"},
+			expectedKeep: true,
+		},
+		{
+			name:         "case 2: keep policy with different case and whitespace",
+			annotations:  map[string]string{kube.ResourcePolicyAnno: " Keep\n"},
+			expectedKeep: true,
+		},
+		{
+			name:         "case 3: other policy",
+			annotations:  map[string]string{kube.ResourcePolicyAnno: "delete"},
+			expectedKeep: false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			keep := hasKeepPolicy(tc.annotations)
+			if keep != tc.expectedKeep {
+				t.Fatalf("expected keep %t got %t", tc.expectedKeep, keep)
+			}
+		})
+	}
+}
+
+func Test_serverSideApplyClient_Update_force(t *testing.T) {
+	c := newServerSideApplyClient(&kube.Client{Log: func(string, ...interface{}) {}}, "", false)
+
+	_, err := c.Update(nil, nil, true)
+	if !IsInvalidConfig(err) {
+		t.Fatalf("error == %#v, want invalid config error", err)
+	}
+}
+
+func Test_serverSideApplyClient_apply(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		fieldManager         string
+		forceConflicts       bool
+		conflict             bool
+		expectedFieldManager string
+		expectedForce        string
+		errorMatcher         func(error) bool
+	}{
+		{
+			name:                 "case 0: default field manager without forcing conflicts",
+			expectedFieldManager: "helmclient",
+			expectedForce:        "false",
+		},
+		{
+			name:                 "case 1: configured field manager forcing conflicts",
+			fieldManager:         "operator",
+			forceConflicts:       true,
+			expectedFieldManager: "operator",
+			expectedForce:        "true",
+		},
+		{
+			name:                 "case 2: conflict",
+			conflict:             true,
+			expectedFieldManager: "helmclient",
+			expectedForce:        "false",
+			errorMatcher:         IsApplyConflict,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			api := newConfigMapTestAPI()
+			if tc.conflict {
+				api.conflicts["app"] = true
+			}
+
+			c := newServerSideApplyClient(&kube.Client{Log: func(string, ...interface{}) {}}, tc.fieldManager, tc.forceConflicts)
+
+			err := c.apply(api.info("app"))
+
+			switch {
+			case err == nil && tc.errorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if len(api.patches) != 1 {
+				t.Fatalf("expected 1 patch got %d", len(api.patches))
+			}
+			patch := api.patches[0]
+			if patch.Header.Get("Content-Type") != string(types.ApplyPatchType) {
+				t.Fatalf("expected patch type %#q got %#q", types.ApplyPatchType, patch.Header.Get("Content-Type"))
+			}
+			if patch.URL.Query().Get("fieldManager") != tc.expectedFieldManager {
+				t.Fatalf("expected field manager %#q got %#q", tc.expectedFieldManager, patch.URL.Query().Get("fieldManager"))
+			}
+			if patch.URL.Query().Get("force") != tc.expectedForce {
+				t.Fatalf("expected force %#q got %#q", tc.expectedForce, patch.URL.Query().Get("force"))
+			}
+		})
+	}
+}
+
+func Test_serverSideApplyClient_Create(t *testing.T) {
+	api := newConfigMapTestAPI()
+
+	c := newServerSideApplyClient(&kube.Client{Log: func(string, ...interface{}) {}}, "", false)
+
+	res, err := c.Create(kube.ResourceList{api.info("a"), api.info("b")})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	if diff := cmp.Diff([]string{"a", "b"}, infoNames(res.Created)); diff != "" {
+		t.Fatalf("want matching created resources \n %s", diff)
+	}
+	if diff := cmp.Diff([]string{"PATCH a", "PATCH b"}, api.requests); diff != "" {
+		t.Fatalf("want matching requests \n %s", diff)
+	}
+}
+
+func Test_serverSideApplyClient_UpdateThreeWayMerge(t *testing.T) {
+	api := newConfigMapTestAPI()
+	api.existing["updated"] = nil
+	api.existing["removed"] = nil
+	api.existing["kept"] = map[string]string{kube.ResourcePolicyAnno: kube.KeepPolicy}
+
+	c := newServerSideApplyClient(&kube.Client{Log: func(string, ...interface{}) {}}, "", false)
+
+	original := kube.ResourceList{api.info("updated"), api.info("removed"), api.info("kept")}
+	target := kube.ResourceList{api.info("updated"), api.info("created")}
+
+	res, err := c.UpdateThreeWayMerge(original, target, false)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	if diff := cmp.Diff([]string{"created"}, infoNames(res.Created)); diff != "" {
+		t.Fatalf("want matching created resources \n %s", diff)
+	}
+	if diff := cmp.Diff([]string{"updated"}, infoNames(res.Updated)); diff != "" {
+		t.Fatalf("want matching updated resources \n %s", diff)
+	}
+	if diff := cmp.Diff([]string{"removed"}, infoNames(res.Deleted)); diff != "" {
+		t.Fatalf("want matching deleted resources \n %s", diff)
+	}
+
+	// Target resources are applied instead of being patched with a
+	// three-way merge patch.
+	for _, patch := range api.patches {
+		if patch.Header.Get("Content-Type") != string(types.ApplyPatchType) {
+			t.Fatalf("expected patch type %#q got %#q", types.ApplyPatchType, patch.Header.Get("Content-Type"))
+		}
+	}
+	var patched []string
+	for _, r := range api.requests {
+		if strings.HasPrefix(r, "PATCH ") {
+			patched = append(patched, strings.TrimPrefix(r, "PATCH "))
+		}
+	}
+	sort.Strings(patched)
+	if diff := cmp.Diff([]string{"created", "updated"}, patched); diff != "" {
+		t.Fatalf("want matching applied resources \n %s", diff)
+	}
+}
+
+// configMapTestAPI fakes the API server serving the ConfigMaps of the default
+// namespace to the REST clients of the resource infos it returns.
+type configMapTestAPI struct {
+	// conflicts are the names of the ConfigMaps applying fails for with a
+	// field manager conflict.
+	conflicts map[string]bool
+	// existing are the annotations of the existing ConfigMaps by name.
+	existing map[string]map[string]string
+	patches  []*http.Request
+	requests []string
+}
+
+func newConfigMapTestAPI() *configMapTestAPI {
+	return &configMapTestAPI{
+		conflicts: map[string]bool{},
+		existing:  map[string]map[string]string{},
+	}
+}
+
+func (a *configMapTestAPI) info(name string) *resource.Info {
+	client := &restfake.RESTClient{
+		NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		GroupVersion:         corev1.SchemeGroupVersion,
+		Client:               restfake.CreateHTTPClient(a.roundTrip),
+	}
+
+	return &resource.Info{
+		Client: client,
+		Mapping: &meta.RESTMapping{
+			GroupVersionKind: corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+			Resource:         corev1.SchemeGroupVersion.WithResource("configmaps"),
+			Scope:            meta.RESTScopeNamespace,
+		},
+		Name:      name,
+		Namespace: "default",
+		Object:    newTestConfigMap(name, nil),
+	}
+}
+
+func (a *configMapTestAPI) roundTrip(req *http.Request) (*http.Response, error) {
+	name := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+	a.requests = append(a.requests, req.Method+" "+name)
+
+	gr := corev1.Resource("configmaps")
+	annotations, exists := a.existing[name]
+
+	switch req.Method {
+	case http.MethodGet:
+		if !exists {
+			return newConfigMapTestResponse(&apierrors.NewNotFound(gr, name).ErrStatus), nil
+		}
+		return newConfigMapTestResponse(newTestConfigMap(name, annotations)), nil
+	case http.MethodPatch:
+		a.patches = append(a.patches, req)
+		if a.conflicts[name] {
+			err := apierrors.NewApplyConflict([]metav1.StatusCause{
+				{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "kubectl"`, Field: ".data.foo"},
+			}, "Apply failed with 1 conflict")
+			return newConfigMapTestResponse(&err.ErrStatus), nil
+		}
+		return newConfigMapTestResponse(newTestConfigMap(name, annotations)), nil
+	case http.MethodDelete:
+		delete(a.existing, name)
+		return newConfigMapTestResponse(newTestConfigMap(name, annotations)), nil
+	}
+
+	return nil, errors.New("unexpected request")
+}
+
+func newTestConfigMap(name string, annotations map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: annotations,
+			Name:        name,
+			Namespace:   "default",
+		},
+	}
+}
+
+func newConfigMapTestResponse(obj runtime.Object) *http.Response {
+	code := http.StatusOK
+	if status, ok := obj.(*metav1.Status); ok {
+		code = int(status.Code)
+	}
+
+	body, err := runtime.Encode(scheme.Codecs.LegacyCodec(corev1.SchemeGroupVersion), obj)
+	if err != nil {
+		panic(err)
+	}
+
+	return &http.Response{
+		StatusCode: code,
+		Header:     http.Header{"Content-Type": []string{runtime.ContentTypeJSON}},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+	}
+}
+
+func infoNames(infos []*resource.Info) []string {
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name)
+	}
+	sort.Strings(names)
+
+	return names
+}
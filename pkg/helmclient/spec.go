@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -48,6 +49,10 @@ var (
 )
 
 const (
+	// defaultBatchWorkers is the number of operations executed concurrently
+	// when running batches.
+	defaultBatchWorkers = 4
+
 	// defaultHTTPClientTimeout is the timeout when pulling tarballs.
 	defaultHTTPClientTimeout = 5
 
@@ -55,40 +60,176 @@ const (
 	// helm releases.
 	defaultK8sClientTimeout = 300
 
-	// maxHistory is set to 10 when updating Helm releases and getting the
-	// history for a Helm release.
+	// defaultReleaseLeaseDuration is the duration of the Lease guarding a
+	// release when release leases are enabled.
+	defaultReleaseLeaseDuration = 60
+
+	// defaultRecoverStaleAfter is the time since a pending release was last
+	// deployed after which it is considered to be stuck.
+	defaultRecoverStaleAfter = 2 * defaultK8sClientTimeout
+
+	// maxHistory is the default number of revisions kept when updating Helm
+	// releases.
 	maxHistory = 10
 )
 
+// Describes the types of operations supported in batches.
+const (
+	// BatchOperationInstall installs a release using InstallReleaseFromTarball.
+	BatchOperationInstall = "install"
+	// BatchOperationUpgrade upgrades a release using UpdateReleaseFromTarball.
+	BatchOperationUpgrade = "upgrade"
+	// BatchOperationDelete uninstalls a release using DeleteRelease.
+	BatchOperationDelete = "delete"
+)
+
+// Describes the deletion propagation policies supported when uninstalling
+// releases.
+//
+// See: https://kubernetes.io/docs/concepts/architecture/garbage-collection/#cascading-deletion
+const (
+	// DeletionPropagationBackground deletes dependents in the background.
+	DeletionPropagationBackground = "background"
+	// DeletionPropagationForeground deletes dependents before their owners.
+	DeletionPropagationForeground = "foreground"
+	// DeletionPropagationOrphan keeps dependents.
+	DeletionPropagationOrphan = "orphan"
+)
+
+// Describes the types of events emitted when watching releases.
+const (
+	// ReleaseEventInstalled is emitted when the first revision of a release
+	// has been deployed.
+	ReleaseEventInstalled = "installed"
+	// ReleaseEventUpgraded is emitted when a new revision of a release has
+	// been deployed.
+	ReleaseEventUpgraded = "upgraded"
+	// ReleaseEventRolledBack is emitted when a release has been rolled back
+	// to a previous revision.
+	ReleaseEventRolledBack = "rolled-back"
+	// ReleaseEventUninstalled is emitted when a release has been uninstalled.
+	ReleaseEventUninstalled = "uninstalled"
+	// ReleaseEventFailed is emitted when an operation on a release failed.
+	ReleaseEventFailed = "failed"
+)
+
+// Describes the sort orders supported when listing releases.
+const (
+	// ListSortByName sorts releases by name.
+	ListSortByName = "name"
+	// ListSortByDate sorts releases by the time they were last deployed.
+	ListSortByDate = "date"
+)
+
+// Describes how an object changed between two revisions of a release.
+const (
+	// ObjectAdded indicates that the object only exists in the newer revision.
+	ObjectAdded = "added"
+	// ObjectRemoved indicates that the object only exists in the older
+	// revision.
+	ObjectRemoved = "removed"
+	// ObjectChanged indicates that the object exists in both revisions but
+	// differs.
+	ObjectChanged = "changed"
+)
+
+// Describes why revisions were pruned by PruneReleases.
+const (
+	// PruneReasonFailedInstall indicates that all revisions of the release
+	// failed and the last one is older than the cutoff.
+	PruneReasonFailedInstall = "failed-install"
+	// PruneReasonHistory indicates that the revision exceeded the history
+	// limit.
+	PruneReasonHistory = "history"
+	// PruneReasonOrphaned indicates that none of the objects managed by the
+	// release exist anymore.
+	PruneReasonOrphaned = "orphaned"
+	// PruneReasonUninstalled indicates that the release was uninstalled
+	// before the cutoff.
+	PruneReasonUninstalled = "uninstalled"
+)
+
+// Describes the strategies supported when recovering releases stuck in a
+// pending status.
+const (
+	// RecoverStrategyMarkFailed marks the pending revision as failed so that
+	// the next upgrade can proceed.
+	RecoverStrategyMarkFailed = "mark-failed"
+	// RecoverStrategyRollback marks the pending revision as failed and rolls
+	// back to the last deployed revision.
+	RecoverStrategyRollback = "rollback"
+)
+
 // Interface describes the methods provided by the Helm client.
 type Interface interface {
+	// ApplyCRDsFromTarball creates and upgrades the CRDs in the crds/
+	// directory of the given chart and returns the CRDs that changed.
+	ApplyCRDsFromTarball(ctx context.Context, chartPath string) ([]CRDChange, error)
+	// CompareRevisions returns the differences of values and rendered
+	// manifests between two revisions of a Helm Release.
+	CompareRevisions(ctx context.Context, namespace, releaseName string, fromRevision, toRevision int) (*RevisionDiff, error)
 	// DeleteRelease uninstalls a chart given its release name.
-	DeleteRelease(ctx context.Context, namespace, releaseName string, options DeleteOptions) error
+	DeleteRelease(ctx context.Context, namespace, releaseName string, options DeleteOptions) (*DeleteResult, error)
+	// ExportRelease returns a portable archive of all revisions of a Helm
+	// Release.
+	ExportRelease(ctx context.Context, namespace, releaseName string) ([]byte, error)
 	// GetReleaseContent gets the current status of the Helm Release. The
 	// releaseName is the name of the Helm Release that is set when the Chart
-	// is installed.
-	GetReleaseContent(ctx context.Context, namespace, releaseName string) (*ReleaseContent, error)
+	// is installed. The options control which additional parts of the release
+	// are included.
+	GetReleaseContent(ctx context.Context, namespace, releaseName string, options GetOptions) (*ReleaseContent, error)
 	// GetReleaseHistory gets the current installed version of the Helm Release.
 	// The releaseName is the name of the Helm Release that is set when the Helm
 	// Chart is installed.
 	GetReleaseHistory(ctx context.Context, namespace, releaseName string) ([]ReleaseHistory, error)
+	// GetReleaseRevision gets the given revision of the Helm Release.
+	GetReleaseRevision(ctx context.Context, namespace, releaseName string, revision int, options GetOptions) (*ReleaseContent, error)
+	// ImportRelease writes the revisions of a Helm Release archived by
+	// ExportRelease into the release storage.
+	ImportRelease(ctx context.Context, archive []byte, options ImportOptions) error
 	// InstallReleaseFromTarball installs a Helm Chart packaged in the given tarball.
 	InstallReleaseFromTarball(ctx context.Context, chartPath, namespace string, values map[string]interface{}, options InstallOptions) error
 	// ListReleaseContents gets the current status of all Helm Releases.
 	ListReleaseContents(ctx context.Context, namespace string) ([]*ReleaseContent, error)
+	// ListReleaseHistory lists the revisions of a Helm Release with support
+	// for filtering by revision range and status and pagination.
+	ListReleaseHistory(ctx context.Context, namespace, releaseName string, options HistoryOptions) ([]ReleaseHistory, error)
+	// ListReleases lists Helm Releases in one or all namespaces with support
+	// for filtering, sorting and pagination.
+	ListReleases(ctx context.Context, namespace string, options ListOptions) ([]*ReleaseContent, error)
 	// LoadChart loads a Helm Chart and returns its structure.
 	LoadChart(ctx context.Context, chartPath string) (Chart, error)
+	// MigrateRelease moves a Helm Release to another namespace and/or renames
+	// it while keeping its revision history.
+	MigrateRelease(ctx context.Context, namespace, releaseName string, options MigrateOptions) error
+	// PlanAdoption reports which objects of the given chart already exist in
+	// the cluster and would be adopted with InstallOptions.Adopt.
+	PlanAdoption(ctx context.Context, chartPath, namespace string, values map[string]interface{}, options InstallOptions) (*AdoptionReport, error)
+	// PruneReleases deletes release storage objects of uninstalled, failed
+	// and orphaned releases and trims release history.
+	PruneReleases(ctx context.Context, namespace string, options PruneOptions) (*PruneResult, error)
 	// PullChartTarball downloads a tarball from the provided tarball URL,
 	// returning the file path.
 	PullChartTarball(ctx context.Context, tarballURL string) (string, error)
+	// RecoverStuckRelease recovers a Helm Release whose latest revision is
+	// stuck in a pending status, e.g. because the process running the
+	// operation was killed.
+	RecoverStuckRelease(ctx context.Context, namespace, releaseName string, options RecoverOptions) error
 	// Rollback executes a rollback to a previous revision of a Helm release.
 	Rollback(ctx context.Context, namespace, releaseName string, revision int, options RollbackOptions) error
+	// RunBatch executes install, upgrade and delete operations for many
+	// releases concurrently, respecting dependencies between them.
+	RunBatch(ctx context.Context, operations []BatchOperation, options BatchOptions) (map[string]BatchResult, error)
 	// RunReleaseTest runs the tests for a Helm Release. This is the same
 	// action as running the helm test command.
-	RunReleaseTest(ctx context.Context, namespace, releaseName string) error
+	RunReleaseTest(ctx context.Context, namespace, releaseName string, options ReleaseTestOptions) (*ReleaseTestResult, error)
 	// UpdateReleaseFromTarball updates the given release using the chart packaged
 	// in the tarball.
 	UpdateReleaseFromTarball(ctx context.Context, chartPath, namespace, releaseName string, values map[string]interface{}, options UpdateOptions) error
+	// WatchReleases emits events whenever a Helm Release in the given
+	// namespace is installed, upgraded, rolled back, uninstalled or failed.
+	// The returned channel is closed once the context is done.
+	WatchReleases(ctx context.Context, namespace string) (<-chan ReleaseEvent, error)
 }
 
 // RESTClientGetter is used to configure the action package which is the Helm
@@ -104,19 +245,236 @@ type RESTClientGetter interface {
 	ToRESTMapper() (meta.RESTMapper, error)
 }
 
+// BatchOperation describes a single operation executed by RunBatch.
+type BatchOperation struct {
+	// Type is one of BatchOperationInstall, BatchOperationUpgrade or
+	// BatchOperationDelete.
+	Type        string
+	Namespace   string
+	ReleaseName string
+	// ChartPath is the path of the chart tarball for installs and upgrades.
+	ChartPath string
+	Values    map[string]interface{}
+	// DependsOn lists the keys of operations in the same batch that must
+	// succeed before this operation is started. Keys have the format
+	// namespace/releaseName.
+	DependsOn []string
+
+	DeleteOptions DeleteOptions
+	// InstallOptions are the options of installs. InstallOptions.ReleaseName
+	// defaults to ReleaseName and must match it when set.
+	InstallOptions InstallOptions
+	UpdateOptions  UpdateOptions
+}
+
+// BatchOptions is the subset of supported options when running batches.
+type BatchOptions struct {
+	// Workers is the maximum number of operations executed concurrently.
+	// Defaults to 4.
+	Workers int
+}
+
+// GetOptions is the subset of supported options when getting the content of
+// Helm releases.
+type GetOptions struct {
+	// IncludeComputedValues includes the chart default values and the values
+	// computed by merging them with the values provided by the user.
+	IncludeComputedValues bool
+	// IncludeHooks includes the hooks of the release with their last run
+	// status.
+	IncludeHooks bool
+	// IncludeManifest includes the rendered manifest, both raw and parsed
+	// into unstructured objects.
+	IncludeManifest bool
+	// IncludeNotes includes the rendered notes of the chart.
+	IncludeNotes bool
+}
+
+// HistoryOptions is the subset of supported options when listing the
+// history of Helm releases.
+type HistoryOptions struct {
+	// FromRevision is the lowest revision returned. Zero means no lower
+	// bound.
+	FromRevision int
+	// Limit is the maximum number of revisions returned. Zero means no
+	// limit.
+	Limit int
+	// Offset is the number of revisions skipped before returning results.
+	Offset int
+	// SortReverse returns the most recent revisions first.
+	SortReverse bool
+	// Statuses only returns revisions in the given statuses, e.g.
+	// StatusFailed. If empty, revisions in any status are returned.
+	Statuses []string
+	// ToRevision is the highest revision returned. Zero means no upper
+	// bound.
+	ToRevision int
+}
+
+// ImportOptions is the subset of supported options when importing Helm
+// releases.
+type ImportOptions struct {
+	// Namespace is the storage namespace the release is imported into.
+	// Defaults to the namespace the release was exported from. Namespaced
+	// objects rendered without an explicit namespace are expected in this
+	// namespace.
+	Namespace string
+	// NamespaceMapping replaces the explicit namespaces of objects in the
+	// stored manifests and hook manifests, e.g. {"old": "new"}, so that they
+	// match the objects in the target cluster.
+	NamespaceMapping map[string]string
+}
+
 // InstallOptions is the subset of supported options when installing Helm
 // releases.
 type InstallOptions struct {
-	Namespace   string
+	// Adopt takes over objects of the chart which already exist in the
+	// cluster by adding Helm's ownership annotations and label. Objects
+	// owned by another release are never adopted and fail the install with
+	// an adoptionConflictError. Use PlanAdoption for a dry run.
+	Adopt bool
+	// DisableHooks prevents hooks from running during the install.
+	DisableHooks bool
+	// EventObject is the object Kubernetes Events about the install are
+	// recorded against, e.g. an App CR. Only used if Config.EventRecorder is
+	// set.
+	EventObject runtime.Object
+	// FieldManager is the field manager used with ServerSideApply. Defaults
+	// to helmclient.
+	FieldManager string
+	// ForceConflicts takes ownership of fields owned by other field managers
+	// when using ServerSideApply. Otherwise conflicts fail the operation
+	// with an ApplyConflictError.
+	ForceConflicts bool
+	// ManageCRDs creates and upgrades the CRDs in the crds/ directory of the
+	// chart like ApplyCRDsFromTarball before installing the release. The
+	// changed CRDs are reported as a ProgressPhaseCRDsApplied update. Takes
+	// precedence over SkipCRDs.
+	ManageCRDs bool
+	Namespace  string
+	// Progress receives updates about the phases of the install and the
+	// readiness of the resources while waiting.
+	Progress    ProgressFunc
 	ReleaseName string
-	Timeout     time.Duration
-	Wait        bool
+	// ServerSideApply creates the resources of the release using
+	// Kubernetes server-side apply.
+	ServerSideApply bool
+	// Timeout is the time to wait for any individual Kubernetes operation
+	// like hooks and waiting for resources to become ready.
+	Timeout time.Duration
+	// Wait waits until all resources of the release are ready. This
+	// includes objects with a readiness checker registered in
+	// Config.ReadinessCheckers.
+	Wait bool
+	// WaitForJobs waits until all Jobs of the release completed. Only
+	// relevant with Wait.
+	WaitForJobs bool
 	SkipCRDs    bool
 }
 
+// ListOptions is the subset of supported options when listing Helm releases.
+type ListOptions struct {
+	// AllNamespaces lists releases in all namespaces. The namespace passed
+	// to ListReleases is ignored.
+	AllNamespaces bool
+	// ChartName only lists releases of the chart with the given name.
+	ChartName string
+	// Limit is the maximum number of releases returned. Zero means no limit.
+	Limit int
+	// NameFilter is a regular expression release names must match.
+	NameFilter string
+	// Offset is the number of releases skipped before returning results.
+	Offset int
+	// SortBy is one of ListSortByName or ListSortByDate. Defaults to
+	// ListSortByName.
+	SortBy      string
+	SortReverse bool
+	// Statuses only lists releases in the given statuses, e.g. StatusFailed.
+	// If empty, releases in any status are listed. Only the latest revision
+	// of every release is listed, except for StatusSuperseded which lists
+	// all superseded revisions. StatusSuperseded must therefore not be
+	// combined with other statuses.
+	Statuses []string
+}
+
+// MigrateOptions is the subset of supported options when migrating Helm
+// releases.
+type MigrateOptions struct {
+	// Namespace is the storage namespace the release is moved to. Defaults
+	// to the current namespace of the release.
+	Namespace string
+	// ReleaseName is the new name of the release. Defaults to the current
+	// name of the release.
+	ReleaseName string
+}
+
+// PruneOptions is the subset of supported options when pruning Helm release
+// storage. Every kind of pruning is disabled by default.
+type PruneOptions struct {
+	// AllNamespaces prunes releases in all namespaces. The namespace passed
+	// to PruneReleases is ignored.
+	AllNamespaces bool
+	// DryRun only reports the revisions which would be pruned.
+	DryRun bool
+	// MaxHistory is the number of revisions kept per release. Older
+	// revisions are pruned except the last deployed one. Zero disables
+	// trimming history.
+	MaxHistory int
+	// OlderThan prunes all revisions of releases uninstalled with
+	// KeepHistory, or whose revisions all failed, longer than this ago. Zero
+	// disables pruning these releases.
+	OlderThan time.Duration
+	// Orphaned prunes all revisions of releases none of whose managed
+	// objects exist anymore.
+	Orphaned bool
+}
+
+// RecoverOptions is the subset of supported options when recovering stuck
+// Helm releases.
+type RecoverOptions struct {
+	// StaleAfter is the time since the pending revision was last deployed
+	// after which it is considered to be stuck. Recovering releases that
+	// are not stale yet is refused to avoid racing a live operation.
+	StaleAfter time.Duration
+	// Strategy is one of RecoverStrategyMarkFailed or
+	// RecoverStrategyRollback. Defaults to RecoverStrategyMarkFailed.
+	Strategy string
+	Timeout  time.Duration
+	Wait     bool
+}
+
+// ReleaseTestOptions is the subset of supported options when testing Helm
+// releases.
+type ReleaseTestOptions struct {
+	// CleanupOnSuccess deletes the test pods once all tests succeeded.
+	CleanupOnSuccess bool
+	// EventObject is the object Kubernetes Events about the tests are
+	// recorded against, e.g. an App CR. Only used if Config.EventRecorder is
+	// set.
+	EventObject runtime.Object
+	// Filter only runs the tests with the given names. If empty, all tests
+	// are run.
+	Filter  []string
+	Timeout time.Duration
+}
+
 // RollbackOptions is the subset of supported options when rollback back Helm releases.
 type RollbackOptions struct {
-	Force   bool
+	// DisableHooks prevents hooks from running during the rollback.
+	DisableHooks bool
+	// EventObject is the object Kubernetes Events about the rollback are
+	// recorded against, e.g. an App CR. Only used if Config.EventRecorder is
+	// set.
+	EventObject runtime.Object
+	Force       bool
+	// MaxHistory is the maximum number of revisions kept for the release.
+	// Defaults to Config.MaxHistory. A negative value keeps all revisions.
+	MaxHistory int
+	// Progress receives updates about the phases of the rollback and the
+	// readiness of the resources while waiting.
+	Progress ProgressFunc
+	// Timeout is the time to wait for any individual Kubernetes operation
+	// like hooks and waiting for resources to become ready.
 	Timeout time.Duration
 	Version int
 	Wait    bool
@@ -124,13 +482,73 @@ type RollbackOptions struct {
 
 // UpdateOptions is the subset of supported options when updating Helm releases.
 type UpdateOptions struct {
+	// DisableHooks prevents hooks from running during the upgrade.
 	DisableHooks bool
-	Force        bool
-	Timeout      time.Duration
-	Wait         bool
+	// EventObject is the object Kubernetes Events about the upgrade are
+	// recorded against, e.g. an App CR. Only used if Config.EventRecorder is
+	// set.
+	EventObject runtime.Object
+	// FieldManager is the field manager used with ServerSideApply. Defaults
+	// to helmclient.
+	FieldManager string
+	// ForceConflicts takes ownership of fields owned by other field managers
+	// when using ServerSideApply. Otherwise conflicts fail the operation
+	// with an ApplyConflictError.
+	ForceConflicts bool
+	// Force replaces resources which cannot be patched. It must not be used
+	// with ServerSideApply, use ForceConflicts instead.
+	Force bool
+	// ManageCRDs creates and upgrades the CRDs in the crds/ directory of the
+	// chart like ApplyCRDsFromTarball before upgrading the release. The
+	// changed CRDs are reported as a ProgressPhaseCRDsApplied update.
+	ManageCRDs bool
+	// MaxHistory is the maximum number of revisions kept for the release.
+	// Defaults to Config.MaxHistory. A negative value keeps all revisions.
+	MaxHistory int
+	// Progress receives updates about the phases of the upgrade and the
+	// readiness of the resources while waiting.
+	Progress ProgressFunc
+	// ServerSideApply updates the resources of the release using
+	// Kubernetes server-side apply instead of a three-way merge patch.
+	ServerSideApply bool
+	// Timeout is the time to wait for any individual Kubernetes operation
+	// like hooks and waiting for resources to become ready.
+	Timeout time.Duration
+	// Wait waits until all resources of the release are ready. This
+	// includes objects with a readiness checker registered in
+	// Config.ReadinessCheckers.
+	Wait bool
+	// WaitForJobs waits until all Jobs of the release completed. Only
+	// relevant with Wait.
+	WaitForJobs bool
 }
 
-// DeleteOptions is the subset of supported options when updating Helm releases.
+// DeleteOptions is the subset of supported options when uninstalling Helm
+// releases.
 type DeleteOptions struct {
+	// DeletionPropagation is one of DeletionPropagationBackground,
+	// DeletionPropagationForeground or DeletionPropagationOrphan. Defaults
+	// to DeletionPropagationBackground.
+	DeletionPropagation string
+	// Description is set on the uninstalled revision. Only relevant with
+	// KeepHistory.
+	Description string
+	// DisableHooks prevents hooks from running during the uninstall.
+	DisableHooks bool
+	// EventObject is the object Kubernetes Events about the delete are
+	// recorded against, e.g. an App CR. Only used if Config.EventRecorder is
+	// set.
+	EventObject runtime.Object
+	// KeepCRDs keeps CRDs rendered from the chart templates in place. They
+	// are listed in DeleteResult.KeptObjects. CRDs of the crds/ directory are
+	// never deleted.
+	KeepCRDs bool
+	// KeepHistory keeps the release history after uninstalling so that it
+	// can be audited or rolled back.
+	KeepHistory bool
+	// Timeout is the time to wait for any individual Kubernetes operation
+	// like hooks and waiting for resources to be deleted.
 	Timeout time.Duration
+	// Wait waits until all resources of the release are deleted.
+	Wait bool
 }
@@ -0,0 +1,245 @@
+package helmclient
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/giantswarm/backoff"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/release"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// tracerName is the instrumentation scope of the spans created by the
+	// client.
+	tracerName = "github.com/giantswarm/helmclient/v4/pkg/helmclient"
+)
+
+// Attributes set on spans.
+const (
+	attributeAttempt          = "helmclient.attempt"
+	attributeChartPath        = "helmclient.chart.path"
+	attributeChartURL         = "helmclient.chart.url"
+	attributeReleaseName      = "helmclient.release.name"
+	attributeReleaseNamespace = "helmclient.release.namespace"
+	attributeResources        = "helmclient.resources"
+)
+
+// Names of the child spans created within the span of a public method.
+const (
+	spanBuildResources  = "build_resources"
+	spanCreateHook      = "create_hook"
+	spanCreateResources = "create_resources"
+	spanDeleteResources = "delete_resources"
+	spanLoadChart       = "load_chart"
+	spanLockRelease     = "lock_release"
+	spanPullAttempt     = "pull_attempt"
+	spanRender          = "render"
+	spanUpdateResources = "update_resources"
+	spanWaitForDelete   = "wait_for_delete"
+	spanWaitForHook     = "wait_for_hook"
+	spanWaitForReady    = "wait_for_readiness"
+	spanWaitResources   = "wait_resources"
+)
+
+// recordSpanError marks the span as failed with the given error.
+func recordSpanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// tracedRetry returns a backoff operation running o in its own span for every
+// attempt so that retries are visible in traces.
+func (c *Client) tracedRetry(ctx context.Context, name string, o func(ctx context.Context) error) backoff.Operation {
+	var attempt int
+
+	return func() error {
+		attempt++
+
+		ctx, span := c.tracer.Start(ctx, name, trace.WithAttributes(attribute.Int(attributeAttempt, attempt)))
+		defer span.End()
+
+		err := o(ctx)
+		if err != nil {
+			recordSpanError(span, err)
+			return err
+		}
+
+		return nil
+	}
+}
+
+// tracingKubeClient is a Helm kube client creating a span for every operation
+// Helm executes against the cluster.
+type tracingKubeClient struct {
+	kubeClient
+
+	ctx    context.Context
+	tracer trace.Tracer
+
+	mutex       sync.Mutex
+	renderStart time.Time
+}
+
+func newTracingKubeClient(ctx context.Context, tracer trace.Tracer, client kubeClient) *tracingKubeClient {
+	return &tracingKubeClient{
+		kubeClient: client,
+
+		ctx:    ctx,
+		tracer: tracer,
+	}
+}
+
+// startRender records the start of rendering a chart. Helm renders charts
+// internally so the render span ends when Helm builds the rendered
+// resources for the first time.
+func (c *tracingKubeClient) startRender() {
+	c.mutex.Lock()
+	c.renderStart = time.Now()
+	c.mutex.Unlock()
+}
+
+func (c *tracingKubeClient) start(name string, resources kube.ResourceList) trace.Span {
+	_, span := c.tracer.Start(c.ctx, name, trace.WithAttributes(attribute.Int(attributeResources, len(resources))))
+	return span
+}
+
+func (c *tracingKubeClient) end(span trace.Span, err error) {
+	if err != nil {
+		recordSpanError(span, err)
+	}
+	span.End()
+}
+
+func (c *tracingKubeClient) endAll(span trace.Span, errs []error) {
+	for _, err := range errs {
+		recordSpanError(span, err)
+	}
+	span.End()
+}
+
+func (c *tracingKubeClient) Build(reader io.Reader, validate bool) (kube.ResourceList, error) {
+	c.mutex.Lock()
+	if !c.renderStart.IsZero() {
+		_, span := c.tracer.Start(c.ctx, spanRender, trace.WithTimestamp(c.renderStart))
+		span.End()
+		c.renderStart = time.Time{}
+	}
+	c.mutex.Unlock()
+
+	span := c.start(spanBuildResources, nil)
+	resources, err := c.kubeClient.Build(reader, validate)
+	span.SetAttributes(attribute.Int(attributeResources, len(resources)))
+	c.end(span, err)
+
+	return resources, err
+}
+
+func (c *tracingKubeClient) Create(resources kube.ResourceList) (*kube.Result, error) {
+	name := spanCreateResources
+	if isHook(resources) {
+		name = spanCreateHook
+	}
+
+	span := c.start(name, resources)
+	result, err := c.kubeClient.Create(resources)
+	c.end(span, err)
+
+	return result, err
+}
+
+func (c *tracingKubeClient) Update(original, target kube.ResourceList, force bool) (*kube.Result, error) {
+	span := c.start(spanUpdateResources, target)
+	result, err := c.kubeClient.Update(original, target, force)
+	c.end(span, err)
+
+	return result, err
+}
+
+func (c *tracingKubeClient) UpdateThreeWayMerge(original, target kube.ResourceList, force bool) (*kube.Result, error) {
+	span := c.start(spanUpdateResources, target)
+	result, err := c.kubeClient.UpdateThreeWayMerge(original, target, force)
+	c.end(span, err)
+
+	return result, err
+}
+
+func (c *tracingKubeClient) Delete(resources kube.ResourceList) (*kube.Result, []error) {
+	span := c.start(spanDeleteResources, resources)
+	result, errs := c.kubeClient.Delete(resources)
+	c.endAll(span, errs)
+
+	return result, errs
+}
+
+func (c *tracingKubeClient) DeleteWithPropagationPolicy(resources kube.ResourceList, policy metav1.DeletionPropagation) (*kube.Result, []error) {
+	span := c.start(spanDeleteResources, resources)
+	result, errs := c.kubeClient.DeleteWithPropagationPolicy(resources, policy)
+	c.endAll(span, errs)
+
+	return result, errs
+}
+
+func (c *tracingKubeClient) Wait(resources kube.ResourceList, timeout time.Duration) error {
+	span := c.start(spanWaitResources, resources)
+	err := c.kubeClient.Wait(resources, timeout)
+	c.end(span, err)
+
+	return err
+}
+
+func (c *tracingKubeClient) WaitWithJobs(resources kube.ResourceList, timeout time.Duration) error {
+	span := c.start(spanWaitResources, resources)
+	err := c.kubeClient.WaitWithJobs(resources, timeout)
+	c.end(span, err)
+
+	return err
+}
+
+func (c *tracingKubeClient) WaitForDelete(resources kube.ResourceList, timeout time.Duration) error {
+	span := c.start(spanWaitForDelete, resources)
+	err := c.kubeClient.WaitForDelete(resources, timeout)
+	c.end(span, err)
+
+	return err
+}
+
+func (c *tracingKubeClient) WatchUntilReady(resources kube.ResourceList, timeout time.Duration) error {
+	span := c.start(spanWaitForHook, resources)
+	err := c.kubeClient.WatchUntilReady(resources, timeout)
+	c.end(span, err)
+
+	return err
+}
+
+func (c *tracingKubeClient) WaitAndGetCompletedPodPhase(name string, timeout time.Duration) (corev1.PodPhase, error) {
+	_, span := c.tracer.Start(c.ctx, spanWaitForHook)
+	phase, err := c.kubeClient.WaitAndGetCompletedPodPhase(name, timeout)
+	c.end(span, err)
+
+	return phase, err
+}
+
+// isHook returns true if the given resources are Helm hooks. Helm creates
+// hooks one at a time.
+func isHook(resources kube.ResourceList) bool {
+	for _, info := range resources {
+		accessor, err := apimeta.Accessor(info.Object)
+		if err != nil {
+			continue
+		}
+		if _, ok := accessor.GetAnnotations()[release.HookAnnotation]; ok {
+			return true
+		}
+	}
+
+	return false
+}
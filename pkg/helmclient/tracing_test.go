@@ -0,0 +1,238 @@
+package helmclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/backoff"
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	helmtime "helm.sh/helm/v3/pkg/time"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_Client_PruneReleases_spans(t *testing.T) {
+	testCases := []struct {
+		name          string
+		options       PruneOptions
+		expectedSpans []string
+		expectedError bool
+	}{
+		{
+			name:          "case 0: release lock is traced within the operation",
+			options:       PruneOptions{OlderThan: time.Hour},
+			expectedSpans: []string{spanLockRelease, "prune_releases"},
+		},
+		{
+			name:          "case 1: failed operation is recorded",
+			options:       PruneOptions{MaxHistory: -1},
+			expectedSpans: []string{"prune_releases"},
+			expectedError: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			recorder := tracetest.NewSpanRecorder()
+			tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+			k8sClient := fake.NewSimpleClientset()
+
+			rel := &release.Release{
+				Name:      "foo",
+				Namespace: "default",
+				Version:   1,
+				Info: &release.Info{
+					LastDeployed: helmtime.Time{Time: time.Now().Add(-2 * time.Hour)},
+					Status:       release.StatusFailed,
+				},
+			}
+			err := storage.Init(driver.NewSecrets(k8sClient.CoreV1().Secrets("default"))).Create(rel)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			metrics, err := newMetrics(metricsConfig{Registerer: prometheus.NewRegistry()})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c := &Client{
+				k8sClient:     k8sClient,
+				logger:        microloggertest.New(),
+				metrics:       metrics,
+				releaseLocker: newReleaseLocker(),
+				tracer:        tracerProvider.Tracer(tracerName),
+			}
+
+			_, err = c.PruneReleases(context.Background(), "default", tc.options)
+			if err != nil && !tc.expectedError {
+				t.Fatalf("error == %#v, want nil", err)
+			} else if err == nil && tc.expectedError {
+				t.Fatalf("error == nil, want non-nil")
+			}
+
+			spans := recorder.Ended()
+			if len(spans) != len(tc.expectedSpans) {
+				t.Fatalf("expected %d spans got %d", len(tc.expectedSpans), len(spans))
+			}
+			for i, span := range spans {
+				if span.Name() != tc.expectedSpans[i] {
+					t.Fatalf("expected span %#q got %#q", tc.expectedSpans[i], span.Name())
+				}
+			}
+
+			root := spans[len(spans)-1]
+			if root.Parent().IsValid() {
+				t.Fatalf("expected %#q to be a root span", root.Name())
+			}
+			if !hasAttribute(root, attribute.String(attributeReleaseNamespace, "default")) {
+				t.Fatalf("expected namespace attribute got %v", root.Attributes())
+			}
+			for _, span := range spans[:len(spans)-1] {
+				if span.Parent().SpanID() != root.SpanContext().SpanID() {
+					t.Fatalf("expected %#q to be a child of %#q", span.Name(), root.Name())
+				}
+			}
+
+			expectedCode := codes.Unset
+			if tc.expectedError {
+				expectedCode = codes.Error
+			}
+			if root.Status().Code != expectedCode {
+				t.Fatalf("expected status %s got %s", expectedCode, root.Status().Code)
+			}
+		})
+	}
+}
+
+func Test_Client_tracedRetry(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	c := &Client{
+		tracer: tracerProvider.Tracer(tracerName),
+	}
+
+	ctx, parent := c.tracer.Start(context.Background(), "pull_chart_tarball")
+
+	var calls int
+	o := func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	err := backoff.Retry(c.tracedRetry(ctx, spanPullAttempt, o), backoff.NewMaxRetries(3, time.Millisecond))
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	parent.End()
+
+	var attempts []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == spanPullAttempt {
+			attempts = append(attempts, span)
+		}
+	}
+	if len(attempts) != 3 {
+		t.Fatalf("expected 3 attempt spans got %d", len(attempts))
+	}
+
+	for i, span := range attempts {
+		if !hasAttribute(span, attribute.Int(attributeAttempt, i+1)) {
+			t.Fatalf("expected attempt %d got %v", i+1, span.Attributes())
+		}
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Fatalf("expected attempt %d to be a child of the operation span", i+1)
+		}
+
+		expectedCode := codes.Error
+		if i == len(attempts)-1 {
+			expectedCode = codes.Unset
+		}
+		if span.Status().Code != expectedCode {
+			t.Fatalf("expected status %s of attempt %d got %s", expectedCode, i+1, span.Status().Code)
+		}
+	}
+}
+
+func Test_kubeClients_startRender(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := tracerProvider.Tracer(tracerName)
+
+	ctx, parent := tracer.Start(context.Background(), "install_release_from_tarball")
+
+	var progress []Progress
+	reporter := newProgressReporter(func(p Progress) {
+		progress = append(progress, p)
+	})
+
+	k := &kubeClients{}
+	k.progress = newProgressKubeClient(ctx, &kubefake.FailingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}}, nil, reporter, nil)
+	k.tracing = newTracingKubeClient(ctx, tracer, k.progress)
+
+	start := time.Now()
+	k.startRender()
+
+	// Helm builds the release manifest and then the manifests of the hooks.
+	// Only the first build ends rendering.
+	for i := 0; i < 2; i++ {
+		_, err := k.tracing.Build(bytes.NewBufferString(""), false)
+		if err != nil {
+			t.Fatalf("error == %#v, want nil", err)
+		}
+	}
+	parent.End()
+
+	expectedSpans := []string{spanRender, spanBuildResources, spanBuildResources, "install_release_from_tarball"}
+	spans := recorder.Ended()
+	if len(spans) != len(expectedSpans) {
+		t.Fatalf("expected %d spans got %d", len(expectedSpans), len(spans))
+	}
+	for i, span := range spans {
+		if span.Name() != expectedSpans[i] {
+			t.Fatalf("expected span %#q got %#q", expectedSpans[i], span.Name())
+		}
+		if i < len(spans)-1 && span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Fatalf("expected %#q to be a child of the operation span", span.Name())
+		}
+	}
+
+	render := spans[0]
+	if render.StartTime().Before(start) || render.StartTime().After(spans[1].StartTime()) {
+		t.Fatalf("expected render span to start when rendering started got %s", render.StartTime())
+	}
+
+	if len(progress) != 1 || progress[0].Phase != ProgressPhaseRendered {
+		t.Fatalf("expected a single %#q progress update got %v", ProgressPhaseRendered, progress)
+	}
+}
+
+func hasAttribute(span sdktrace.ReadOnlySpan, expected attribute.KeyValue) bool {
+	for _, a := range span.Attributes() {
+		if a == expected {
+			return true
+		}
+	}
+
+	return false
+}
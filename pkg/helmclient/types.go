@@ -1,6 +1,50 @@
 package helmclient
 
-import "time"
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// AdoptionConflict describes an object which cannot be adopted because it is
+// owned by another Helm Release.
+type AdoptionConflict struct {
+	// Object is the conflicting object.
+	Object ObjectReference
+	// ReleaseName is the name of the Helm Release owning the object.
+	ReleaseName string
+	// ReleaseNamespace is the namespace of the Helm Release owning the
+	// object.
+	ReleaseNamespace string
+}
+
+// AdoptionReport returns the existing objects of a chart found by
+// PlanAdoption.
+type AdoptionReport struct {
+	// Adopted are the existing objects which would be adopted.
+	Adopted []ObjectReference
+	// Conflicts are the existing objects owned by another Helm Release.
+	Conflicts []AdoptionConflict
+}
+
+// BatchResult returns the outcome of a single operation executed by RunBatch.
+type BatchResult struct {
+	// Duration is the time it took to execute the operation.
+	Duration time.Duration
+	// Error is the error returned by the operation, or nil if it succeeded.
+	Error error
+	// Skipped is true when the operation was not executed because one of its
+	// dependencies failed.
+	Skipped bool
+}
+
+// CRDChange describes a CRD created or upgraded by ApplyCRDsFromTarball.
+type CRDChange struct {
+	// Change is one of ObjectAdded or ObjectChanged.
+	Change string
+	// Name is the name of the CRD.
+	Name string
+}
 
 // Chart returns information about a Helm Chart.
 type Chart struct {
@@ -11,16 +55,105 @@ type Chart struct {
 	Version string
 }
 
+// DeleteResult returns the outcome of uninstalling a Helm Release.
+type DeleteResult struct {
+	// KeptObjects are the objects that were not deleted due to the
+	// helm.sh/resource-policy: keep annotation.
+	KeptObjects []ObjectReference
+}
+
+// ObjectDiff describes how an object of the rendered manifest changed between
+// two revisions of a Helm Release.
+type ObjectDiff struct {
+	// APIVersion is the API version of the object.
+	APIVersion string
+	// Change is one of ObjectAdded, ObjectRemoved or ObjectChanged.
+	Change string
+	// Diff is a unified diff of the object rendered as YAML. It is empty if
+	// the objects are equal.
+	Diff string
+	// Kind is the Kubernetes kind of the object.
+	Kind string
+	// Name is the name of the object.
+	Name string
+	// Namespace is the namespace of the object as set in the manifest.
+	Namespace string
+}
+
+// ObjectReference identifies a Kubernetes object.
+type ObjectReference struct {
+	APIVersion string
+	Kind       string
+	Name       string
+	Namespace  string
+}
+
+// Progress is an update about the progress of a long-running operation passed
+// to a ProgressFunc.
+type Progress struct {
+	// CRDs are the CRDs created or upgraded of a ProgressPhaseCRDsApplied
+	// update.
+	CRDs []CRDChange
+	// Object is the hook of a ProgressPhasePreHooks or
+	// ProgressPhasePostHooks update or the resource of a
+	// ProgressPhaseResourceReady update.
+	Object *ObjectReference
+	// Phase is one of the ProgressPhase constants.
+	Phase string
+	// Resources is the number of resources of a
+	// ProgressPhaseResourcesApplied or ProgressPhaseWaiting update.
+	Resources int
+}
+
+// PrunedRevision describes a revision of a Helm Release pruned by
+// PruneReleases.
+type PrunedRevision struct {
+	Namespace string
+	// Reason is one of PruneReasonFailedInstall, PruneReasonHistory,
+	// PruneReasonOrphaned or PruneReasonUninstalled.
+	Reason      string
+	ReleaseName string
+	Revision    int
+}
+
+// PruneResult returns the outcome of pruning Helm release storage.
+type PruneResult struct {
+	// Pruned are the deleted revisions, or with PruneOptions.DryRun the
+	// revisions which would be deleted.
+	Pruned []PrunedRevision
+}
+
 // ReleaseContent returns status information about a Helm Release.
 type ReleaseContent struct {
 	// AppVersion is the app version of the Helm Chart that has been deployed.
 	AppVersion string
+	// ChartValues are the default values of the Helm Chart. Only set when
+	// requested using GetOptions.IncludeComputedValues.
+	ChartValues map[string]interface{}
+	// ComputedValues are the chart default values merged with the values
+	// provided when installing the Helm Release. Only set when requested
+	// using GetOptions.IncludeComputedValues.
+	ComputedValues map[string]interface{}
 	// Description is a human-friendly "log entry" about this Helm release.
 	Description string
+	// Hooks are the hooks of the Helm Release. Only set when requested using
+	// GetOptions.IncludeHooks.
+	Hooks []ReleaseHook
 	// LastDeployed is the time the Helm Chart was last deployed.
 	LastDeployed time.Time
+	// Manifest is the rendered manifest of the Helm Release. Only set when
+	// requested using GetOptions.IncludeManifest.
+	Manifest string
 	// Name is the name of the Helm Release.
 	Name string
+	// Namespace is the namespace the Helm Release is stored in.
+	Namespace string
+	// Notes are the rendered notes of the Helm Chart. Only set when requested
+	// using GetOptions.IncludeNotes.
+	Notes string
+	// Objects are the objects of the rendered manifest. Only set when
+	// requested using GetOptions.IncludeManifest.
+	Objects []*unstructured.Unstructured
 	// Revision is the revision number of the Helm Release.
 	Revision int
 	// Status is the Helm status code of the Release.
@@ -31,6 +164,76 @@ type ReleaseContent struct {
 	Version string
 }
 
+// ReleaseTest returns the outcome of a single test of a Helm Release.
+type ReleaseTest struct {
+	// CompletedAt is the time the test completed.
+	CompletedAt time.Time
+	// Kind is the Kubernetes kind of the test hook, usually Pod.
+	Kind string
+	// Logs are the logs of the test pod. They are truncated to 64KiB.
+	Logs string
+	// Name is the name of the test hook.
+	Name string
+	// Phase is the phase of the test, e.g. Succeeded or Failed.
+	Phase string
+	// StartedAt is the time the test was started.
+	StartedAt time.Time
+}
+
+// ReleaseTestResult returns the outcome of running the tests of a Helm
+// Release.
+type ReleaseTestResult struct {
+	// Tests are the executed tests.
+	Tests []ReleaseTest
+}
+
+// RevisionDiff returns the differences between two revisions of a Helm
+// Release.
+type RevisionDiff struct {
+	// FromRevision is the revision compared from.
+	FromRevision int
+	// Objects are the objects of the rendered manifest that were added,
+	// removed or changed.
+	Objects []ObjectDiff
+	// ToRevision is the revision compared to.
+	ToRevision int
+	// ValuesDiff is a unified diff of the values provided by the user
+	// rendered as YAML. It is empty if the values are equal.
+	ValuesDiff string
+}
+
+// ReleaseEvent describes a change of a Helm Release observed by
+// WatchReleases.
+type ReleaseEvent struct {
+	// Namespace is the namespace the Helm Release is stored in.
+	Namespace string
+	// Release is the content of the revision that caused the event.
+	Release *ReleaseContent
+	// Type is one of ReleaseEventInstalled, ReleaseEventUpgraded,
+	// ReleaseEventRolledBack, ReleaseEventUninstalled or ReleaseEventFailed.
+	Type string
+}
+
+// ReleaseHook returns information about a hook of a Helm Release.
+type ReleaseHook struct {
+	// CompletedAt is the time the hook last completed.
+	CompletedAt time.Time
+	// Events are the events the hook fires on, e.g. pre-install.
+	Events []string
+	// Kind is the Kubernetes kind of the hook.
+	Kind string
+	// Name is the name of the hook.
+	Name string
+	// Path is the chart relative path of the hook template.
+	Path string
+	// Phase is the phase of the last run, e.g. Succeeded or Failed.
+	Phase string
+	// StartedAt is the time the hook was last started.
+	StartedAt time.Time
+	// Weight is the sort order of the hook among hooks of the same event.
+	Weight int
+}
+
 // ReleaseHistory returns version information about a Helm Release.
 type ReleaseHistory struct {
 	// AppVersion is the app version of the Helm Chart that has been deployed.
@@ -5,9 +5,9 @@ import (
 	"time"
 
 	"github.com/giantswarm/microerror"
-	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"helm.sh/helm/v3/pkg/action"
-	"helm.sh/helm/v3/pkg/chart/loader"
 )
 
 // UpdateReleaseFromTarball updates the given release using the chart packaged
@@ -15,23 +15,53 @@ import (
 func (c *Client) UpdateReleaseFromTarball(ctx context.Context, chartPath, namespace, releaseName string, values map[string]interface{}, options UpdateOptions) error {
 	eventName := "update_release_from_tarball"
 
-	t := prometheus.NewTimer(histogram.WithLabelValues(eventName))
-	defer func() {
-		eventCounter.WithLabelValues(eventName, releaseName).Inc()
-		t.ObserveDuration()
-	}()
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeChartPath, chartPath),
+		attribute.String(attributeReleaseNamespace, namespace),
+		attribute.String(attributeReleaseName, releaseName),
+	))
+	defer span.End()
 
-	err := c.updateReleaseFromTarball(ctx, chartPath, namespace, releaseName, values, options)
+	m := c.metrics.observe(eventName, namespace)
+	defer m.stop()
+
+	ctx, debugLog := withDebugLog(ctx)
+
+	audit := c.newAudit(AuditOperationUpgrade, namespace, releaseName, values)
+	err := c.updateReleaseFromTarball(ctx, audit, chartPath, namespace, releaseName, values, options)
+	err = translateHelmError(err, namespace, releaseName)
+	audit.finish(ctx, err)
+	c.recordEvent(options.EventObject, upgradeOperation, namespace, releaseName, err)
 	if err != nil {
-		errorGauge.WithLabelValues(eventName).Inc()
-		return microerror.Mask(err)
+		m.fail()
+		recordSpanError(span, err)
+		return microerror.Mask(debugLog.attach(err))
 	}
 
 	return nil
 }
 
-func (c *Client) updateReleaseFromTarball(ctx context.Context, chartPath, namespace, releaseName string, values map[string]interface{}, options UpdateOptions) error {
-	cfg, err := c.newActionConfig(ctx, namespace)
+func (c *Client) updateReleaseFromTarball(ctx context.Context, audit *auditTrail, chartPath, namespace, releaseName string, values map[string]interface{}, options UpdateOptions) error {
+	if options.ServerSideApply && options.Force {
+		return microerror.Maskf(invalidConfigError, "force must not be used with server-side apply, use force conflicts instead")
+	}
+
+	ctx, unlock, err := c.lockRelease(ctx, namespace, releaseName)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	defer unlock()
+
+	audit.start(ctx)
+
+	progress := newProgressReporter(options.Progress)
+
+	cfg, kubeClients, err := c.newActionConfigWithKubeClients(ctx, namespace, kubeClientOptions{
+		Progress:        progress,
+		ServerSideApply: options.ServerSideApply,
+		FieldManager:    options.FieldManager,
+		ForceConflicts:  options.ForceConflicts,
+	})
 	if err != nil {
 		return microerror.Mask(err)
 	}
@@ -40,17 +70,37 @@ func (c *Client) updateReleaseFromTarball(ctx context.Context, chartPath, namesp
 
 	// Load the chart from the given path. This also ensures that all chart
 	// dependencies are present.
-	chartRequested, err := loader.Load(chartPath)
+	chartRequested, err := c.loadHelmChart(ctx, chartPath)
 	if err != nil {
 		return microerror.Mask(err)
 	}
 
+	progress.report(Progress{Phase: ProgressPhaseChartLoaded})
+
+	if options.MaxHistory == 0 {
+		options.MaxHistory = c.maxHistory
+	}
+
+	if options.ManageCRDs {
+		var changes []CRDChange
+		changes, err = c.applyCRDs(ctx, chartRequested, cfg)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+		progress.report(Progress{Phase: ProgressPhaseCRDsApplied, CRDs: changes})
+	}
+
 	// Configure action with supported upgrade options.
 	options.configure(upgrade, namespace)
 
-	_, err = upgrade.Run(releaseName, chartRequested, values)
+	start := time.Now()
+
+	kubeClients.startRender()
+	_, err = upgrade.RunWithContext(ctx, releaseName, chartRequested, values)
 	if err != nil {
-		return microerror.Mask(err)
+		err = cancellationCause(ctx, err)
+		err = kubeClients.recording.withBuiltObjects(err)
+		return microerror.Mask(c.lastHookFailure(ctx, cfg, namespace, releaseName, start, err))
 	}
 
 	return nil
@@ -67,9 +117,14 @@ func (options UpdateOptions) configure(action *action.Upgrade, namespace string)
 	// Sometimes hooks have to be disabled
 	action.DisableHooks = options.DisableHooks
 	action.Force = options.Force
-	// Explicitly set MaxHistory to 10 which is also the default for Helm 3.
-	action.MaxHistory = maxHistory
+	// A negative MaxHistory keeps all revisions which is expressed as 0 in
+	// Helm.
+	if options.MaxHistory < 0 {
+		options.MaxHistory = 0
+	}
+	action.MaxHistory = options.MaxHistory
 	action.Namespace = namespace
 	action.Timeout = options.Timeout
 	action.Wait = options.Wait
+	action.WaitForJobs = options.WaitForJobs
 }
@@ -0,0 +1,218 @@
+package helmclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"helm.sh/helm/v3/pkg/release"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// releaseEventBufferSize is the number of events buffered in the channel
+	// returned by WatchReleases.
+	releaseEventBufferSize = 100
+	// rollbackDescriptionPrefix is the prefix of the description Helm sets on
+	// revisions created by a rollback.
+	rollbackDescriptionPrefix = "Rollback to "
+)
+
+// WatchReleases watches the Helm storage secrets in the given namespace and
+// emits an event whenever a release is installed, upgraded, rolled back,
+// uninstalled or failed. An empty namespace watches all namespaces. Releases
+// existing when the watch starts do not produce events. The returned channel
+// is closed once the context is done.
+func (c *Client) WatchReleases(ctx context.Context, namespace string) (<-chan ReleaseEvent, error) {
+	eventName := "watch_releases"
+
+	// The span only covers setting up the watch until the release storage
+	// cache is synced. It ends when WatchReleases returns while events keep
+	// being delivered in the background.
+	ctx, span := c.tracer.Start(ctx, eventName, trace.WithAttributes(
+		attribute.String(attributeReleaseNamespace, namespace),
+	))
+	defer span.End()
+
+	m := c.metrics.observe(eventName, namespace)
+	defer m.stop()
+
+	events, err := c.watchReleases(ctx, namespace)
+	err = translateHelmError(err, namespace, "")
+	if err != nil {
+		m.fail()
+		recordSpanError(span, err)
+		return nil, microerror.Mask(err)
+	}
+
+	return events, nil
+}
+
+func (c *Client) watchReleases(ctx context.Context, namespace string) (<-chan ReleaseEvent, error) {
+	factory := informers.NewSharedInformerFactoryWithOptions(
+		c.k8sClient,
+		0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = releaseStorageOwnerSelector
+		}),
+	)
+	informer := factory.Core().V1().Secrets().Informer()
+
+	events := make(chan ReleaseEvent, releaseEventBufferSize)
+
+	send := func(event *ReleaseEvent) {
+		if event == nil {
+			return
+		}
+
+		select {
+		case events <- *event:
+		case <-ctx.Done():
+		}
+	}
+
+	handler := cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			if isInInitialList {
+				return
+			}
+			send(c.newReleaseEvent(ctx, nil, obj))
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			send(c.newReleaseEvent(ctx, oldObj, newObj))
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			send(c.newReleaseDeletedEvent(ctx, obj))
+		},
+	}
+
+	_, err := informer.AddEventHandler(handler)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	factory.Start(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		factory.Shutdown()
+		return nil, microerror.Maskf(executionFailedError, "failed to sync release storage cache for namespace %#q", namespace)
+	}
+
+	go func() {
+		<-ctx.Done()
+		factory.Shutdown()
+		close(events)
+	}()
+
+	return events, nil
+}
+
+// newReleaseEvent returns the event for an added or updated storage secret, or
+// nil if the change is not relevant, e.g. because the release is still
+// pending or the status did not change.
+func (c *Client) newReleaseEvent(ctx context.Context, oldObj, newObj interface{}) *ReleaseEvent {
+	rel := c.decodeReleaseObject(ctx, newObj)
+	if rel == nil || rel.Info == nil {
+		return nil
+	}
+
+	var previous release.Status
+	if oldObj != nil {
+		oldRel := c.decodeReleaseObject(ctx, oldObj)
+		if oldRel != nil && oldRel.Info != nil {
+			previous = oldRel.Info.Status
+		}
+	}
+	if previous == rel.Info.Status {
+		return nil
+	}
+
+	var eventType string
+	switch rel.Info.Status {
+	case release.StatusDeployed:
+		eventType = deployedEventType(previous, rel)
+	case release.StatusFailed:
+		eventType = ReleaseEventFailed
+	case release.StatusUninstalled:
+		eventType = ReleaseEventUninstalled
+	default:
+		return nil
+	}
+
+	return &ReleaseEvent{
+		Namespace: rel.Namespace,
+		Release:   releaseToReleaseContent(rel),
+		Type:      eventType,
+	}
+}
+
+// deployedEventType returns the type of the event for a revision which became
+// deployed. Helm stores every revision in a pending status first, which tells
+// the operations apart. This also covers installing a release again after it
+// was uninstalled with KeepHistory, which continues the revisions of the
+// previous install. Revisions created as deployed, e.g. by ImportRelease, are
+// classified by their version and description instead.
+func deployedEventType(previous release.Status, rel *release.Release) string {
+	switch {
+	case previous == release.StatusPendingInstall:
+		return ReleaseEventInstalled
+	case previous == release.StatusPendingRollback:
+		return ReleaseEventRolledBack
+	case previous == release.StatusPendingUpgrade:
+		return ReleaseEventUpgraded
+	case rel.Version == 1:
+		return ReleaseEventInstalled
+	case strings.HasPrefix(rel.Info.Description, rollbackDescriptionPrefix):
+		return ReleaseEventRolledBack
+	default:
+		return ReleaseEventUpgraded
+	}
+}
+
+// newReleaseDeletedEvent returns the event for a deleted storage secret. Helm
+// deletes all revisions when uninstalling without keeping history. Only the
+// latest revision is marked as uninstalling at that point, so deleted
+// revisions in any other status, e.g. those removed when trimming history,
+// are ignored.
+func (c *Client) newReleaseDeletedEvent(ctx context.Context, obj interface{}) *ReleaseEvent {
+	rel := c.decodeReleaseObject(ctx, obj)
+	if rel == nil || rel.Info == nil {
+		return nil
+	}
+	if rel.Info.Status != release.StatusUninstalling {
+		return nil
+	}
+
+	rel.Info.Status = release.StatusUninstalled
+
+	return &ReleaseEvent{
+		Namespace: rel.Namespace,
+		Release:   releaseToReleaseContent(rel),
+		Type:      ReleaseEventUninstalled,
+	}
+}
+
+func (c *Client) decodeReleaseObject(ctx context.Context, obj interface{}) *release.Release {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return nil
+	}
+
+	rel, err := decodeReleaseSecret(secret)
+	if err != nil {
+		c.logger.LogCtx(ctx, "level", "warning", "message", fmt.Sprintf("failed to decode release storage secret %#q in namespace %#q", secret.Name, secret.Namespace), "stack", fmt.Sprintf("%#v", err))
+		return nil
+	}
+
+	return rel
+}
@@ -0,0 +1,171 @@
+package helmclient
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_Client_newReleaseEvent(t *testing.T) {
+	testCases := []struct {
+		name         string
+		old          *release.Release
+		new          *release.Release
+		deleted      bool
+		expectedType string
+	}{
+		{
+			name:         "case 0: first install",
+			old:          newWatchTestRelease(1, release.StatusPendingInstall, "Initial install underway"),
+			new:          newWatchTestRelease(1, release.StatusDeployed, "Install complete"),
+			expectedType: ReleaseEventInstalled,
+		},
+		{
+			name:         "case 1: install after uninstall with kept history",
+			old:          newWatchTestRelease(3, release.StatusPendingInstall, "Initial install underway"),
+			new:          newWatchTestRelease(3, release.StatusDeployed, "Install complete"),
+			expectedType: ReleaseEventInstalled,
+		},
+		{
+			name:         "case 2: upgrade",
+			old:          newWatchTestRelease(2, release.StatusPendingUpgrade, "Preparing upgrade"),
+			new:          newWatchTestRelease(2, release.StatusDeployed, "Upgrade complete"),
+			expectedType: ReleaseEventUpgraded,
+		},
+		{
+			name:         "case 3: rollback",
+			old:          newWatchTestRelease(3, release.StatusPendingRollback, "Rollback to 1"),
+			new:          newWatchTestRelease(3, release.StatusDeployed, "Rollback to 1"),
+			expectedType: ReleaseEventRolledBack,
+		},
+		{
+			name:         "case 4: upgrade with custom description starting like a rollback",
+			old:          newWatchTestRelease(2, release.StatusPendingUpgrade, "Preparing upgrade"),
+			new:          newWatchTestRelease(2, release.StatusDeployed, "Rollback to the previous image"),
+			expectedType: ReleaseEventUpgraded,
+		},
+		{
+			name:         "case 5: first revision added as deployed",
+			new:          newWatchTestRelease(1, release.StatusDeployed, "Install complete"),
+			expectedType: ReleaseEventInstalled,
+		},
+		{
+			name:         "case 6: rollback revision added as deployed",
+			new:          newWatchTestRelease(3, release.StatusDeployed, "Rollback to 1"),
+			expectedType: ReleaseEventRolledBack,
+		},
+		{
+			name:         "case 7: later revision added as deployed",
+			new:          newWatchTestRelease(2, release.StatusDeployed, "Upgrade complete"),
+			expectedType: ReleaseEventUpgraded,
+		},
+		{
+			name:         "case 8: failed upgrade",
+			old:          newWatchTestRelease(2, release.StatusPendingUpgrade, "Preparing upgrade"),
+			new:          newWatchTestRelease(2, release.StatusFailed, "Upgrade failed"),
+			expectedType: ReleaseEventFailed,
+		},
+		{
+			name:         "case 9: uninstall with kept history",
+			old:          newWatchTestRelease(2, release.StatusUninstalling, "Deletion in progress (or silently failed)"),
+			new:          newWatchTestRelease(2, release.StatusUninstalled, "Uninstallation complete"),
+			expectedType: ReleaseEventUninstalled,
+		},
+		{
+			name: "case 10: pending install is ignored",
+			new:  newWatchTestRelease(1, release.StatusPendingInstall, "Initial install underway"),
+		},
+		{
+			name: "case 11: unchanged status is ignored",
+			old:  newWatchTestRelease(2, release.StatusDeployed, "Upgrade complete"),
+			new:  newWatchTestRelease(2, release.StatusDeployed, "Upgrade complete"),
+		},
+		{
+			name:         "case 12: deleted uninstalling revision",
+			new:          newWatchTestRelease(2, release.StatusUninstalling, "Deletion in progress (or silently failed)"),
+			deleted:      true,
+			expectedType: ReleaseEventUninstalled,
+		},
+		{
+			name:    "case 13: deleted superseded revision is ignored",
+			new:     newWatchTestRelease(1, release.StatusSuperseded, "Install complete"),
+			deleted: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			c := &Client{
+				logger: microloggertest.New(),
+			}
+
+			var event *ReleaseEvent
+			if tc.deleted {
+				event = c.newReleaseDeletedEvent(context.Background(), newWatchTestSecret(t, tc.new))
+			} else if tc.old != nil {
+				event = c.newReleaseEvent(context.Background(), newWatchTestSecret(t, tc.old), newWatchTestSecret(t, tc.new))
+			} else {
+				event = c.newReleaseEvent(context.Background(), nil, newWatchTestSecret(t, tc.new))
+			}
+
+			if tc.expectedType == "" {
+				if event != nil {
+					t.Fatalf("expected no event got %#q", event.Type)
+				}
+				return
+			}
+
+			if event == nil {
+				t.Fatalf("expected %#q event got none", tc.expectedType)
+			}
+			if event.Type != tc.expectedType {
+				t.Fatalf("expected %#q event got %#q", tc.expectedType, event.Type)
+			}
+			if event.Namespace != "default" {
+				t.Fatalf("expected namespace %#q got %#q", "default", event.Namespace)
+			}
+		})
+	}
+}
+
+func newWatchTestRelease(version int, status release.Status, description string) *release.Release {
+	return &release.Release{
+		Name:      "foo",
+		Namespace: "default",
+		Version:   version,
+		Info: &release.Info{
+			Description: description,
+			Status:      status,
+		},
+	}
+}
+
+// newWatchTestSecret returns the storage secret Helm writes for the given
+// revision.
+func newWatchTestSecret(t *testing.T, rel *release.Release) *corev1.Secret {
+	secrets := fake.NewSimpleClientset().CoreV1().Secrets(rel.Namespace)
+
+	err := driver.NewSecrets(secrets).Create(rel.Name+".v"+strconv.Itoa(rel.Version), rel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := secrets.List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 {
+		t.Fatalf("expected 1 storage secret got %d", len(list.Items))
+	}
+
+	return &list.Items[0]
+}
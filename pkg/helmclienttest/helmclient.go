@@ -40,15 +40,39 @@ func New(config Config) helmclient.Interface {
 	return c
 }
 
-func (c *Client) DeleteRelease(ctx context.Context, namespace, releaseName string, options helmclient.DeleteOptions) error {
+func (c *Client) ApplyCRDsFromTarball(ctx context.Context, chartPath string) ([]helmclient.CRDChange, error) {
 	if c.defaultError != nil {
-		return c.defaultError
+		return nil, c.defaultError
 	}
 
-	return nil
+	return nil, nil
+}
+
+func (c *Client) CompareRevisions(ctx context.Context, namespace, releaseName string, fromRevision, toRevision int) (*helmclient.RevisionDiff, error) {
+	if c.defaultError != nil {
+		return nil, c.defaultError
+	}
+
+	return &helmclient.RevisionDiff{FromRevision: fromRevision, ToRevision: toRevision}, nil
+}
+
+func (c *Client) DeleteRelease(ctx context.Context, namespace, releaseName string, options helmclient.DeleteOptions) (*helmclient.DeleteResult, error) {
+	if c.defaultError != nil {
+		return nil, c.defaultError
+	}
+
+	return &helmclient.DeleteResult{}, nil
+}
+
+func (c *Client) ExportRelease(ctx context.Context, namespace, releaseName string) ([]byte, error) {
+	if c.defaultError != nil {
+		return nil, c.defaultError
+	}
+
+	return nil, nil
 }
 
-func (c *Client) GetReleaseContent(ctx context.Context, namespace, releaseName string) (*helmclient.ReleaseContent, error) {
+func (c *Client) GetReleaseContent(ctx context.Context, namespace, releaseName string, options helmclient.GetOptions) (*helmclient.ReleaseContent, error) {
 	if c.defaultError != nil {
 		return nil, c.defaultError
 	}
@@ -64,6 +88,22 @@ func (c *Client) GetReleaseHistory(ctx context.Context, namespace, releaseName s
 	return c.defaultReleaseHistory, nil
 }
 
+func (c *Client) GetReleaseRevision(ctx context.Context, namespace, releaseName string, revision int, options helmclient.GetOptions) (*helmclient.ReleaseContent, error) {
+	if c.defaultError != nil {
+		return nil, c.defaultError
+	}
+
+	return c.defaultReleaseContent, nil
+}
+
+func (c *Client) ImportRelease(ctx context.Context, archive []byte, options helmclient.ImportOptions) error {
+	if c.defaultError != nil {
+		return c.defaultError
+	}
+
+	return nil
+}
+
 func (c *Client) InstallReleaseFromTarball(ctx context.Context, chartPath, namespace string, values map[string]interface{}, options helmclient.InstallOptions) error {
 	return nil
 }
@@ -72,6 +112,22 @@ func (c *Client) ListReleaseContents(ctx context.Context, namespace string) ([]*
 	return nil, nil
 }
 
+func (c *Client) ListReleases(ctx context.Context, namespace string, options helmclient.ListOptions) ([]*helmclient.ReleaseContent, error) {
+	if c.defaultError != nil {
+		return nil, c.defaultError
+	}
+
+	return nil, nil
+}
+
+func (c *Client) ListReleaseHistory(ctx context.Context, namespace, releaseName string, options helmclient.HistoryOptions) ([]helmclient.ReleaseHistory, error) {
+	if c.defaultError != nil {
+		return nil, c.defaultError
+	}
+
+	return c.defaultReleaseHistory, nil
+}
+
 func (c *Client) LoadChart(ctx context.Context, chartPath string) (helmclient.Chart, error) {
 	if c.loadChartError != nil {
 		return helmclient.Chart{}, c.loadChartError
@@ -80,6 +136,30 @@ func (c *Client) LoadChart(ctx context.Context, chartPath string) (helmclient.Ch
 	return c.loadChartResponse, nil
 }
 
+func (c *Client) MigrateRelease(ctx context.Context, namespace, releaseName string, options helmclient.MigrateOptions) error {
+	if c.defaultError != nil {
+		return c.defaultError
+	}
+
+	return nil
+}
+
+func (c *Client) PlanAdoption(ctx context.Context, chartPath, namespace string, values map[string]interface{}, options helmclient.InstallOptions) (*helmclient.AdoptionReport, error) {
+	if c.defaultError != nil {
+		return nil, c.defaultError
+	}
+
+	return &helmclient.AdoptionReport{}, nil
+}
+
+func (c *Client) PruneReleases(ctx context.Context, namespace string, options helmclient.PruneOptions) (*helmclient.PruneResult, error) {
+	if c.defaultError != nil {
+		return nil, c.defaultError
+	}
+
+	return &helmclient.PruneResult{}, nil
+}
+
 func (c *Client) PullChartTarball(ctx context.Context, tarballURL string) (string, error) {
 	if c.pullChartTarballError != nil {
 		return "", c.pullChartTarballError
@@ -88,14 +168,50 @@ func (c *Client) PullChartTarball(ctx context.Context, tarballURL string) (strin
 	return c.pullChartTarballPath, nil
 }
 
-func (c *Client) Rollback(ctx context.Context, namespace, releaseName string, revision int, options helmclient.RollbackOptions) error {
+func (c *Client) RecoverStuckRelease(ctx context.Context, namespace, releaseName string, options helmclient.RecoverOptions) error {
+	if c.defaultError != nil {
+		return c.defaultError
+	}
+
 	return nil
 }
 
-func (c *Client) RunReleaseTest(ctx context.Context, namespace, releaseName string) error {
+func (c *Client) Rollback(ctx context.Context, namespace, releaseName string, revision int, options helmclient.RollbackOptions) error {
 	return nil
 }
 
+func (c *Client) RunBatch(ctx context.Context, operations []helmclient.BatchOperation, options helmclient.BatchOptions) (map[string]helmclient.BatchResult, error) {
+	if c.defaultError != nil {
+		return nil, c.defaultError
+	}
+
+	results := map[string]helmclient.BatchResult{}
+	for _, op := range operations {
+		results[op.Key()] = helmclient.BatchResult{}
+	}
+
+	return results, nil
+}
+
+func (c *Client) RunReleaseTest(ctx context.Context, namespace, releaseName string, options helmclient.ReleaseTestOptions) (*helmclient.ReleaseTestResult, error) {
+	return &helmclient.ReleaseTestResult{}, nil
+}
+
 func (c *Client) UpdateReleaseFromTarball(ctx context.Context, chartPath, namespace, releaseName string, values map[string]interface{}, options helmclient.UpdateOptions) error {
 	return nil
 }
+
+func (c *Client) WatchReleases(ctx context.Context, namespace string) (<-chan helmclient.ReleaseEvent, error) {
+	if c.defaultError != nil {
+		return nil, c.defaultError
+	}
+
+	events := make(chan helmclient.ReleaseEvent)
+
+	go func() {
+		<-ctx.Done()
+		close(events)
+	}()
+
+	return events, nil
+}